@@ -7,9 +7,11 @@ import * as path from 'path';
 import { workspace, ExtensionContext, TextDocument, Disposable } from 'vscode';
 import * as net from 'net';
 import {
+	ClientCapabilities,
 	LanguageClient,
 	LanguageClientOptions,
 	ServerOptions,
+	StaticFeature,
 } from 'vscode-languageclient';
 
 let client: LanguageClient;
@@ -35,11 +37,34 @@ function startLanguageServerTCP(address: number, documentSelector: string[]): Di
 
 
     const client = new LanguageClient(`tcp language server (port ${address})`, serverOptions, clientOptions)
+    client.registerFeature(new DocumentTextFeature(client));
     const disposable = client.start();
 
     return disposable;
 }
 
+// DocumentTextFeature answers $/plaintext/documentText, which the server
+// sends when it notices its copy of a document has drifted from ours.
+class DocumentTextFeature implements StaticFeature {
+    constructor(private client: LanguageClient) {}
+
+    fillClientCapabilities(capabilities: ClientCapabilities): void {
+        capabilities.experimental = { ...capabilities.experimental, plaintextDocumentText: true };
+    }
+
+    initialize(): void {
+        this.client.onReady().then(() => {
+            this.client.onRequest("$/plaintext/documentText", (params: { textDocument: { uri: string } }) => {
+                const document = workspace.textDocuments.find((d) => d.uri.toString() === params.textDocument.uri);
+                if (!document) {
+                    return null;
+                }
+                return { version: document.version, text: document.getText() };
+            });
+        });
+    }
+}
+
 export function deactivate(): Thenable<void> | undefined {
 	if (!client) {
 		return undefined;
@@ -2,7 +2,7 @@ package main
 
 import (
 	"bufio"
-	"encoding/hex"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -27,8 +27,30 @@ const (
 )
 
 const (
-	serverInitialize  string = "initialize"
-	serverInitialized string = "initialized"
+	serverInitialize    string = "initialize"
+	serverInitialized   string = "initialized"
+	serverBuildInfo     string = "$/plaintext/buildInfo"
+	serverCancelRequest string = "$/cancelRequest"
+)
+
+const (
+	textDocumentDidOpen   string = "textDocument/didOpen"
+	textDocumentDidChange string = "textDocument/didChange"
+	textDocumentDidClose  string = "textDocument/didClose"
+	textDocumentDidSave   string = "textDocument/didSave"
+	textDocumentWillSave  string = "textDocument/willSave"
+
+	textDocumentWillSaveWaitUntil string = "textDocument/willSaveWaitUntil"
+	textDocumentCodeAction        string = "textDocument/codeAction"
+	textDocumentDiagnostic        string = "textDocument/diagnostic"
+)
+
+const (
+	workspaceDidChangeWatchedFiles     string = "workspace/didChangeWatchedFiles"
+	workspaceDidChangeWorkspaceFolders string = "workspace/didChangeWorkspaceFolders"
+	workspaceDidChangeConfiguration    string = "workspace/didChangeConfiguration"
+	workspaceExecuteCommand            string = "workspace/executeCommand"
+	workspaceDiagnostic                string = "workspace/diagnostic"
 )
 
 func main() {
@@ -40,8 +62,14 @@ func main() {
 func realMain() error {
 	iface := flag.String("iface", "127.0.0.1", "interface to bind to, defaults to localhost")
 	port := flag.String("port", "", "port to bind to")
+	version := flag.Bool("version", false, "print the server version and exit")
 	flag.Parse()
 
+	if *version {
+		fmt.Println(tcpserver.VersionString())
+		return nil
+	}
+
 	if iface == nil || *iface == "" {
 		return errors.New("-iface is required")
 	}
@@ -82,10 +110,20 @@ func handleClientConn(conn io.ReadWriteCloser) error {
 	var xref xrefs.Service
 	options := &languageserver.Options{}
 	server := languageserver.NewServer(xref, options)
+	session := tcpserver.NewSession(conn)
+	defer session.Close()
+
+	// one reader for the whole connection, so bytes buffered past the end
+	// of a message are still there for the next one
+	reader := bufio.NewReader(io.TeeReader(conn, os.Stderr))
 
 	more := true
 	for more {
-		req, last, err := parseRequest(io.TeeReader(conn, os.Stderr))
+		req, last, err := parseRequest(reader)
+		if errors.Cause(err) == io.EOF {
+			// client hung up
+			return nil
+		}
 		if err != nil {
 			log.Println(err, "parsing request")
 			return errors.Wrap(err, "parsing request")
@@ -96,7 +134,7 @@ func handleClientConn(conn io.ReadWriteCloser) error {
 		}
 
 		// handle request and respond
-		if err := serveReq(conn, req, server); err != nil {
+		if err := serveReq(req, server, session); err != nil {
 			log.Println(err, "serving request")
 			return errors.Wrap(err, "serving request")
 		}
@@ -104,20 +142,60 @@ func handleClientConn(conn io.ReadWriteCloser) error {
 	return nil
 }
 
-func serveReq(conn io.Writer, req *parse.LspRequest, server languageserver.Server) error {
+func serveReq(req *parse.LspRequest, server languageserver.Server, session *tcpserver.Session) error {
 	body := req.Body
 	var result interface{}
 	var err error
 
 	switch body.Method {
+	case "":
+		// a response to one of our own requests
+		session.Conn().HandleResponse(body)
+		return nil
 	case serverInitialize:
-		result, err = tcpserver.Initialize(body, server)
-	case serverInitialized:
+		result, err = session.Initialize(body, server)
+	case serverInitialized, textDocumentDidOpen, textDocumentDidChange, textDocumentDidClose,
+		textDocumentDidSave, textDocumentWillSave, workspaceDidChangeWatchedFiles,
+		workspaceDidChangeWorkspaceFolders, workspaceDidChangeConfiguration, serverCancelRequest:
+		// notifications get no response; a bad one is logged rather than
+		// dropping the connection
+		if err := serveNotification(body, session); err != nil {
+			log.Printf("handling %s: %v", body.Method, err)
+		}
+		return nil
+	case serverBuildInfo:
+		result = tcpserver.BuildInfo()
+	case textDocumentWillSaveWaitUntil:
+		result, err = session.WillSaveWaitUntil(body)
+	case textDocumentCodeAction:
+		result, err = session.CodeAction(body)
+	case workspaceExecuteCommand:
+		result, err = session.ExecuteCommand(body)
+	case textDocumentDiagnostic:
+		result, err = session.DocumentDiagnostic(body)
+	case workspaceDiagnostic:
+		// it may be held open until diagnostics change, so it is answered
+		// in the background while other messages are read
+		go func() {
+			result, err := session.WorkspaceDiagnostic(body)
+			if err := respond(body, result, err, session); err != nil {
+				log.Printf("answering %s (id %d): %v", body.Method, body.Id, err)
+			}
+		}()
+		return nil
 	default:
-		err = errors.Errorf("unsupported method: %q", body.Method)
+		err = errMethodNotFound{body.Method}
 	}
+	return respond(body, result, err, session)
+}
+
+// respond answers the request in body with the result of handling it, or
+// with the error it failed with.
+func respond(body *parse.LspBody, result interface{}, err error, session *tcpserver.Session) error {
 	if err != nil {
-		return errors.Wrap(err, "handling method")
+		// the client is told, and the connection stays up for the next
+		// request
+		log.Printf("handling %s (id %d): %v", body.Method, body.Id, err)
 	}
 
 	response, err := NewResponse(body.Id, result, err)
@@ -125,48 +203,101 @@ func serveReq(conn io.Writer, req *parse.LspRequest, server languageserver.Serve
 		return errors.Wrap(err, "preparing response")
 	}
 
-	marshalledBodyRequest, err := json.Marshal(&response)
-	if err != nil {
-		return errors.Wrap(err, "marshaling response body")
+	if err := session.Conn().Send(response); err != nil {
+		return errors.Wrap(err, "writing response to connection")
 	}
-	// contentLengthRespBody := int(len(marshalledBodyRequest))
+	log.Printf("responded to %s (id %d)", body.Method, body.Id)
 
-	// CR LF -> %0D%0A to seperate header and body
-	s := fmt.Sprintf("%x", "Content-Length: 171\r\n\r\n")
-	// returns binary value of "string" + %0D%0A
-	b, err := hex.DecodeString(s)
-	if err != nil {
-		return errors.Wrap(err, "decoding string to hex to binary")
-	}
+	return nil
+}
 
-	log.Print("\n")
-	if _, err := conn.Write(b); err != nil {
-		return errors.Wrap(err, "writing response to connection")
+func serveNotification(body *parse.LspBody, session *tcpserver.Session) error {
+	switch body.Method {
+	case serverInitialized:
+		return session.Initialized(body)
+	case textDocumentDidOpen:
+		return session.DidOpen(body)
+	case textDocumentDidChange:
+		return session.DidChange(body)
+	case textDocumentDidClose:
+		return session.DidClose(body)
+	case textDocumentWillSave:
+		return session.WillSave(body)
+	case textDocumentDidSave:
+		return session.DidSave(body)
+	case workspaceDidChangeWatchedFiles:
+		return session.DidChangeWatchedFiles(body)
+	case workspaceDidChangeWorkspaceFolders:
+		return session.DidChangeWorkspaceFolders(body)
+	case workspaceDidChangeConfiguration:
+		return session.DidChangeConfiguration(body)
+	case serverCancelRequest:
+		return session.CancelRequest(body)
 	}
+	return errors.Errorf("unsupported notification: %q", body.Method)
+}
 
-	log.Print("\n")
-	log.Println("stringified", string(marshalledBodyRequest))
-	if _, err := conn.Write(marshalledBodyRequest); err != nil {
-		return errors.Wrap(err, "writing response to connection")
-	}
+// JSON-RPC error codes.
+const (
+	codeMethodNotFound   = -32601
+	codeInvalidParams    = -32602
+	codeInternalError    = -32603
+	codeRequestCancelled = -32800
+)
 
-	return nil
+// errMethodNotFound is the error of a request for a method the server does
+// not have.
+type errMethodNotFound struct {
+	method string
 }
 
-func NewResponse(id int, result interface{}, err error) (*Response, error) {
-	r, err := marshalInterface(result)
+func (e errMethodNotFound) Error() string {
+	return fmt.Sprintf("unsupported method: %q", e.method)
+}
+
+// NewResponse answers the request with the given id: with result, or with
+// handlerErr if the handler failed.
+func NewResponse(id int, result interface{}, handlerErr error) (*Response, error) {
 	response := &Response{
 		Jsonrpc: "2.0",
 		Id:      id,
-		Result:  r,
 	}
+	if handlerErr != nil {
+		response.Error = newResponseError(handlerErr)
+		return response, nil
+	}
+	r, err := marshalInterface(result)
+	response.Result = r
 	return response, err
 }
 
 type Response struct {
 	Jsonrpc string          `json:"jsonrpc"`
 	Id      int             `json:"id"`
-	Result  json.RawMessage `json:"result"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *ResponseError  `json:"error,omitempty"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// newResponseError picks the code for err: params that could not be
+// decoded are invalid, a request the client cancelled is cancelled, and
+// anything else that went wrong is internal.
+func newResponseError(err error) *ResponseError {
+	if errors.Cause(err) == context.Canceled {
+		return &ResponseError{Code: codeRequestCancelled, Message: err.Error()}
+	}
+	code := codeInternalError
+	switch errors.Cause(err).(type) {
+	case errMethodNotFound:
+		code = codeMethodNotFound
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		code = codeInvalidParams
+	}
+	return &ResponseError{Code: code, Message: err.Error()}
 }
 
 func marshalInterface(obj interface{}) (json.RawMessage, error) {
@@ -178,6 +309,7 @@ func marshalInterface(obj interface{}) (json.RawMessage, error) {
 }
 
 func parseRequest(in io.Reader) (_ *parse.LspRequest, last bool, err error) {
+	in = bufferedReader(in)
 	header, err := parseHeader(in)
 	if err != nil {
 		log.Println(err, "parsing header")
@@ -219,11 +351,23 @@ func parseRequest(in io.Reader) (_ *parse.LspRequest, last bool, err error) {
 
 func parseHeader(in io.Reader) (*parse.LspHeader, error) {
 	var lsp parse.LspHeader
-	scan := bufio.NewScanner(in)
+	reader := bufferedReader(in)
 	fmt.Println("received header... ")
 
-	for scan.Scan() {
-		header := scan.Text()
+	for lines := 0; ; lines++ {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && lines == 0 && line == "" {
+			// connection closed between messages
+			return nil, io.EOF
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Println(err, "scanning header entries")
+			return nil, errors.Wrap(err, "scanning header entries")
+		}
+		header := strings.TrimRight(line, "\r\n")
 		fmt.Println(header)
 		if header == "" {
 			// last header
@@ -246,14 +390,19 @@ func parseHeader(in io.Reader) (*parse.LspHeader, error) {
 			lsp.ContentType = value
 		}
 	}
-	if err := scan.Err(); err != nil {
-		log.Println(err, "scanning header entries")
-		return nil, errors.Wrap(err, "scanning header entries")
-	}
 	log.Println("no body contained")
 	return nil, errors.New("no body contained")
 }
 
+// bufferedReader reuses in when it is already buffered, so that a header and
+// the body after it are read from the same buffer.
+func bufferedReader(in io.Reader) *bufio.Reader {
+	if reader, ok := in.(*bufio.Reader); ok {
+		return reader
+	}
+	return bufio.NewReader(in)
+}
+
 func splitOnce(in, sep string) (prefix, suffix string, err error) {
 	sepIdx := strings.Index(in, sep)
 	if sepIdx < 0 {
@@ -266,29 +415,13 @@ func splitOnce(in, sep string) (prefix, suffix string, err error) {
 }
 
 func parseBody(in io.Reader, contentLength int64) (string, error) {
-	var body string
-	scanner := bufio.NewScanner(in)
-
-	split := func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if atEOF || (len(data) == int(contentLength)) {
-			return len(data), data, nil
-		}
-		return 0, nil, nil
+	if contentLength < 0 {
+		return "", errors.Errorf("invalid Content-Length: %d", contentLength)
 	}
-	scanner.Split(split)
-	buf := make([]byte, 2)
-	scanner.Buffer(buf, bufio.MaxScanTokenSize)
-	for scanner.Scan() {
-		if len(scanner.Bytes()) == int(contentLength) {
-			body = scanner.Text()
-			break
-		}
+	body := make([]byte, contentLength)
+	if _, err := io.ReadFull(bufferedReader(in), body); err != nil {
+		log.Println(err, "reading body")
+		return "", errors.Wrap(err, "reading body")
 	}
-
-	if err := scanner.Err(); err != nil {
-		log.Println(err, "scanning body entries")
-		return "", errors.Wrap(err, "scanning body entries")
-	}
-
-	return body, nil
+	return string(body), nil
 }
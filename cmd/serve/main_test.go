@@ -2,14 +2,19 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"strings"
 	"testing"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"time"
 	"github.com/stretchr/testify/require"
 	"lsp/mock/jsonclientdumps"
+	tcpserver "lsp/server"
 	"lsp/server/parse"
 	"kythe.io/kythe/go/languageserver"
 	"kythe.io/kythe/go/services/xrefs"
@@ -60,7 +65,7 @@ func TestServeRequest(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := serveReq(tt.paramResp, &tt.paramReq, tt.server)
+			err := serveReq(&tt.paramReq, tt.server, tcpserver.NewSession(tt.paramResp))
 			require.NoError(t, err)
 			require.Equal(t, tt.want, err)
 		})
@@ -570,3 +575,138 @@ func Test_splitOnce(t *testing.T) {
 		})
 	}
 }
+
+// clientConn is a connection whose client sends in and has the server's
+// messages written to out.
+type clientConn struct {
+	io.Reader
+	out io.Writer
+}
+
+func (c clientConn) Write(p []byte) (int, error) { return c.out.Write(p) }
+func (c clientConn) Close() error                { return nil }
+
+func TestServeRequestError(t *testing.T) {
+	var in strings.Builder
+	for _, msg := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"textDocument/codeAction","params":5}`,
+		`{"jsonrpc":"2.0","id":2,"method":"workspace/executeCommand","params":{"command":"plaintext.noSuchCommand"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"textDocument/hover","params":{}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"textDocument/willSaveWaitUntil","params":{"textDocument":{"uri":"file:///not/open.txt"},"reason":1}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"$/plaintext/buildInfo"}`,
+	} {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	out := &bytes.Buffer{}
+	require.NoError(t, handleClientConn(clientConn{Reader: strings.NewReader(in.String()), out: out}))
+
+	// every request is answered, failed or not
+	reader := bufio.NewReader(out)
+	var responses []Response
+	for {
+		header, err := parseHeader(reader)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := parseBody(reader, header.ContentLength)
+		require.NoError(t, err)
+		var r Response
+		require.NoError(t, json.Unmarshal([]byte(body), &r))
+		responses = append(responses, r)
+	}
+	require.Len(t, responses, 5)
+	for i, want := range []int{codeInvalidParams, codeInternalError, codeMethodNotFound, codeInternalError} {
+		r := responses[i]
+		require.Equal(t, i+1, r.Id)
+		require.NotNil(t, r.Error, "id %d", r.Id)
+		require.Equal(t, want, r.Error.Code, "id %d", r.Id)
+		require.NotEmpty(t, r.Error.Message)
+		require.Empty(t, r.Result)
+	}
+	require.Nil(t, responses[4].Error)
+	require.Contains(t, string(responses[4].Result), tcpserver.ServerName)
+}
+
+// testMessage is any message from the server.
+type testMessage struct {
+	Id     *int            `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *ResponseError  `json:"error"`
+}
+
+func TestServeWorkspaceDiagnosticInBackground(t *testing.T) {
+	inReader, in := io.Pipe()
+	outReader, out := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- handleClientConn(clientConn{Reader: inReader, out: out})
+		out.Close()
+	}()
+	messages := make(chan testMessage, 100)
+	go func() {
+		reader := bufio.NewReader(outReader)
+		for {
+			header, err := parseHeader(reader)
+			if err != nil {
+				close(messages)
+				return
+			}
+			body, err := parseBody(reader, header.ContentLength)
+			require.NoError(t, err)
+			var m testMessage
+			require.NoError(t, json.Unmarshal([]byte(body), &m))
+			messages <- m
+		}
+	}()
+	send := func(msg string) {
+		_, err := fmt.Fprintf(in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+		require.NoError(t, err)
+	}
+	// response waits for the response to the request with the given id,
+	// failing if another arrives first
+	response := func(id int) testMessage {
+		for {
+			select {
+			case m := <-messages:
+				if m.Method != "" {
+					continue
+				}
+				require.NotNil(t, m.Id)
+				require.Equal(t, id, *m.Id)
+				return m
+			case <-time.After(5 * time.Second):
+				t.Fatalf("no response to %d", id)
+			}
+		}
+	}
+
+	dir := t.TempDir()
+	uri := "file://" + filepath.ToSlash(filepath.Join(dir, "a.txt"))
+	send(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{"textDocument":{"diagnostic":{}}},"workspaceFolders":[{"uri":"file://%s","name":"ws"}]}}`, filepath.ToSlash(dir)))
+	response(1)
+	send(fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":%q,"languageId":"plaintext","version":1,"text":"foo\n"}}}`, uri))
+	send(`{"jsonrpc":"2.0","id":2,"method":"workspace/diagnostic","params":{"previousResultIds":[]}}`)
+	var report struct {
+		Items []struct {
+			URI      string `json:"uri"`
+			ResultID string `json:"resultId"`
+		}
+	}
+	require.NoError(t, json.Unmarshal(response(2).Result, &report))
+	require.Len(t, report.Items, 1)
+
+	// nothing has changed since, so the request is held while others are
+	// answered, until the client cancels it
+	send(fmt.Sprintf(`{"jsonrpc":"2.0","id":3,"method":"workspace/diagnostic","params":{"previousResultIds":[{"uri":%q,"value":%q}]}}`, report.Items[0].URI, report.Items[0].ResultID))
+	send(`{"jsonrpc":"2.0","id":4,"method":"$/plaintext/buildInfo"}`)
+	response(4)
+	send(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":3}}`)
+	cancelled := response(3)
+	require.NotNil(t, cancelled.Error)
+	require.Equal(t, codeRequestCancelled, cancelled.Error.Code)
+
+	in.Close()
+	require.NoError(t, <-served)
+}
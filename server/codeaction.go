@@ -0,0 +1,304 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lsp/server/document"
+	"lsp/server/docuri"
+	"lsp/server/lint"
+	"lsp/server/parse"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+const (
+	codeActionQuickFix = "quickfix"
+	codeActionSource   = "source"
+	codeActionFixAll   = "source.fixAll.plaintext"
+)
+
+// commandApplyEdit makes the workspace edit it takes as its argument. It
+// stands in for the edits of code actions sent to clients that only take
+// commands.
+const commandApplyEdit = "plaintext.applyEdit"
+
+// commandAllowText adds text to the allow list of the lint configuration
+// of the folder holding a document. It takes the document URI and the
+// text.
+const commandAllowText = "plaintext.allowText"
+
+type CodeActionParamsValue struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+	Range        lsp.Range                  `json:"range"`
+	Context      CodeActionContextValue     `json:"context"`
+}
+
+type CodeActionContextValue struct {
+	Diagnostics []DiagnosticValue `json:"diagnostics"`
+	Only        []string          `json:"only,omitempty"`
+}
+
+type CodeActionValue struct {
+	Title       string             `json:"title"`
+	Kind        string             `json:"kind,omitempty"`
+	Diagnostics []DiagnosticValue  `json:"diagnostics,omitempty"`
+	IsPreferred bool               `json:"isPreferred,omitempty"`
+	Edit        *lsp.WorkspaceEdit `json:"edit,omitempty"`
+	Command     *lsp.Command       `json:"command,omitempty"`
+}
+
+type CodeActionOptionsValue struct {
+	CodeActionKinds []string `json:"codeActionKinds"`
+}
+
+// codeActionProvider is what initialize advertises: the kinds of code
+// action for clients that take code actions, and plain support for those
+// that only take commands.
+func (s *Session) codeActionProvider() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clientCapabilities.TextDocument.CodeAction.CodeActionLiteralSupport == nil {
+		return true
+	}
+	return CodeActionOptionsValue{CodeActionKinds: []string{codeActionQuickFix, codeActionFixAll}}
+}
+
+// CodeAction offers fixes for the lint findings in the requested range of
+// a document: each suggested replacement, turning the rule off on that
+// line and allowing the matched text in the workspace. Misspelled words in
+// the range get their likely corrections. Either can be added to a word
+// list. Secrets can be redacted or added to the baseline. A fix-all
+// action, offered when asked for, applies every finding's replacement
+// where the rule suggests only one.
+func (s *Session) CodeAction(body *parse.LspBody) (interface{}, error) {
+	params := CodeActionParamsValue{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return nil, errors.Wrap(err, "decoding codeAction params")
+	}
+	snap, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok || snap.OutOfSync {
+		return s.codeActionResult(nil), nil
+	}
+
+	hits, _ := s.lintHits(snap)
+	var actions []CodeActionValue
+	if wantsKind(params.Context.Only, codeActionQuickFix) {
+		for _, hit := range hits {
+			if overlaps(hit.diagnostic.Range, params.Range) {
+				actions = append(actions, s.quickFixes(snap, hit)...)
+			}
+		}
+		dict, misspelled := s.spellHits(snap)
+		for _, hit := range misspelled {
+			if overlaps(hit.diagnostic.Range, params.Range) {
+				actions = append(actions, spellingFixes(snap, dict, hit)...)
+				actions = append(actions, s.dictionaryActions(snap.URI, hit.word.Text, hit.diagnostic)...)
+			}
+		}
+		for _, hit := range s.secretHits(snap) {
+			if overlaps(hit.diagnostic.Range, params.Range) {
+				actions = append(actions, s.secretFixes(snap, hit)...)
+			}
+		}
+	}
+	if wantsKind(params.Context.Only, codeActionFixAll) {
+		if action, ok := fixAll(snap, hits); ok {
+			actions = append(actions, action)
+		}
+	}
+	return s.codeActionResult(actions), nil
+}
+
+// quickFixes returns the fixes for one finding.
+func (s *Session) quickFixes(snap *document.Snapshot, hit lintHit) []CodeActionValue {
+	var actions []CodeActionValue
+	diagnostics := []DiagnosticValue{hit.diagnostic}
+	rule := hit.finding.Rule
+
+	replacements := hit.finding.Replacements()
+	for _, replacement := range replacements {
+		actions = append(actions, CodeActionValue{
+			Title:       fmt.Sprintf("Replace with %q", replacement),
+			Kind:        codeActionQuickFix,
+			Diagnostics: diagnostics,
+			IsPreferred: len(replacements) == 1,
+			Edit:        textEdit(snap.URI, hit.diagnostic.Range, replacement),
+		})
+	}
+
+	if directive, pos, ok := s.disableNextLine(snap, hit); ok {
+		actions = append(actions, CodeActionValue{
+			Title:       fmt.Sprintf("Suppress %q on this line", rule.Name()),
+			Kind:        codeActionQuickFix,
+			Diagnostics: diagnostics,
+			Edit:        textEdit(snap.URI, lsp.Range{Start: pos, End: pos}, directive),
+		})
+	}
+
+	if _, ok := s.folders.For(snap.URI); ok {
+		actions = append(actions, CodeActionValue{
+			Title:       fmt.Sprintf("Add %q to the workspace allowlist", hit.finding.Match),
+			Kind:        codeActionQuickFix,
+			Diagnostics: diagnostics,
+			Command: &lsp.Command{
+				Title:     fmt.Sprintf("Allow %q", hit.finding.Match),
+				Command:   commandAllowText,
+				Arguments: []interface{}{snap.URI, hit.finding.Match},
+			},
+		})
+	}
+	return append(actions, s.dictionaryActions(snap.URI, hit.finding.Match, hit.diagnostic)...)
+}
+
+// disableNextLine returns the directive that turns the rule of hit off,
+// indented like the line it is for, and where to insert it.
+func (s *Session) disableNextLine(snap *document.Snapshot, hit lintHit) (string, lsp.Position, bool) {
+	pos := lsp.Position{Line: hit.diagnostic.Range.Start.Line}
+	start, err := snap.OffsetAt(pos, s.Encoding())
+	if err != nil {
+		return "", pos, false
+	}
+	line := snap.Text()[start:]
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	eol := string(snap.LineEndings().Dominant())
+	return indent + lint.DirectiveDisableNextLine + " " + lint.QuoteName(hit.finding.Rule.Name()) + eol, pos, true
+}
+
+// fixAll returns the action that applies every safe fix in the document.
+// Of two fixes that overlap only the first is made.
+func fixAll(snap *document.Snapshot, hits []lintHit) (CodeActionValue, bool) {
+	var edits []lsp.TextEdit
+	var diagnostics []DiagnosticValue
+	end := 0
+	for _, hit := range hits {
+		replacement, ok := hit.finding.Fix()
+		if !ok || hit.finding.Start < end {
+			continue
+		}
+		end = hit.finding.End
+		edits = append(edits, lsp.TextEdit{Range: hit.diagnostic.Range, NewText: replacement})
+		diagnostics = append(diagnostics, hit.diagnostic)
+	}
+	if len(edits) == 0 {
+		return CodeActionValue{}, false
+	}
+	return CodeActionValue{
+		Title:       "Fix all lint findings",
+		Kind:        codeActionFixAll,
+		Diagnostics: diagnostics,
+		Edit:        &lsp.WorkspaceEdit{Changes: map[string][]lsp.TextEdit{string(snap.URI): edits}},
+	}, true
+}
+
+// codeActionResult shapes actions for the client: as code actions, marked
+// preferred only if it understands that, or as commands if it takes
+// nothing else.
+func (s *Session) codeActionResult(actions []CodeActionValue) interface{} {
+	s.mu.Lock()
+	caps := s.clientCapabilities.TextDocument.CodeAction
+	s.mu.Unlock()
+
+	if caps.CodeActionLiteralSupport != nil {
+		if actions == nil {
+			actions = []CodeActionValue{}
+		}
+		for i := range actions {
+			actions[i].IsPreferred = actions[i].IsPreferred && caps.IsPreferredSupport
+		}
+		return actions
+	}
+
+	commands := []lsp.Command{}
+	for _, action := range actions {
+		if action.Command != nil {
+			command := *action.Command
+			command.Title = action.Title
+			commands = append(commands, command)
+			continue
+		}
+		commands = append(commands, lsp.Command{
+			Title:     action.Title,
+			Command:   commandApplyEdit,
+			Arguments: []interface{}{action.Edit},
+		})
+	}
+	return commands
+}
+
+// allowText adds text to the allow list of the lint configuration of the
+// folder holding uri. An open configuration file is edited through the
+// client; otherwise the file is written, created if need be, and loaded.
+func (s *Session) allowText(uri lsp.DocumentURI, text string) error {
+	f, ok := s.folders.For(uri)
+	if !ok {
+		return errors.Errorf("%s is not in a workspace folder", uri)
+	}
+	path := filepath.Join(f.Path, lint.ConfigFile)
+	label := fmt.Sprintf("Allow %q", text)
+
+	config := docuri.FromPath(path)
+	if snap, open := s.documents.Get(config); open {
+		at, insert, err := lint.AllowEdit([]byte(snap.Text()), text)
+		if err != nil || insert == "" {
+			return err
+		}
+		rng, err := snap.RangeOf(at, at, s.Encoding())
+		if err != nil {
+			return err
+		}
+		return s.applyEdit(label, *textEdit(snap.URI, rng, insert))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "reading lint config")
+	}
+	data, err = lint.AllowText(data, text)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return errors.Wrap(err, "writing lint config")
+	}
+	s.files.Invalidate(config)
+	s.loadLintConfig(f)
+	return nil
+}
+
+func textEdit(uri lsp.DocumentURI, rng lsp.Range, text string) *lsp.WorkspaceEdit {
+	return &lsp.WorkspaceEdit{
+		Changes: map[string][]lsp.TextEdit{string(uri): {{Range: rng, NewText: text}}},
+	}
+}
+
+// wantsKind reports whether a code action of kind is asked for, given the
+// kinds the client asked for. Kinds are hierarchical, so asking for
+// "source" includes "source.fixAll.plaintext". Source actions act on the
+// whole document rather than the range, so they are only offered when
+// their kind is asked for.
+func wantsKind(only []string, kind string) bool {
+	if len(only) == 0 {
+		return !strings.HasPrefix(kind, codeActionSource+".")
+	}
+	for _, want := range only {
+		if kind == want || strings.HasPrefix(kind, want+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps reports whether two ranges share a position, counting their
+// ends, so a cursor just after a word still picks it.
+func overlaps(a, b lsp.Range) bool {
+	return !before(a.End, b.Start) && !before(b.End, a.Start)
+}
+
+func before(a, b lsp.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
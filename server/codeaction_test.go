@@ -0,0 +1,76 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lsp/server/docuri"
+	"lsp/server/lint"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeActionFixAllOnlyWhenAsked(t *testing.T) {
+	tests := []struct {
+		name string
+		only []string
+		want bool
+	}{
+		{name: "no kinds", only: nil, want: false},
+		{name: "quick fixes", only: []string{codeActionQuickFix}, want: false},
+		{name: "source actions", only: []string{codeActionSource}, want: true},
+		{name: "fix all", only: []string{"source.fixAll"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestSession(t)
+			ts.clientCapabilities.TextDocument.CodeAction.CodeActionLiteralSupport = &CodeActionLiteralSupportValue{}
+			f := ts.addFolder("")
+			config := "rules:\n  - term: qux\n    replacements: [quux]\n"
+			require.NoError(t, os.WriteFile(filepath.Join(f.Path, lint.ConfigFile), []byte(config), 0644))
+			ts.loadLintConfig(f)
+
+			uri := docuri.FromPath(filepath.Join(f.Path, "a.txt"))
+			ts.open(uri, "qux\n")
+			result, err := ts.CodeAction(ts.body("textDocument/codeAction", map[string]interface{}{
+				"textDocument": map[string]interface{}{"uri": uri},
+				"range":        lsp.Range{End: lsp.Position{Character: 3}},
+				"context":      map[string]interface{}{"diagnostics": []interface{}{}, "only": tt.only},
+			}))
+			require.NoError(t, err)
+
+			var got bool
+			for _, action := range result.([]CodeActionValue) {
+				got = got || action.Kind == codeActionFixAll
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAllowTextInOpenConfig(t *testing.T) {
+	ts := newTestSession(t)
+	ts.clientCapabilities.Workspace.ApplyEdit = true
+	f := ts.addFolder("")
+	config := docuri.FromPath(filepath.Join(f.Path, lint.ConfigFile))
+	ts.open(config, "# allowed\nallow:\n  - bar # for now\n")
+
+	require.NoError(t, ts.allowText(docuri.FromPath(filepath.Join(f.Path, "a.txt")), "foo"))
+
+	var edits []lsp.TextEdit
+	for _, m := range ts.messages() {
+		if m.Method == clientApplyEdit {
+			var params ApplyWorkspaceEditParamsValue
+			require.NoError(t, json.Unmarshal(m.Params, &params))
+			edits = params.Edit.Changes[string(config)]
+		}
+	}
+	// only the new item is sent, so the comments stay
+	require.Equal(t, []lsp.TextEdit{{
+		Range:   lsp.Range{Start: lsp.Position{Line: 3}, End: lsp.Position{Line: 3}},
+		NewText: "  - foo\n",
+	}}, edits)
+}
@@ -0,0 +1,224 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"log"
+
+	"lsp/server/parse"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+const clientApplyEdit = "workspace/applyEdit"
+
+const windowShowMessage = "window/showMessage"
+
+// commands lists the commands workspace/executeCommand accepts.
+var commands = []string{
+	commandConvertToUTF8LF,
+	commandApplyEdit,
+	commandAllowText,
+	commandAddToDictionary,
+	commandAcknowledgeSecret,
+}
+
+type ExecuteCommandOptionsValue struct {
+	Commands []string `json:"commands"`
+}
+
+type ApplyWorkspaceEditParamsValue struct {
+	Label string             `json:"label,omitempty"`
+	Edit  WorkspaceEditValue `json:"edit"`
+}
+
+// WorkspaceEditValue is lsp.WorkspaceEdit with the document changes it
+// lacks, which can create files as well as edit them. DocumentChanges
+// holds CreateFileValue and TextDocumentEditValue.
+type WorkspaceEditValue struct {
+	Changes         map[string][]lsp.TextEdit `json:"changes,omitempty"`
+	DocumentChanges []interface{}             `json:"documentChanges,omitempty"`
+}
+
+type CreateFileValue struct {
+	Kind    string                  `json:"kind"`
+	URI     lsp.DocumentURI         `json:"uri"`
+	Options *CreateFileOptionsValue `json:"options,omitempty"`
+}
+
+type CreateFileOptionsValue struct {
+	IgnoreIfExists bool `json:"ignoreIfExists,omitempty"`
+}
+
+type TextDocumentEditValue struct {
+	TextDocument OptionalVersionedTextDocumentIdentifierValue `json:"textDocument"`
+	Edits        []lsp.TextEdit                               `json:"edits"`
+}
+
+// OptionalVersionedTextDocumentIdentifierValue names a document at a
+// version, or as it is if Version is nil.
+type OptionalVersionedTextDocumentIdentifierValue struct {
+	URI     lsp.DocumentURI `json:"uri"`
+	Version *int            `json:"version"`
+}
+
+type ApplyWorkspaceEditResultValue struct {
+	Applied       bool   `json:"applied"`
+	FailureReason string `json:"failureReason,omitempty"`
+}
+
+// ExecuteCommand runs one of the commands listed in commands.
+func (s *Session) ExecuteCommand(body *parse.LspBody) (interface{}, error) {
+	params := lsp.ExecuteCommandParams{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return nil, errors.Wrap(err, "decoding executeCommand params")
+	}
+	switch params.Command {
+	case commandConvertToUTF8LF:
+		uri, err := uriArgument(params.Arguments)
+		if err != nil {
+			return nil, errors.Wrapf(err, "running %s", params.Command)
+		}
+		return nil, errors.Wrapf(s.convertToUTF8LF(uri), "running %s", params.Command)
+	case commandApplyEdit:
+		if len(params.Arguments) != 1 {
+			return nil, errors.Errorf("running %s: want 1 argument, got %d", params.Command, len(params.Arguments))
+		}
+		edit := lsp.WorkspaceEdit{}
+		if err := remarshal(params.Arguments[0], &edit); err != nil {
+			return nil, errors.Wrapf(err, "running %s", params.Command)
+		}
+		return nil, errors.Wrapf(s.applyEdit("Apply lint fix", edit), "running %s", params.Command)
+	case commandAllowText:
+		if len(params.Arguments) != 2 {
+			return nil, errors.Errorf("running %s: want 2 arguments, got %d", params.Command, len(params.Arguments))
+		}
+		uri, err := uriArgument(params.Arguments[:1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "running %s", params.Command)
+		}
+		text, ok := params.Arguments[1].(string)
+		if !ok {
+			return nil, errors.Errorf("running %s: want the text to allow, got %v", params.Command, params.Arguments[1])
+		}
+		return nil, errors.Wrapf(s.allowText(uri, text), "running %s", params.Command)
+	case commandAddToDictionary:
+		if len(params.Arguments) != 3 {
+			return nil, errors.Errorf("running %s: want 3 arguments, got %d", params.Command, len(params.Arguments))
+		}
+		uri, err := uriArgument(params.Arguments[:1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "running %s", params.Command)
+		}
+		word, ok := params.Arguments[1].(string)
+		if !ok {
+			return nil, errors.Errorf("running %s: want the word to add, got %v", params.Command, params.Arguments[1])
+		}
+		list, ok := params.Arguments[2].(string)
+		if !ok {
+			return nil, errors.Errorf("running %s: want the word list, got %v", params.Command, params.Arguments[2])
+		}
+		return nil, errors.Wrapf(s.addToDictionary(uri, word, list), "running %s", params.Command)
+	case commandAcknowledgeSecret:
+		if len(params.Arguments) != 3 {
+			return nil, errors.Errorf("running %s: want 3 arguments, got %d", params.Command, len(params.Arguments))
+		}
+		uri, err := uriArgument(params.Arguments[:1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "running %s", params.Command)
+		}
+		fingerprint, ok := params.Arguments[1].(string)
+		if !ok {
+			return nil, errors.Errorf("running %s: want the fingerprint of the secret, got %v", params.Command, params.Arguments[1])
+		}
+		code, ok := params.Arguments[2].(string)
+		if !ok {
+			return nil, errors.Errorf("running %s: want the code of the secret, got %v", params.Command, params.Arguments[2])
+		}
+		return nil, errors.Wrapf(s.acknowledgeSecret(uri, fingerprint, code), "running %s", params.Command)
+	}
+	return nil, errors.Errorf("unknown command %q", params.Command)
+}
+
+// uriArgument reads the document URI commands take as their only argument.
+func uriArgument(args []interface{}) (lsp.DocumentURI, error) {
+	if len(args) != 1 {
+		return "", errors.Errorf("want 1 argument, got %d", len(args))
+	}
+	uri, ok := args[0].(string)
+	if !ok {
+		return "", errors.Errorf("want a document URI, got %v", args[0])
+	}
+	return lsp.DocumentURI(uri), nil
+}
+
+// remarshal converts a decoded JSON argument to v.
+func remarshal(arg interface{}, v interface{}) error {
+	data, err := json.Marshal(arg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *Session) canApplyEdit() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clientCapabilities.Workspace.ApplyEdit
+}
+
+// canCreateFiles reports whether workspace edits sent to the client may
+// create files.
+func (s *Session) canCreateFiles() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	caps := s.clientCapabilities.Workspace.WorkspaceEdit
+	if !caps.DocumentChanges {
+		return false
+	}
+	for _, op := range caps.ResourceOperations {
+		if op == "create" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEdit asks the client to make edit, logging when it refuses.
+func (s *Session) applyEdit(label string, edit lsp.WorkspaceEdit) error {
+	return s.applyEditThen(label, edit, nil)
+}
+
+// applyEditThen is applyEdit, calling applied once the client has made the
+// edit.
+func (s *Session) applyEditThen(label string, edit lsp.WorkspaceEdit, applied func()) error {
+	return s.applyWorkspaceEditThen(label, WorkspaceEditValue{Changes: edit.Changes}, applied)
+}
+
+// applyWorkspaceEditThen is applyEditThen for edits that may change more
+// than the text of documents.
+func (s *Session) applyWorkspaceEditThen(label string, edit WorkspaceEditValue, applied func()) error {
+	if !s.canApplyEdit() {
+		return errors.New("client cannot apply workspace edits")
+	}
+	params := ApplyWorkspaceEditParamsValue{Label: label, Edit: edit}
+	return s.conn.Call(clientApplyEdit, params, func(raw json.RawMessage, err error) {
+		result := ApplyWorkspaceEditResultValue{}
+		if err == nil {
+			err = json.Unmarshal(raw, &result)
+		}
+		switch {
+		case err != nil:
+			log.Printf("applying %q: %v", label, err)
+		case !result.Applied:
+			log.Printf("client did not apply %q: %s", label, result.FailureReason)
+		case applied != nil:
+			applied()
+		}
+	})
+}
+
+// showMessage pops up a message in the client.
+func (s *Session) showMessage(typ lsp.MessageType, message string) error {
+	return s.conn.Notify(windowShowMessage, lsp.ShowMessageParams{Type: typ, Message: message})
+}
@@ -0,0 +1,113 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"lsp/server/parse"
+
+	"github.com/pkg/errors"
+)
+
+// Conn writes messages to the client. Responses, notifications and the
+// server's own requests are written from different goroutines, so every
+// write goes through one lock.
+type Conn struct {
+	mu      sync.Mutex
+	out     io.Writer
+	nextID  int
+	pending map[int]func(result json.RawMessage, err error)
+}
+
+func NewConn(out io.Writer) *Conn {
+	return &Conn{
+		out:     out,
+		pending: map[int]func(json.RawMessage, error){},
+	}
+}
+
+type notificationMessage struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type requestMessage struct {
+	Jsonrpc string `json:"jsonrpc"`
+	Id      int    `json:"id"`
+	Method  string `json:"method"`
+	// Params is left out of requests that take none.
+	Params interface{} `json:"params,omitempty"`
+}
+
+// Send frames msg with a Content-Length header and writes it.
+func (c *Conn) Send(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "marshaling message")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return errors.Wrap(err, "writing message header")
+	}
+	if _, err := c.out.Write(data); err != nil {
+		return errors.Wrap(err, "writing message body")
+	}
+	return nil
+}
+
+// Notify sends a notification to the client.
+func (c *Conn) Notify(method string, params interface{}) error {
+	return errors.Wrapf(c.Send(&notificationMessage{
+		Jsonrpc: "2.0",
+		Method:  method,
+		Params:  params,
+	}), "notifying %s", method)
+}
+
+// Call sends a request to the client. handle runs on the connection's read
+// loop once the response arrives, so it must not block.
+func (c *Conn) Call(method string, params interface{}, handle func(result json.RawMessage, err error)) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = handle
+	c.mu.Unlock()
+
+	err := c.Send(&requestMessage{
+		Jsonrpc: "2.0",
+		Id:      id,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return errors.Wrapf(err, "calling %s", method)
+	}
+	return nil
+}
+
+// HandleResponse routes a response from the client to the Call waiting on it.
+func (c *Conn) HandleResponse(body *parse.LspBody) {
+	c.mu.Lock()
+	handle, ok := c.pending[body.Id]
+	delete(c.pending, body.Id)
+	c.mu.Unlock()
+
+	if !ok {
+		log.Printf("response to unknown request %d", body.Id)
+		return
+	}
+	if body.Error != nil {
+		handle(nil, errors.Errorf("client error %d: %s", body.Error.Code, body.Error.Message))
+		return
+	}
+	handle(body.Result, nil)
+}
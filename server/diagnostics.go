@@ -0,0 +1,132 @@
+package tcpserver
+
+import (
+	"log"
+	"sort"
+
+	"lsp/server/document"
+	"lsp/server/docuri"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+const publishDiagnostics = "textDocument/publishDiagnostics"
+
+// DiagnosticValue is a diagnostic as the protocol has it since 3.16, which
+// can link to a description of its code.
+type DiagnosticValue struct {
+	Range           lsp.Range              `json:"range"`
+	Severity        lsp.DiagnosticSeverity `json:"severity,omitempty"`
+	Code            string                 `json:"code,omitempty"`
+	CodeDescription *CodeDescriptionValue  `json:"codeDescription,omitempty"`
+	Source          string                 `json:"source,omitempty"`
+	Message         string                 `json:"message"`
+}
+
+type CodeDescriptionValue struct {
+	Href string `json:"href"`
+}
+
+type PublishDiagnosticsParamsValue struct {
+	URI lsp.DocumentURI `json:"uri"`
+	// Version is the document version the diagnostics were computed for.
+	Version     *int              `json:"version,omitempty"`
+	Diagnostics []DiagnosticValue `json:"diagnostics"`
+}
+
+// PublishDiagnostics sends diagnostics computed from snap. They are dropped
+// if the document has changed, closed or drifted out of sync since, because
+// their ranges would point at the wrong text. Clients that pull
+// diagnostics are sent none.
+func (s *Session) PublishDiagnostics(snap *document.Snapshot, diagnostics []DiagnosticValue) error {
+	if s.pullsDiagnostics() {
+		return nil
+	}
+	cur, ok := s.documents.Get(snap.URI)
+	if !ok || cur.Version != snap.Version || cur.OutOfSync {
+		log.Printf("dropping stale diagnostics for %s version %d", snap.URI, snap.Version)
+		return nil
+	}
+	if diagnostics == nil {
+		diagnostics = []DiagnosticValue{}
+	}
+	version := snap.Version
+	return errors.Wrap(s.conn.Notify(publishDiagnostics, &PublishDiagnosticsParamsValue{
+		URI:         snap.URI,
+		Version:     &version,
+		Diagnostics: diagnostics,
+	}), "publishing diagnostics")
+}
+
+// diagnosticSet holds the diagnostics of one document version, by the
+// source that produced them.
+type diagnosticSet struct {
+	version  int
+	bySource map[string][]DiagnosticValue
+}
+
+// ReportDiagnostics replaces the diagnostics source produced for snap and
+// publishes them together with those of every other source. Diagnostics
+// kept from an older version are dropped, since their ranges may no longer
+// be right, and so are diagnostics for an older version that arrive late.
+func (s *Session) ReportDiagnostics(snap *document.Snapshot, source string, diagnostics []DiagnosticValue) error {
+	s.diagnosticsMu.Lock()
+	key := docuri.Normalize(snap.URI)
+	set, ok := s.diagnostics[key]
+	if ok && snap.Version < set.version {
+		s.diagnosticsMu.Unlock()
+		log.Printf("dropping stale %s diagnostics for %s version %d", source, snap.URI, snap.Version)
+		return nil
+	}
+	if !ok || set.version != snap.Version {
+		set = &diagnosticSet{version: snap.Version, bySource: map[string][]DiagnosticValue{}}
+		s.diagnostics[key] = set
+	}
+	set.bySource[source] = diagnostics
+
+	sources := make([]string, 0, len(set.bySource))
+	for source := range set.bySource {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	var all []DiagnosticValue
+	for _, source := range sources {
+		all = append(all, set.bySource[source]...)
+	}
+	s.diagnosticsMu.Unlock()
+
+	return s.PublishDiagnostics(snap, all)
+}
+
+// ClearDiagnostics removes every diagnostic the client shows for uri.
+func (s *Session) ClearDiagnostics(uri lsp.DocumentURI) error {
+	s.diagnosticsMu.Lock()
+	delete(s.diagnostics, docuri.Normalize(uri))
+	s.diagnosticsMu.Unlock()
+	if s.pullsDiagnostics() {
+		return nil
+	}
+
+	return errors.Wrap(s.conn.Notify(publishDiagnostics, &PublishDiagnosticsParamsValue{
+		URI:         uri,
+		Diagnostics: []DiagnosticValue{},
+	}), "clearing diagnostics")
+}
+
+// publishFileDiagnostics publishes diagnostics for a file that is not open,
+// so there is no document version to tie them to. Clients that pull
+// diagnostics are asked to pull them again instead.
+func (s *Session) publishFileDiagnostics(uri lsp.DocumentURI, diagnostics []DiagnosticValue) error {
+	if s.pullsDiagnostics() {
+		s.refreshDiagnostics()
+		return nil
+	}
+	if diagnostics == nil {
+		diagnostics = []DiagnosticValue{}
+	}
+	return errors.Wrap(s.conn.Notify(publishDiagnostics, &PublishDiagnosticsParamsValue{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	}), "publishing diagnostics")
+}
@@ -0,0 +1,17 @@
+package tcpserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClearDiagnosticsNormalizesURI(t *testing.T) {
+	ts := newTestSession(t)
+	ts.open("file:///tmp/%61%20b.txt", "text\n")
+	require.Len(t, ts.diagnostics, 1)
+
+	// the client may escape the URI another way when it closes the document
+	require.NoError(t, ts.ClearDiagnostics("file:///tmp/a b.txt"))
+	require.Empty(t, ts.diagnostics)
+}
@@ -0,0 +1,107 @@
+package document
+
+// LineEnding is the sequence that ends a line.
+type LineEnding string
+
+const (
+	LF   LineEnding = "\n"
+	CRLF LineEnding = "\r\n"
+	CR   LineEnding = "\r"
+)
+
+func (e LineEnding) String() string {
+	switch e {
+	case LF:
+		return "LF"
+	case CRLF:
+		return "CRLF"
+	case CR:
+		return "CR"
+	}
+	return "none"
+}
+
+// LineBreak is one line ending in a text, at byte offset Offset.
+type LineBreak struct {
+	Offset int
+	Ending LineEnding
+}
+
+// LineEndings counts the line endings of a text.
+type LineEndings struct {
+	LF   int
+	CRLF int
+	CR   int
+}
+
+// DetectLineEndings counts the line endings in text.
+func DetectLineEndings(text string) LineEndings {
+	var counts LineEndings
+	for _, br := range LineBreaks(text) {
+		switch br.Ending {
+		case LF:
+			counts.LF++
+		case CRLF:
+			counts.CRLF++
+		case CR:
+			counts.CR++
+		}
+	}
+	return counts
+}
+
+// LineBreaks returns every line ending in text, in order.
+func LineBreaks(text string) []LineBreak {
+	var breaks []LineBreak
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			breaks = append(breaks, LineBreak{Offset: i, Ending: LF})
+		case '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				breaks = append(breaks, LineBreak{Offset: i, Ending: CRLF})
+				i++
+			} else {
+				breaks = append(breaks, LineBreak{Offset: i, Ending: CR})
+			}
+		}
+	}
+	return breaks
+}
+
+// Mixed reports whether more than one kind of line ending is used.
+func (l LineEndings) Mixed() bool {
+	kinds := 0
+	for _, n := range []int{l.LF, l.CRLF, l.CR} {
+		if n > 0 {
+			kinds++
+		}
+	}
+	return kinds > 1
+}
+
+// Dominant returns the most used line ending, preferring LF, then CRLF, on
+// a tie. A text without line breaks is taken to use LF.
+func (l LineEndings) Dominant() LineEnding {
+	switch {
+	case l.CRLF > l.LF && l.CRLF >= l.CR:
+		return CRLF
+	case l.CR > l.LF && l.CR > l.CRLF:
+		return CR
+	}
+	return LF
+}
+
+// NormalizeLineEndings replaces every line ending in text with ending.
+func NormalizeLineEndings(text string, ending LineEnding) string {
+	breaks := LineBreaks(text)
+	out := make([]byte, 0, len(text))
+	last := 0
+	for _, br := range breaks {
+		out = append(out, text[last:br.Offset]...)
+		out = append(out, ending...)
+		last = br.Offset + len(br.Ending)
+	}
+	out = append(out, text[last:]...)
+	return string(out)
+}
@@ -0,0 +1,55 @@
+package document
+
+import (
+	"testing"
+
+	"lsp/server/position"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineEndings(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		want     LineEndings
+		mixed    bool
+		dominant LineEnding
+		lf       string
+	}{
+		{name: "empty", text: "", dominant: LF},
+		{name: "lf", text: "a\nb\n", want: LineEndings{LF: 2}, dominant: LF, lf: "a\nb\n"},
+		{name: "crlf", text: "a\r\nb\r\n", want: LineEndings{CRLF: 2}, dominant: CRLF, lf: "a\nb\n"},
+		{name: "lone cr", text: "a\rb", want: LineEndings{CR: 1}, dominant: CR, lf: "a\nb"},
+		{name: "mixed", text: "a\r\nb\nc\r\n", want: LineEndings{LF: 1, CRLF: 2}, mixed: true, dominant: CRLF, lf: "a\nb\nc\n"},
+		{name: "tie prefers lf", text: "a\r\nb\n", want: LineEndings{LF: 1, CRLF: 1}, mixed: true, dominant: LF, lf: "a\nb\n"},
+		{name: "cr then crlf", text: "\r\r\n", want: LineEndings{CR: 1, CRLF: 1}, mixed: true, dominant: CRLF, lf: "\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectLineEndings(tt.text)
+			require.Equal(t, tt.want, got)
+			require.Equal(t, tt.mixed, got.Mixed())
+			require.Equal(t, tt.dominant, got.Dominant())
+			require.Equal(t, tt.lf, NormalizeLineEndings(tt.text, LF))
+		})
+	}
+}
+
+func TestSnapshotBOM(t *testing.T) {
+	store := NewStore()
+	snap, err := store.Open(lsp.TextDocumentItem{URI: testURI, Text: "\ufeffa\r\nb"})
+	require.NoError(t, err)
+	require.True(t, snap.HasBOM())
+	require.Equal(t, LineEndings{CRLF: 1}, snap.LineEndings())
+
+	pos, err := snap.PositionAt(len("\ufeffa"), position.UTF16)
+	require.NoError(t, err)
+	require.Equal(t, lsp.Position{Line: 0, Character: 2}, pos)
+
+	require.NoError(t, store.Close(testURI))
+	snap, err = store.Open(lsp.TextDocumentItem{URI: testURI, Text: "a"})
+	require.NoError(t, err)
+	require.False(t, snap.HasBOM())
+}
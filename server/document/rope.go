@@ -0,0 +1,362 @@
+package document
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"lsp/server/position"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// maxLeaf is the largest chunk of text kept in a single leaf. Small enough
+// that copying a leaf on every keystroke is cheap, large enough that the
+// tree stays shallow for documents of tens of megabytes.
+const maxLeaf = 1024
+
+// Rope is an immutable, height-balanced tree of text chunks. Edits return a
+// new rope sharing every untouched subtree with the old one, which makes a
+// snapshot of a document as cheap as copying a pointer.
+//
+// Every node caches its byte length and its number of line breaks, where a
+// break is \n, \r\n or a lone \r, matching the position package.
+type Rope struct {
+	root *node
+}
+
+type node struct {
+	left, right *node
+	leaf        string
+
+	length int
+	height int
+	// breaks counts line breaks inside the subtree. A trailing \r is
+	// counted even though a \n may follow in a neighbouring subtree; the
+	// parent corrects for that with straddles.
+	breaks int
+	first  byte
+	last   byte
+}
+
+// NewRope builds a balanced rope holding text.
+func NewRope(text string) *Rope {
+	return &Rope{root: build(text)}
+}
+
+func build(text string) *node {
+	if text == "" {
+		return nil
+	}
+	if len(text) <= maxLeaf {
+		return newLeaf(text)
+	}
+	mid := len(text) / 2
+	// never split a \r\n pair between leaves
+	if text[mid-1] == '\r' && text[mid] == '\n' {
+		mid++
+	}
+	return concat(build(text[:mid]), build(text[mid:]))
+}
+
+func newLeaf(text string) *node {
+	n := &node{
+		leaf:   text,
+		length: len(text),
+		first:  text[0],
+		last:   text[len(text)-1],
+	}
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			n.breaks++
+		case '\r':
+			if i+1 == len(text) || text[i+1] != '\n' {
+				n.breaks++
+			}
+		}
+	}
+	return n
+}
+
+func concat(l, r *node) *node {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	h := l.height
+	if r.height > h {
+		h = r.height
+	}
+	return &node{
+		left:   l,
+		right:  r,
+		length: l.length + r.length,
+		height: h + 1,
+		breaks: l.breaks + r.breaks - straddles(l, r),
+		first:  l.first,
+		last:   r.last,
+	}
+}
+
+// straddles reports whether a \r\n pair is split between l and r, in which
+// case both sides counted it as a break.
+func straddles(l, r *node) int {
+	if l.last == '\r' && r.first == '\n' {
+		return 1
+	}
+	return 0
+}
+
+func height(n *node) int {
+	if n == nil {
+		return -1
+	}
+	return n.height
+}
+
+// join concatenates two balanced trees into a balanced tree.
+func join(l, r *node) *node {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	if l.left == nil && r.left == nil && l.length+r.length <= maxLeaf {
+		return newLeaf(l.leaf + r.leaf)
+	}
+	switch {
+	case l.height > r.height+1:
+		return balance(l.left, join(l.right, r))
+	case r.height > l.height+1:
+		return balance(join(l, r.left), r.right)
+	}
+	return concat(l, r)
+}
+
+func balance(l, r *node) *node {
+	switch {
+	case height(l) > height(r)+1:
+		if height(l.left) >= height(l.right) {
+			return concat(l.left, concat(l.right, r))
+		}
+		return concat(concat(l.left, l.right.left), concat(l.right.right, r))
+	case height(r) > height(l)+1:
+		if height(r.right) >= height(r.left) {
+			return concat(concat(l, r.left), r.right)
+		}
+		return concat(concat(l, r.left.left), concat(r.left.right, r.right))
+	}
+	return concat(l, r)
+}
+
+// split divides n into the bytes before offset and the bytes from offset on.
+func split(n *node, offset int) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+	if offset <= 0 {
+		return nil, n
+	}
+	if offset >= n.length {
+		return n, nil
+	}
+	if n.left == nil {
+		return newLeaf(n.leaf[:offset]), newLeaf(n.leaf[offset:])
+	}
+	if offset <= n.left.length {
+		a, b := split(n.left, offset)
+		return a, join(b, n.right)
+	}
+	a, b := split(n.right, offset-n.left.length)
+	return join(n.left, a), b
+}
+
+// Len returns the length of the text in bytes.
+func (r *Rope) Len() int {
+	if r.root == nil {
+		return 0
+	}
+	return r.root.length
+}
+
+// LineCount returns the number of lines, which is one more than the number
+// of line breaks.
+func (r *Rope) LineCount() int {
+	if r.root == nil {
+		return 1
+	}
+	return r.root.breaks + 1
+}
+
+// Replace returns a new rope with the bytes in [start, end) replaced by text.
+func (r *Rope) Replace(start, end int, text string) (*Rope, error) {
+	if start < 0 || end < start || end > r.Len() {
+		return nil, errors.Errorf("replace range [%d, %d) out of bounds [0, %d)", start, end, r.Len())
+	}
+	before, rest := split(r.root, start)
+	_, after := split(rest, end-start)
+	return &Rope{root: join(join(before, build(text)), after)}, nil
+}
+
+// String flattens the rope.
+func (r *Rope) String() string {
+	var b strings.Builder
+	b.Grow(r.Len())
+	write(&b, r.root, 0, r.Len())
+	return b.String()
+}
+
+// Slice returns the bytes in [start, end).
+func (r *Rope) Slice(start, end int) (string, error) {
+	if start < 0 || end < start || end > r.Len() {
+		return "", errors.Errorf("slice [%d, %d) out of bounds [0, %d)", start, end, r.Len())
+	}
+	var b strings.Builder
+	b.Grow(end - start)
+	write(&b, r.root, start, end)
+	return b.String(), nil
+}
+
+func write(b *strings.Builder, n *node, start, end int) {
+	if n == nil || start >= end {
+		return
+	}
+	if n.left == nil {
+		b.WriteString(n.leaf[start:end])
+		return
+	}
+	if start < n.left.length {
+		e := end
+		if e > n.left.length {
+			e = n.left.length
+		}
+		write(b, n.left, start, e)
+	}
+	if end > n.left.length {
+		s := start - n.left.length
+		if s < 0 {
+			s = 0
+		}
+		write(b, n.right, s, end-n.left.length)
+	}
+}
+
+// LineStart returns the byte offset at which line (zero based) begins.
+func (r *Rope) LineStart(line int) (int, error) {
+	if line < 0 || line >= r.LineCount() {
+		return 0, errors.Errorf("line %d out of range [0, %d)", line, r.LineCount())
+	}
+	if line == 0 {
+		return 0, nil
+	}
+	return breakEnd(r.root, line), nil
+}
+
+// breakEnd returns the offset just past the k-th (one based) line break.
+func breakEnd(n *node, k int) int {
+	if n.left == nil {
+		seen := 0
+		for i := 0; i < len(n.leaf); i++ {
+			c := n.leaf[i]
+			if c == '\n' || (c == '\r' && (i+1 == len(n.leaf) || n.leaf[i+1] != '\n')) {
+				seen++
+				if seen == k {
+					return i + 1
+				}
+			}
+		}
+		return n.length
+	}
+	leftBreaks := n.left.breaks - straddles(n.left, n.right)
+	if k <= leftBreaks {
+		return breakEnd(n.left, k)
+	}
+	return n.left.length + breakEnd(n.right, k-leftBreaks)
+}
+
+// lineOf returns the number of line breaks that end at or before offset,
+// which is the zero based line offset sits on.
+func lineOf(n *node, offset int) int {
+	if n == nil || offset <= 0 {
+		return 0
+	}
+	if n.left == nil {
+		seen := 0
+		for i := 0; i < offset && i < len(n.leaf); i++ {
+			c := n.leaf[i]
+			if c == '\n' || (c == '\r' && (i+1 == len(n.leaf) || n.leaf[i+1] != '\n')) {
+				seen++
+			}
+		}
+		return seen
+	}
+	s := straddles(n.left, n.right)
+	if offset < n.left.length {
+		return lineOf(n.left, offset)
+	}
+	if offset == n.left.length {
+		// between the halves of a split \r\n the break has not ended yet
+		return n.left.breaks - s
+	}
+	return n.left.breaks - s + lineOf(n.right, offset-n.left.length)
+}
+
+// lineBounds returns the span of line, including its terminator.
+func (r *Rope) lineBounds(line int) (start, end int, err error) {
+	start, err = r.LineStart(line)
+	if err != nil {
+		return 0, 0, err
+	}
+	end = r.Len()
+	if line+1 < r.LineCount() {
+		end = breakEnd(r.root, line+1)
+	}
+	return start, end, nil
+}
+
+// OffsetAt converts pos into a byte offset, with the same clamping rules as
+// position.ToOffset.
+func (r *Rope) OffsetAt(pos lsp.Position, enc position.Encoding) (int, error) {
+	if pos.Character < 0 {
+		return 0, errors.Errorf("negative character %d", pos.Character)
+	}
+	start, end, err := r.lineBounds(pos.Line)
+	if err != nil {
+		return 0, errors.Wrap(err, "locating line")
+	}
+	line, err := r.Slice(start, end)
+	if err != nil {
+		return 0, err
+	}
+	return start + position.ColumnToByte(line, pos.Character, enc), nil
+}
+
+// PositionAt converts a byte offset into a position.
+func (r *Rope) PositionAt(offset int, enc position.Encoding) (lsp.Position, error) {
+	if offset < 0 || offset > r.Len() {
+		return lsp.Position{}, errors.Errorf("offset %d out of range [0, %d]", offset, r.Len())
+	}
+	line := lineOf(r.root, offset)
+	start, err := r.LineStart(line)
+	if err != nil {
+		return lsp.Position{}, err
+	}
+	// read a little past offset so that an offset inside a multi-byte rune
+	// is recognised as such rather than decoded as invalid bytes
+	end := offset + utf8.UTFMax
+	if end > r.Len() {
+		end = r.Len()
+	}
+	prefix, err := r.Slice(start, end)
+	if err != nil {
+		return lsp.Position{}, err
+	}
+	return lsp.Position{
+		Line:      line,
+		Character: position.ByteToColumn(prefix, offset-start, enc),
+	}, nil
+}
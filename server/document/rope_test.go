@@ -0,0 +1,164 @@
+package document
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"lsp/server/position"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRopeMatchesString(t *testing.T) {
+	pieces := []string{"a", "bc", "\n", "\r\n", "\r", "😀", "漢", "é", strings.Repeat("x", 700)}
+	rnd := rand.New(rand.NewSource(1))
+	text := ""
+	rope := NewRope(text)
+
+	for i := 0; i < 2000; i++ {
+		start := 0
+		if len(text) > 0 {
+			start = rnd.Intn(len(text) + 1)
+		}
+		end := start + rnd.Intn(len(text)-start+1)/4
+		insert := ""
+		for n := rnd.Intn(4); n > 0; n-- {
+			insert += pieces[rnd.Intn(len(pieces))]
+		}
+
+		next, err := rope.Replace(start, end, insert)
+		require.NoError(t, err)
+		prev, prevText := rope, text
+		rope, text = next, text[:start]+insert+text[end:]
+
+		// the old rope is a snapshot and must not see the edit
+		require.Equal(t, prevText, prev.String())
+		require.Equal(t, text, rope.String())
+		require.Equal(t, len(text), rope.Len())
+
+		offset := rnd.Intn(len(text) + 1)
+		want, err := position.FromOffset(text, offset, position.UTF16)
+		require.NoError(t, err)
+		got, err := rope.PositionAt(offset, position.UTF16)
+		require.NoError(t, err)
+		require.Equal(t, want, got, "offset %d in %q", offset, text)
+
+		wantOffset, err := position.ToOffset(text, want, position.UTF16)
+		require.NoError(t, err)
+		gotOffset, err := rope.OffsetAt(want, position.UTF16)
+		require.NoError(t, err)
+		require.Equal(t, wantOffset, gotOffset)
+	}
+}
+
+func TestRopeLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		lines int
+		pos   lsp.Position
+		want  int
+	}{
+		{name: "empty", text: "", lines: 1, pos: lsp.Position{Line: 0, Character: 0}, want: 0},
+		{name: "lf", text: "a\nb\n", lines: 3, pos: lsp.Position{Line: 1, Character: 1}, want: 3},
+		{name: "crlf", text: "a\r\nb\r\n", lines: 3, pos: lsp.Position{Line: 2, Character: 0}, want: 6},
+		{name: "lone cr", text: "a\rb", lines: 2, pos: lsp.Position{Line: 1, Character: 1}, want: 3},
+		{name: "clamps to line end", text: "ab\r\ncd", lines: 2, pos: lsp.Position{Line: 0, Character: 9}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rope := NewRope(tt.text)
+			require.Equal(t, tt.lines, rope.LineCount())
+			got, err := rope.OffsetAt(tt.pos, position.UTF16)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRopeSplitCRLF(t *testing.T) {
+	// build two ropes so that the \r and \n end up in different leaves
+	rope, err := NewRope(strings.Repeat("a", maxLeaf)+"\r").Replace(maxLeaf+1, maxLeaf+1, strings.Repeat("\nb", maxLeaf))
+	require.NoError(t, err)
+	require.Equal(t, maxLeaf+1, rope.LineCount())
+
+	pos, err := rope.PositionAt(maxLeaf+1, position.UTF16)
+	require.NoError(t, err)
+	require.Equal(t, lsp.Position{Line: 0, Character: maxLeaf + 1}, pos)
+
+	pos, err = rope.PositionAt(maxLeaf+2, position.UTF16)
+	require.NoError(t, err)
+	require.Equal(t, lsp.Position{Line: 1, Character: 0}, pos)
+}
+
+// largeDocument is about 20MB of log-like lines.
+func largeDocument() string {
+	line := "2021-11-22 11:21:09 handling textDocument/didChange for file:///var/log/app.log\n"
+	return strings.Repeat(line, 20<<20/len(line))
+}
+
+func BenchmarkKeystrokeRope(b *testing.B) {
+	rope := NewRope(largeDocument())
+	lines := rope.LineCount()
+	rnd := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pos := lsp.Position{Line: rnd.Intn(lines), Character: 10}
+		offset, err := rope.OffsetAt(pos, position.UTF16)
+		if err != nil {
+			b.Fatal(err)
+		}
+		rope, err = rope.Replace(offset, offset, "x")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkKeystrokeString(b *testing.B) {
+	text := largeDocument()
+	lines := strings.Count(text, "\n")
+	rnd := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pos := lsp.Position{Line: rnd.Intn(lines), Character: 10}
+		offset, err := position.ToOffset(text, pos, position.UTF16)
+		if err != nil {
+			b.Fatal(err)
+		}
+		text = text[:offset] + "x" + text[offset:]
+	}
+}
+
+func BenchmarkPositionAtRope(b *testing.B) {
+	rope := NewRope(largeDocument())
+	rnd := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rope.PositionAt(rnd.Intn(rope.Len()), position.UTF16); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPositionAtString(b *testing.B) {
+	text := largeDocument()
+	rnd := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := position.FromOffset(text, rnd.Intn(len(text)), position.UTF16); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSnapshotRope(b *testing.B) {
+	rope := NewRope(largeDocument())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		snap := newSnapshot(testURI, "plaintext", i, rope)
+		_ = snap.Rope().Len()
+	}
+}
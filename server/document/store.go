@@ -0,0 +1,290 @@
+// Package document keeps the server's copy of every document the client has
+// open, kept in sync through textDocument/didOpen, didChange and didClose.
+package document
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	"lsp/server/docuri"
+	"lsp/server/position"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// bom is U+FEFF encoded as UTF-8.
+const bom = "\ufeff"
+
+var (
+	ErrNotOpen      = errors.New("document not open")
+	ErrAlreadyOpen  = errors.New("document already open")
+	ErrStaleVersion = errors.New("stale document version")
+)
+
+// Snapshot is an immutable view of a document at one version. Features
+// should take a snapshot once and work from it, so that concurrent edits
+// can never hand them a half-applied text.
+type Snapshot struct {
+	URI        lsp.DocumentURI
+	LanguageID string
+	Version    int
+	// Gap is set when this version did not directly follow the previous
+	// one, which means a change may have been missed.
+	Gap bool
+	// OutOfSync is set once the text is known to differ from the client's
+	// copy. It clears on the next full-text sync.
+	OutOfSync bool
+	rope      *Rope
+
+	flatten sync.Once
+	text    string
+	digest  sync.Once
+	hash    string
+	endings sync.Once
+	lines   LineEndings
+}
+
+func newSnapshot(uri lsp.DocumentURI, languageID string, version int, rope *Rope) *Snapshot {
+	return &Snapshot{
+		URI:        uri,
+		LanguageID: languageID,
+		Version:    version,
+		rope:       rope,
+	}
+}
+
+// NewSnapshot returns a snapshot of text that is not open in the editor,
+// such as a file read from disk, so it can be checked like an open
+// document.
+func NewSnapshot(uri lsp.DocumentURI, languageID string, version int, text string) *Snapshot {
+	return newSnapshot(uri, languageID, version, NewRope(text))
+}
+
+// Text returns the full content of the document at this version. The rope
+// is flattened on first use and the result kept for later callers.
+func (s *Snapshot) Text() string {
+	s.flatten.Do(func() {
+		s.text = s.rope.String()
+	})
+	return s.text
+}
+
+// Hash returns the hex encoded SHA-256 of the text, computed on first use.
+func (s *Snapshot) Hash() string {
+	s.digest.Do(func() {
+		sum := sha256.Sum256([]byte(s.Text()))
+		s.hash = hex.EncodeToString(sum[:])
+	})
+	return s.hash
+}
+
+// OnDisk reports whether the document is backed by a file on disk, rather
+// than being an untitled buffer or another virtual document.
+func (s *Snapshot) OnDisk() bool {
+	return docuri.OnDisk(s.URI)
+}
+
+// LineEndings counts the line endings of the text, on first use.
+func (s *Snapshot) LineEndings() LineEndings {
+	s.endings.Do(func() {
+		s.lines = DetectLineEndings(s.Text())
+	})
+	return s.lines
+}
+
+// HasBOM reports whether the text starts with a byte order mark. Clients
+// usually strip it, but one that does not counts it as a character on the
+// first line, and so do positions computed from this snapshot.
+func (s *Snapshot) HasBOM() bool {
+	prefix, err := s.rope.Slice(0, len(bom))
+	return err == nil && prefix == bom
+}
+
+// Rope returns the text of the document at this version as a rope, for
+// callers that only need part of a large document.
+func (s *Snapshot) Rope() *Rope {
+	return s.rope
+}
+
+// OffsetAt converts pos into a byte offset in the text.
+func (s *Snapshot) OffsetAt(pos lsp.Position, enc position.Encoding) (int, error) {
+	return s.rope.OffsetAt(pos, enc)
+}
+
+// PositionAt converts a byte offset in the text into a position.
+func (s *Snapshot) PositionAt(offset int, enc position.Encoding) (lsp.Position, error) {
+	return s.rope.PositionAt(offset, enc)
+}
+
+// RangeOf converts a byte span of the text into a range.
+func (s *Snapshot) RangeOf(start, end int, enc position.Encoding) (lsp.Range, error) {
+	startPos, err := s.rope.PositionAt(start, enc)
+	if err != nil {
+		return lsp.Range{}, errors.Wrap(err, "converting range start")
+	}
+	endPos, err := s.rope.PositionAt(end, enc)
+	if err != nil {
+		return lsp.Range{}, errors.Wrap(err, "converting range end")
+	}
+	return lsp.Range{Start: startPos, End: endPos}, nil
+}
+
+// Store is a concurrency-safe set of open documents keyed by URI. Lookups
+// compare canonical URIs, so a document is found however its URI was
+// escaped, while snapshots keep the URI the client opened it with.
+type Store struct {
+	mu   sync.RWMutex
+	docs map[lsp.DocumentURI]*Snapshot
+}
+
+func NewStore() *Store {
+	return &Store{
+		docs: map[lsp.DocumentURI]*Snapshot{},
+	}
+}
+
+// Open starts tracking a document.
+func (s *Store) Open(item lsp.TextDocumentItem) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.docs[key(item.URI)]; ok {
+		return nil, errors.Wrapf(ErrAlreadyOpen, "opening %s", item.URI)
+	}
+	snap := newSnapshot(item.URI, item.LanguageID, item.Version, NewRope(item.Text))
+	s.docs[key(item.URI)] = snap
+	return snap, nil
+}
+
+// Change applies content changes in order and moves the document to the
+// given version. Either every change applies or the document is left as it
+// was. Versions must increase; one that skips ahead is applied but flagged
+// as a Gap for the caller to verify. A full-text change brings an out of
+// sync document back in sync.
+func (s *Store) Change(id lsp.VersionedTextDocumentIdentifier, changes []lsp.TextDocumentContentChangeEvent, enc position.Encoding) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, ok := s.docs[key(id.URI)]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotOpen, "changing %s", id.URI)
+	}
+	if id.Version <= cur.Version {
+		return nil, errors.Wrapf(ErrStaleVersion, "changing %s: have version %d, got %d", id.URI, cur.Version, id.Version)
+	}
+
+	gap := id.Version != cur.Version+1
+	outOfSync := cur.OutOfSync
+	rope := cur.rope
+	for i, change := range changes {
+		if change.Range == nil {
+			// the client sent everything, so nothing before this matters
+			gap, outOfSync = false, false
+		}
+		var err error
+		rope, err = applyChange(rope, change, enc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "applying change %d to %s", i, id.URI)
+		}
+	}
+
+	snap := newSnapshot(cur.URI, cur.LanguageID, id.Version, rope)
+	snap.Gap = gap
+	snap.OutOfSync = outOfSync
+	s.docs[key(id.URI)] = snap
+	return snap, nil
+}
+
+// MarkOutOfSync flags the document as differing from the client's copy, as
+// long as it is still at version.
+func (s *Store) MarkOutOfSync(uri lsp.DocumentURI, version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, ok := s.docs[key(uri)]
+	if !ok || cur.Version != version || cur.OutOfSync {
+		return
+	}
+	snap := newSnapshot(cur.URI, cur.LanguageID, cur.Version, cur.rope)
+	snap.OutOfSync = true
+	s.docs[key(uri)] = snap
+}
+
+// Resync replaces the text of a document with a full copy from the client.
+// A copy older than what the store already has is ignored.
+func (s *Store) Resync(uri lsp.DocumentURI, version int, text string) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, ok := s.docs[key(uri)]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotOpen, "resyncing %s", uri)
+	}
+	if version < cur.Version {
+		return nil, errors.Wrapf(ErrStaleVersion, "resyncing %s: have version %d, got %d", uri, cur.Version, version)
+	}
+	snap := newSnapshot(cur.URI, cur.LanguageID, version, NewRope(text))
+	s.docs[key(uri)] = snap
+	return snap, nil
+}
+
+func key(uri lsp.DocumentURI) lsp.DocumentURI {
+	return docuri.Normalize(uri)
+}
+
+func applyChange(rope *Rope, change lsp.TextDocumentContentChangeEvent, enc position.Encoding) (*Rope, error) {
+	if change.Range == nil {
+		return NewRope(change.Text), nil
+	}
+	start, err := rope.OffsetAt(change.Range.Start, enc)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving change start")
+	}
+	end, err := rope.OffsetAt(change.Range.End, enc)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving change end")
+	}
+	if end < start {
+		return nil, errors.Errorf("change end %d before start %d", end, start)
+	}
+	return rope.Replace(start, end, change.Text)
+}
+
+// Close stops tracking a document.
+func (s *Store) Close(uri lsp.DocumentURI) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.docs[key(uri)]; !ok {
+		return errors.Wrapf(ErrNotOpen, "closing %s", uri)
+	}
+	delete(s.docs, key(uri))
+	return nil
+}
+
+// Get returns the latest snapshot of an open document.
+func (s *Store) Get(uri lsp.DocumentURI) (*Snapshot, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap, ok := s.docs[key(uri)]
+	return snap, ok
+}
+
+// All returns the latest snapshot of every open document, ordered by URI.
+func (s *Store) All() []*Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snaps := make([]*Snapshot, 0, len(s.docs))
+	for _, snap := range s.docs {
+		snaps = append(snaps, snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].URI < snaps[j].URI
+	})
+	return snaps
+}
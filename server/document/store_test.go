@@ -0,0 +1,195 @@
+package document
+
+import (
+	"sync"
+	"testing"
+
+	"lsp/server/position"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+const testURI = lsp.DocumentURI("file:///notes.txt")
+
+func rng(sl, sc, el, ec int) *lsp.Range {
+	return &lsp.Range{
+		Start: lsp.Position{Line: sl, Character: sc},
+		End:   lsp.Position{Line: el, Character: ec},
+	}
+}
+
+func TestStoreChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		changes []lsp.TextDocumentContentChangeEvent
+		want    string
+	}{
+		{
+			name: "insert",
+			text: "hello world",
+			changes: []lsp.TextDocumentContentChangeEvent{
+				{Range: rng(0, 5, 0, 5), Text: ","},
+			},
+			want: "hello, world",
+		},
+		{
+			name: "changes apply in order",
+			text: "one\ntwo\n",
+			changes: []lsp.TextDocumentContentChangeEvent{
+				{Range: rng(1, 0, 1, 3), Text: "2"},
+				{Range: rng(0, 0, 0, 3), Text: "1"},
+				{Range: rng(1, 1, 1, 1), Text: "!"},
+			},
+			want: "1\n2!\n",
+		},
+		{
+			name: "delete across lines after emoji",
+			text: "😀 a\nb\nc",
+			changes: []lsp.TextDocumentContentChangeEvent{
+				{Range: rng(0, 3, 2, 0), Text: ""},
+			},
+			want: "😀 c",
+		},
+		{
+			name: "full replace",
+			text: "old",
+			changes: []lsp.TextDocumentContentChangeEvent{
+				{Text: "new"},
+			},
+			want: "new",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore()
+			_, err := store.Open(lsp.TextDocumentItem{URI: testURI, LanguageID: "plaintext", Version: 1, Text: tt.text})
+			require.NoError(t, err)
+
+			id := lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: testURI}, Version: 2}
+			snap, err := store.Change(id, tt.changes, position.UTF16)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, snap.Text())
+			require.Equal(t, 2, snap.Version)
+			require.Equal(t, "plaintext", snap.LanguageID)
+		})
+	}
+}
+
+func TestStoreRejects(t *testing.T) {
+	store := NewStore()
+	_, err := store.Open(lsp.TextDocumentItem{URI: testURI, Version: 3, Text: "abc"})
+	require.NoError(t, err)
+
+	_, err = store.Open(lsp.TextDocumentItem{URI: testURI, Version: 3, Text: "abc"})
+	require.Equal(t, ErrAlreadyOpen, errors.Cause(err))
+
+	stale := lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: testURI}, Version: 3}
+	_, err = store.Change(stale, []lsp.TextDocumentContentChangeEvent{{Text: "x"}}, position.UTF16)
+	require.Equal(t, ErrStaleVersion, errors.Cause(err))
+
+	bad := lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: testURI}, Version: 4}
+	_, err = store.Change(bad, []lsp.TextDocumentContentChangeEvent{
+		{Range: rng(0, 0, 0, 1), Text: "z"},
+		{Range: rng(5, 0, 5, 1), Text: "z"},
+	}, position.UTF16)
+	require.Error(t, err)
+
+	snap, ok := store.Get(testURI)
+	require.True(t, ok)
+	require.Equal(t, "abc", snap.Text())
+	require.Equal(t, 3, snap.Version)
+
+	require.NoError(t, store.Close(testURI))
+	require.Equal(t, ErrNotOpen, errors.Cause(store.Close(testURI)))
+}
+
+func TestStoreCanonicalURIs(t *testing.T) {
+	store := NewStore()
+	_, err := store.Open(lsp.TextDocumentItem{URI: "file:///C:/My%20Notes/a.txt", Text: "a"})
+	require.NoError(t, err)
+
+	snap, ok := store.Get("file:///c%3A/My Notes/a.txt")
+	require.True(t, ok)
+	require.Equal(t, lsp.DocumentURI("file:///C:/My%20Notes/a.txt"), snap.URI)
+	require.True(t, snap.OnDisk())
+
+	_, err = store.Open(lsp.TextDocumentItem{URI: "untitled:Untitled-1", Text: "b"})
+	require.NoError(t, err)
+	snap, ok = store.Get("untitled:Untitled-1")
+	require.True(t, ok)
+	require.False(t, snap.OnDisk())
+	require.Len(t, store.All(), 2)
+}
+
+func TestStoreConcurrentReaders(t *testing.T) {
+	store := NewStore()
+	_, err := store.Open(lsp.TextDocumentItem{URI: testURI, Version: 0, Text: ""})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for v := 1; v <= 200; v++ {
+			id := lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: testURI}, Version: v}
+			if _, err := store.Change(id, []lsp.TextDocumentContentChangeEvent{{Range: rng(0, v-1, 0, v-1), Text: "x"}}, position.UTF16); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		snap, ok := store.Get(testURI)
+		require.True(t, ok)
+		require.Len(t, snap.Text(), snap.Version)
+	}
+	wg.Wait()
+}
+
+func TestStoreGapAndResync(t *testing.T) {
+	store := NewStore()
+	_, err := store.Open(lsp.TextDocumentItem{URI: testURI, Version: 1, Text: "abc"})
+	require.NoError(t, err)
+
+	versioned := func(v int) lsp.VersionedTextDocumentIdentifier {
+		return lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: testURI}, Version: v}
+	}
+
+	snap, err := store.Change(versioned(2), []lsp.TextDocumentContentChangeEvent{{Range: rng(0, 3, 0, 3), Text: "d"}}, position.UTF16)
+	require.NoError(t, err)
+	require.False(t, snap.Gap)
+
+	// version 3 went missing
+	snap, err = store.Change(versioned(4), []lsp.TextDocumentContentChangeEvent{{Range: rng(0, 4, 0, 4), Text: "f"}}, position.UTF16)
+	require.NoError(t, err)
+	require.True(t, snap.Gap)
+
+	store.MarkOutOfSync(testURI, 4)
+	snap, ok := store.Get(testURI)
+	require.True(t, ok)
+	require.True(t, snap.OutOfSync)
+
+	// out of sync survives further ranged edits
+	snap, err = store.Change(versioned(5), []lsp.TextDocumentContentChangeEvent{{Range: rng(0, 0, 0, 0), Text: ">"}}, position.UTF16)
+	require.NoError(t, err)
+	require.True(t, snap.OutOfSync)
+
+	_, err = store.Resync(testURI, 4, "old")
+	require.Equal(t, ErrStaleVersion, errors.Cause(err))
+
+	snap, err = store.Resync(testURI, 5, ">abcdef")
+	require.NoError(t, err)
+	require.False(t, snap.OutOfSync)
+	require.Equal(t, ">abcdef", snap.Text())
+	require.Equal(t, "85105b685737d2087cd392da90e9ab2f0e6366fad6598788228ef1886de3ea1a", snap.Hash())
+
+	// a full-text change also clears the flag
+	store.MarkOutOfSync(testURI, 5)
+	snap, err = store.Change(versioned(9), []lsp.TextDocumentContentChangeEvent{{Text: "fresh"}}, position.UTF16)
+	require.NoError(t, err)
+	require.False(t, snap.OutOfSync)
+	require.False(t, snap.Gap)
+}
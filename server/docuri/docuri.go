@@ -0,0 +1,252 @@
+// Package docuri parses, compares and normalizes the document URIs clients
+// send. Documents are not always files: untitled buffers, git revisions
+// and notebook cells all have URIs of their own, and only file URIs name
+// something on disk.
+package docuri
+
+import (
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+const (
+	SchemeFile         = "file"
+	SchemeUntitled     = "untitled"
+	SchemeGit          = "git"
+	SchemeNotebookCell = "vscode-notebook-cell"
+)
+
+// URI is a parsed document URI. Its components are held decoded.
+type URI struct {
+	Scheme    string
+	Authority string
+	Path      string
+	Query     string
+	Fragment  string
+}
+
+// syntax splits a URI into its components, as in RFC 3986 appendix B.
+var syntax = regexp.MustCompile(`^(([^:/?#]+):)?(//([^/?#]*))?([^?#]*)(\?([^#]*))?(#(.*))?$`)
+
+// Parse splits s into its components and decodes them. Escapes that are
+// not valid are kept as they are rather than rejected, as editors are not
+// always strict about them.
+func Parse(s string) (URI, error) {
+	m := syntax.FindStringSubmatch(s)
+	if m == nil || m[2] == "" {
+		return URI{}, errors.Errorf("%q is not a URI: no scheme", s)
+	}
+	u := URI{
+		Scheme:    strings.ToLower(m[2]),
+		Authority: unescape(m[4]),
+		Path:      unescape(m[5]),
+		Query:     unescape(m[7]),
+		Fragment:  unescape(m[9]),
+	}
+	if u.Scheme == SchemeFile {
+		u.Authority = strings.ToLower(u.Authority)
+		if u.Authority == "localhost" {
+			u.Authority = ""
+		}
+		u.Path = lowerDrive(u.Path)
+	}
+	return u, nil
+}
+
+// File returns the file URI of the path on disk.
+func File(path string) URI {
+	path = filepath.ToSlash(path)
+	u := URI{Scheme: SchemeFile}
+	if strings.HasPrefix(path, "//") {
+		// a UNC path \\server\share\file
+		rest := path[2:]
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			u.Authority, path = rest[:i], rest[i:]
+		} else {
+			u.Authority, path = rest, "/"
+		}
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	u.Path = lowerDrive(path)
+	return u
+}
+
+// String returns the canonical form of u. Two URIs for the same document
+// have the same canonical form however they were escaped.
+func (u URI) String() string {
+	var b strings.Builder
+	b.WriteString(u.Scheme)
+	b.WriteByte(':')
+	if u.Authority != "" || u.Scheme == SchemeFile {
+		b.WriteString("//")
+		b.WriteString(escape(u.Authority, "@:"))
+	}
+	b.WriteString(escape(u.Path, "/"))
+	if u.Query != "" {
+		b.WriteByte('?')
+		b.WriteString(escape(u.Query, ""))
+	}
+	if u.Fragment != "" {
+		b.WriteByte('#')
+		b.WriteString(escape(u.Fragment, ""))
+	}
+	return b.String()
+}
+
+// DocumentURI returns the canonical form of u as an lsp.DocumentURI.
+func (u URI) DocumentURI() lsp.DocumentURI {
+	return lsp.DocumentURI(u.String())
+}
+
+// OnDisk reports whether u names a file on disk. Only file URIs do;
+// untitled buffers, git revisions and notebook cells exist only in the
+// editor.
+func (u URI) OnDisk() bool {
+	return u.Scheme == SchemeFile
+}
+
+// IsUntitled reports whether u is a buffer that was never saved.
+func (u URI) IsUntitled() bool {
+	return u.Scheme == SchemeUntitled
+}
+
+// Filename returns the path on disk of a file URI.
+func (u URI) Filename() (string, error) {
+	if !u.OnDisk() {
+		return "", errors.Errorf("%s is not a file URI", u)
+	}
+	path := u.Path
+	if u.Authority != "" {
+		path = "//" + u.Authority + path
+	} else if runtime.GOOS == "windows" && hasDrive(path) {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// Notebook returns the URI of the notebook file a notebook cell belongs to.
+func (u URI) Notebook() (URI, bool) {
+	if u.Scheme != SchemeNotebookCell {
+		return URI{}, false
+	}
+	return URI{Scheme: SchemeFile, Authority: u.Authority, Path: u.Path}, true
+}
+
+// Normalize returns the canonical form of uri, or uri itself if it cannot
+// be parsed.
+func Normalize(uri lsp.DocumentURI) lsp.DocumentURI {
+	u, err := Parse(string(uri))
+	if err != nil {
+		return uri
+	}
+	return u.DocumentURI()
+}
+
+// Equal reports whether a and b are the same document.
+func Equal(a, b lsp.DocumentURI) bool {
+	return Normalize(a) == Normalize(b)
+}
+
+// OnDisk reports whether uri names a file on disk.
+func OnDisk(uri lsp.DocumentURI) bool {
+	u, err := Parse(string(uri))
+	return err == nil && u.OnDisk()
+}
+
+// Filename returns the path on disk of a file URI.
+func Filename(uri lsp.DocumentURI) (string, error) {
+	u, err := Parse(string(uri))
+	if err != nil {
+		return "", err
+	}
+	return u.Filename()
+}
+
+// FromPath returns the canonical file URI of the path on disk.
+func FromPath(path string) lsp.DocumentURI {
+	return File(path).DocumentURI()
+}
+
+// hasDrive reports whether path starts with a Windows drive, as in /c:/.
+func hasDrive(path string) bool {
+	return len(path) >= 3 && path[0] == '/' && path[2] == ':' && isLetter(path[1]) &&
+		(len(path) == 3 || path[3] == '/')
+}
+
+// lowerDrive lowercases the drive letter of a Windows path, which is
+// written in either case.
+func lowerDrive(path string) string {
+	if hasDrive(path) {
+		return "/" + strings.ToLower(path[1:2]) + path[2:]
+	}
+	if len(path) >= 2 && path[1] == ':' && isLetter(path[0]) {
+		// C:/x without the leading slash
+		return "/" + strings.ToLower(path[:1]) + path[1:]
+	}
+	return path
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// unescape decodes percent escapes, keeping any that are malformed.
+func unescape(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// escape percent-encodes everything but the unreserved characters and
+// those in keep. This matches how VS Code writes URIs, so canonical URIs
+// sent to it look like the ones it sent.
+func escape(s string, keep string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUnreserved(c) || strings.IndexByte(keep, c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return isLetter(c) || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
@@ -0,0 +1,131 @@
+package docuri
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		want   URI
+		canon  string
+		onDisk bool
+	}{
+		{
+			name:   "file",
+			in:     "file:///home/me/notes.txt",
+			want:   URI{Scheme: "file", Path: "/home/me/notes.txt"},
+			canon:  "file:///home/me/notes.txt",
+			onDisk: true,
+		},
+		{
+			name:   "escaped space",
+			in:     "file:///home/me/my%20notes.txt",
+			want:   URI{Scheme: "file", Path: "/home/me/my notes.txt"},
+			canon:  "file:///home/me/my%20notes.txt",
+			onDisk: true,
+		},
+		{
+			name:   "drive letter",
+			in:     "file:///C:/Users/me/a.txt",
+			want:   URI{Scheme: "file", Path: "/c:/Users/me/a.txt"},
+			canon:  "file:///c%3A/Users/me/a.txt",
+			onDisk: true,
+		},
+		{
+			name:   "escaped drive letter",
+			in:     "FILE:///c%3a/Users/me/a.txt",
+			want:   URI{Scheme: "file", Path: "/c:/Users/me/a.txt"},
+			canon:  "file:///c%3A/Users/me/a.txt",
+			onDisk: true,
+		},
+		{
+			name:   "unc",
+			in:     "file://Server/share/a.txt",
+			want:   URI{Scheme: "file", Authority: "server", Path: "/share/a.txt"},
+			canon:  "file://server/share/a.txt",
+			onDisk: true,
+		},
+		{
+			name:   "localhost",
+			in:     "file://localhost/etc/hosts",
+			want:   URI{Scheme: "file", Path: "/etc/hosts"},
+			canon:  "file:///etc/hosts",
+			onDisk: true,
+		},
+		{
+			name:  "untitled",
+			in:    "untitled:Untitled-1",
+			want:  URI{Scheme: "untitled", Path: "Untitled-1"},
+			canon: "untitled:Untitled-1",
+		},
+		{
+			name:  "git",
+			in:    "git:/repo/a.txt?%7B%22path%22%3A%22%2Frepo%2Fa.txt%22%2C%22ref%22%3A%22HEAD%22%7D",
+			want:  URI{Scheme: "git", Path: "/repo/a.txt", Query: `{"path":"/repo/a.txt","ref":"HEAD"}`},
+			canon: "git:/repo/a.txt?%7B%22path%22%3A%22%2Frepo%2Fa.txt%22%2C%22ref%22%3A%22HEAD%22%7D",
+		},
+		{
+			name:  "notebook cell",
+			in:    "vscode-notebook-cell:/repo/nb.ipynb#W0sZmlsZQ%3D%3D",
+			want:  URI{Scheme: "vscode-notebook-cell", Path: "/repo/nb.ipynb", Fragment: "W0sZmlsZQ=="},
+			canon: "vscode-notebook-cell:/repo/nb.ipynb#W0sZmlsZQ%3D%3D",
+		},
+		{
+			name:   "malformed escape kept",
+			in:     "file:///a%zz%4",
+			want:   URI{Scheme: "file", Path: "/a%zz%4"},
+			canon:  "file:///a%25zz%254",
+			onDisk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+			require.Equal(t, tt.canon, got.String())
+			require.Equal(t, tt.onDisk, got.OnDisk())
+
+			// the canonical form is a fixed point
+			again, err := Parse(got.String())
+			require.NoError(t, err)
+			require.Equal(t, got, again)
+		})
+	}
+
+	_, err := Parse("/no/scheme")
+	require.Error(t, err)
+}
+
+func TestEqual(t *testing.T) {
+	require.True(t, Equal("file:///C%3A/a%20b.txt", "file:///c:/a b.txt"))
+	require.True(t, Equal("file:///tmp/%61.txt", "file:///tmp/a.txt"))
+	require.False(t, Equal("file:///tmp/a.txt", "file:///tmp/A.txt"))
+	require.False(t, Equal("untitled:a.txt", "file:///a.txt"))
+	require.Equal(t, lsp.DocumentURI("not a uri"), Normalize("not a uri"))
+}
+
+func TestFilename(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("paths below are unix paths")
+	}
+	path, err := Filename("file:///home/me/my%20notes.txt")
+	require.NoError(t, err)
+	require.Equal(t, "/home/me/my notes.txt", path)
+	require.Equal(t, lsp.DocumentURI("file:///home/me/my%20notes.txt"), FromPath(path))
+
+	_, err = Filename("untitled:Untitled-1")
+	require.Error(t, err)
+
+	nb, ok := URI{Scheme: SchemeNotebookCell, Path: "/repo/nb.ipynb", Fragment: "x"}.Notebook()
+	require.True(t, ok)
+	require.Equal(t, "file:///repo/nb.ipynb", nb.String())
+	require.True(t, File("//server/share/a.txt") == URI{Scheme: SchemeFile, Authority: "server", Path: "/share/a.txt"})
+	require.Equal(t, "file:///c%3A/x", File("C:/x").String())
+}
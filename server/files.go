@@ -0,0 +1,160 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"log"
+
+	"lsp/server/docuri"
+	"lsp/server/parse"
+	"lsp/server/watch"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+const clientRegisterCapability = "client/registerCapability"
+
+const workspaceDidChangeWatchedFiles = "workspace/didChangeWatchedFiles"
+
+type RegistrationParamsValue struct {
+	Registrations []RegistrationValue `json:"registrations"`
+}
+
+type RegistrationValue struct {
+	ID              string      `json:"id"`
+	Method          string      `json:"method"`
+	RegisterOptions interface{} `json:"registerOptions,omitempty"`
+}
+
+type DidChangeWatchedFilesRegistrationOptionsValue struct {
+	Watchers []FileSystemWatcherValue `json:"watchers"`
+}
+
+type FileSystemWatcherValue struct {
+	GlobPattern string `json:"globPattern"`
+}
+
+// OnFileChange registers fn to be called for every file created, changed or
+// deleted in the workspace, whether the client or the server's own watcher
+// noticed it.
+func (s *Session) OnFileChange(fn func(uri lsp.DocumentURI, change lsp.FileChangeType)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fileListeners = append(s.fileListeners, fn)
+}
+
+// Initialized fetches the settings of every workspace folder and starts
+// watching the workspace for changes made outside the editor: through the
+// client when it can register watchers dynamically, or with a watcher of
+// our own when it cannot. Our own watcher walks the whole workspace, which
+// is done in the background.
+func (s *Session) Initialized(body *parse.LspBody) error {
+	for _, f := range s.folders.All() {
+		s.fetchSettings(f)
+		s.loadLintConfig(f)
+	}
+
+	s.mu.Lock()
+	dynamic := s.clientCapabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration
+	s.mu.Unlock()
+
+	if !dynamic {
+		go s.watchFilesInBackground()
+		return nil
+	}
+	params := RegistrationParamsValue{
+		Registrations: []RegistrationValue{{
+			ID:     workspaceDidChangeWatchedFiles,
+			Method: workspaceDidChangeWatchedFiles,
+			RegisterOptions: DidChangeWatchedFilesRegistrationOptionsValue{
+				Watchers: []FileSystemWatcherValue{{GlobPattern: "**/*"}},
+			},
+		}},
+	}
+	return s.conn.Call(clientRegisterCapability, params, func(_ json.RawMessage, err error) {
+		if err == nil {
+			return
+		}
+		log.Printf("registering file watchers: %v; watching files ourselves", err)
+		go s.watchFilesInBackground()
+	})
+}
+
+// DidChangeWatchedFiles handles the changes the client's watchers report.
+func (s *Session) DidChangeWatchedFiles(body *parse.LspBody) error {
+	params := lsp.DidChangeWatchedFilesParams{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return errors.Wrap(err, "decoding didChangeWatchedFiles params")
+	}
+	for _, change := range params.Changes {
+		s.fileChanged(change.URI, lsp.FileChangeType(change.Type))
+	}
+	return nil
+}
+
+// watchFilesInBackground starts watching files, reporting the walk of the
+// workspace to the client as it goes. Requests are served meanwhile, so it
+// must not run on the read loop.
+func (s *Session) watchFilesInBackground() {
+	work := s.beginWork("Watching workspace files")
+	err := s.watchFiles(work)
+	if err != nil {
+		log.Printf("watching files: %v", err)
+		work.end("failed to watch workspace files")
+		return
+	}
+	work.end("")
+}
+
+// watchFiles starts a watcher on every workspace root, reporting each to
+// work.
+func (s *Session) watchFiles(work *workDone) error {
+	w, err := watch.New(func(e watch.Event) {
+		s.fileChanged(docuri.FromPath(e.Path), lsp.FileChangeType(e.Op))
+	}, s.files.Excluded)
+	if err != nil {
+		return errors.Wrap(err, "starting file watcher")
+	}
+
+	s.mu.Lock()
+	if s.watcher != nil {
+		s.mu.Unlock()
+		w.Close()
+		return nil
+	}
+	s.watcher = w
+	s.mu.Unlock()
+
+	for _, root := range s.files.Roots() {
+		work.report(root)
+		if err := w.Add(root); err != nil {
+			return errors.Wrap(err, "watching workspace")
+		}
+		log.Printf("watching %s for changes", root)
+	}
+	return nil
+}
+
+// fileChanged drops what is cached about the file at uri and tells the
+// listeners. Diagnostics for a deleted file that is not open are cleared,
+// since nothing will ever update them again.
+func (s *Session) fileChanged(uri lsp.DocumentURI, change lsp.FileChangeType) {
+	s.files.Invalidate(uri)
+	s.folderFileChanged(uri, change)
+	s.diagnosticsMayChange(uri)
+	if change == lsp.Deleted {
+		if _, open := s.documents.Get(uri); !open {
+			if err := s.ClearDiagnostics(uri); err != nil {
+				log.Printf("file %s deleted: %v", uri, err)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	listeners := make([]func(lsp.DocumentURI, lsp.FileChangeType), len(s.fileListeners))
+	copy(listeners, s.fileListeners)
+	s.mu.Unlock()
+	for _, fn := range listeners {
+		fn(uri, change)
+	}
+}
@@ -0,0 +1,76 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"lsp/server/parse"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitializedWatchesInBackground(t *testing.T) {
+	ts := newTestSession(t)
+	ts.clientCapabilities.Window.WorkDoneProgress = true
+	f := ts.addFolder("")
+
+	// the walk waits for the client to accept its progress token, which it
+	// has not yet, so Initialized returning shows it does not wait for the
+	// walk
+	require.NoError(t, ts.Initialized(ts.body("initialized", struct{}{})))
+
+	var create testMessage
+	require.Eventually(t, func() bool {
+		for _, m := range ts.messages() {
+			if m.Method == windowWorkDoneProgressCreate {
+				create = m
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	var params WorkDoneProgressCreateParamsValue
+	require.NoError(t, json.Unmarshal(create.Params, &params))
+	ts.Conn().HandleResponse(&parse.LspBody{Jsonrpc: "2.0", Id: *create.ID, Result: json.RawMessage("null")})
+
+	var kinds []string
+	require.Eventually(t, func() bool {
+		kinds = nil
+		for _, m := range ts.messages() {
+			if m.Method != progress {
+				continue
+			}
+			var p struct {
+				Token string                `json:"token"`
+				Value WorkDoneProgressValue `json:"value"`
+			}
+			require.NoError(t, json.Unmarshal(m.Params, &p))
+			require.Equal(t, params.Token, p.Token)
+			kinds = append(kinds, p.Value.Kind)
+		}
+		return len(kinds) > 0 && kinds[len(kinds)-1] == workDoneEnd
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{workDoneBegin, workDoneReport, workDoneEnd}, kinds)
+
+	ts.mu.Lock()
+	watching := ts.watcher != nil
+	ts.mu.Unlock()
+	require.True(t, watching, "watching %s", f.Path)
+}
+
+func TestInitializedWithoutProgress(t *testing.T) {
+	ts := newTestSession(t)
+	ts.addFolder("")
+
+	require.NoError(t, ts.Initialized(ts.body("initialized", struct{}{})))
+	require.Eventually(t, func() bool {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		return ts.watcher != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	for _, m := range ts.messages() {
+		require.NotEqual(t, progress, m.Method)
+		require.NotEqual(t, windowWorkDoneProgressCreate, m.Method)
+	}
+}
@@ -0,0 +1,238 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+
+	"lsp/server/docuri"
+	"lsp/server/lint"
+	"lsp/server/parse"
+	"lsp/server/workspace"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+const clientConfiguration = "workspace/configuration"
+
+// settingsSection is the part of the client's settings this server reads.
+const settingsSection = "plaintext"
+
+type WorkspaceFolderValue struct {
+	URI  lsp.DocumentURI `json:"uri"`
+	Name string          `json:"name"`
+}
+
+type DidChangeWorkspaceFoldersParamsValue struct {
+	Event WorkspaceFoldersChangeEventValue `json:"event"`
+}
+
+type WorkspaceFoldersChangeEventValue struct {
+	Added   []WorkspaceFolderValue `json:"added"`
+	Removed []WorkspaceFolderValue `json:"removed"`
+}
+
+// Folders returns the workspace folders the client has open.
+func (s *Session) Folders() *workspace.Set {
+	return s.folders
+}
+
+// DidChangeWorkspaceFolders indexes added folders and releases removed ones.
+func (s *Session) DidChangeWorkspaceFolders(body *parse.LspBody) error {
+	params := DidChangeWorkspaceFoldersParamsValue{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return errors.Wrap(err, "decoding didChangeWorkspaceFolders params")
+	}
+	for _, folder := range params.Event.Removed {
+		s.removeFolder(folder.URI)
+	}
+	for _, folder := range params.Event.Added {
+		f, err := s.addFolder(folder.URI, folder.Name)
+		if err != nil {
+			log.Printf("adding workspace folder: %v", err)
+			continue
+		}
+		s.fetchSettings(f)
+		s.loadLintConfig(f)
+	}
+	return nil
+}
+
+// DidChangeConfiguration refreshes the settings of every folder. Clients
+// that support workspace/configuration are asked for each folder's own
+// settings; otherwise the pushed settings apply to all of them.
+func (s *Session) DidChangeConfiguration(body *parse.LspBody) error {
+	if s.canConfigure() {
+		for _, f := range s.folders.All() {
+			s.fetchSettings(f)
+		}
+		return nil
+	}
+
+	params := struct {
+		Settings map[string]json.RawMessage `json:"settings"`
+	}{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return errors.Wrap(err, "decoding didChangeConfiguration params")
+	}
+	for _, f := range s.folders.All() {
+		f.SetSettings(params.Settings[settingsSection])
+		s.relint(f)
+	}
+	return nil
+}
+
+// addFolder starts tracking the folder at uri and indexes it in the
+// background. Settings are not fetched, since during initialize the server
+// may not send requests yet.
+func (s *Session) addFolder(uri lsp.DocumentURI, name string) (*workspace.Folder, error) {
+	f, err := workspace.NewFolder(uri, name)
+	if err != nil {
+		return nil, err
+	}
+	if !s.folders.Add(f) {
+		return f, nil
+	}
+	s.files.AddRoot(f.Path)
+
+	s.mu.Lock()
+	w := s.watcher
+	s.mu.Unlock()
+	if w != nil {
+		if err := w.Add(f.Path); err != nil {
+			log.Printf("watching %s: %v", f.Path, err)
+		}
+	}
+
+	log.Printf("added workspace folder %s at %s", f.Name, f.Path)
+	s.reindex(f)
+	return f, nil
+}
+
+// removeFolder stops tracking the folder at uri and drops everything held
+// for it.
+func (s *Session) removeFolder(uri lsp.DocumentURI) {
+	f, ok := s.folders.Remove(uri)
+	if !ok {
+		log.Printf("removing unknown workspace folder %s", uri)
+		return
+	}
+	s.files.RemoveRoot(f.Path)
+
+	s.mu.Lock()
+	w := s.watcher
+	s.mu.Unlock()
+	if w != nil {
+		w.Remove(f.Path)
+	}
+
+	for _, g := range s.folders.All() {
+		if w != nil && (f.Contains(g.URI) || g.Contains(f.URI)) {
+			// watches are per directory, so those of nested and enclosing
+			// folders went with it
+			if err := w.Add(g.Path); err != nil {
+				log.Printf("watching %s: %v", g.Path, err)
+			}
+		}
+	}
+	s.mu.Lock()
+	delete(s.linters, f.Path)
+	s.mu.Unlock()
+	config := docuri.FromPath(filepath.Join(f.Path, lint.ConfigFile))
+	if _, open := s.documents.Get(config); !open {
+		if err := s.ClearDiagnostics(config); err != nil {
+			log.Printf("removing workspace folder: %v", err)
+		}
+	}
+	s.relint(f)
+
+	log.Printf("removed workspace folder %s", f.Name)
+	s.reindex(f)
+}
+
+// reindex indexes f, if it is still in the workspace, along with every
+// folder around it, whose share of the files changes with f.
+func (s *Session) reindex(f *workspace.Folder) {
+	for _, g := range s.folders.All() {
+		if g != f && !g.Contains(f.URI) {
+			continue
+		}
+		go func(g *workspace.Folder) {
+			err := g.Index(s.files, func(uri lsp.DocumentURI) bool {
+				owner, ok := s.folders.For(uri)
+				return !ok || owner != g
+			})
+			if err != nil {
+				log.Printf("indexing workspace folder: %v", err)
+				return
+			}
+			log.Printf("indexed %d files in %s", len(g.Files()), g.Name)
+			s.diagnosticsMayChange()
+		}(g)
+	}
+}
+
+func (s *Session) canConfigure() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clientCapabilities.Workspace.Configuration
+}
+
+// fetchSettings asks the client for the settings that apply to f.
+func (s *Session) fetchSettings(f *workspace.Folder) {
+	if !s.canConfigure() {
+		return
+	}
+	params := lsp.ConfigurationParams{
+		Items: []lsp.ConfigurationItem{{ScopeURI: string(f.URI), Section: settingsSection}},
+	}
+	err := s.conn.Call(clientConfiguration, params, func(raw json.RawMessage, err error) {
+		if err != nil {
+			log.Printf("fetching settings of %s: %v", f.Name, err)
+			return
+		}
+		var result []json.RawMessage
+		if err := json.Unmarshal(raw, &result); err != nil || len(result) != 1 {
+			log.Printf("fetching settings of %s: unexpected result %s", f.Name, raw)
+			return
+		}
+		f.SetSettings(result[0])
+		// settings decide whether lint plugins run
+		s.relint(f)
+	})
+	if err != nil {
+		log.Printf("fetching settings of %s: %v", f.Name, err)
+	}
+}
+
+// initialFolders returns the folders named in the initialize params,
+// falling back to the root URI for clients without workspace folders.
+func initialFolders(params InitializeParamsValue, root lsp.DocumentURI) []WorkspaceFolderValue {
+	if len(params.WorkspaceFolders) > 0 {
+		return params.WorkspaceFolders
+	}
+	if root == "" || root == "file://" {
+		return nil
+	}
+	return []WorkspaceFolderValue{{URI: root}}
+}
+
+// folderFileChanged keeps the index of the folder holding uri current.
+func (s *Session) folderFileChanged(uri lsp.DocumentURI, change lsp.FileChangeType) {
+	f, ok := s.folders.For(uri)
+	if !ok {
+		return
+	}
+	if change == lsp.Created {
+		path, err := docuri.Filename(uri)
+		if err != nil {
+			return
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() || s.files.Excluded(path, false) {
+			return
+		}
+	}
+	f.FileChanged(uri, change)
+}
@@ -0,0 +1,132 @@
+package tcpserver
+
+import (
+	"fmt"
+	"log"
+
+	"lsp/server/document"
+	"lsp/server/docuri"
+	"lsp/server/overlay"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// commandConvertToUTF8LF rewrites a document with LF line endings and, for
+// files on disk, in UTF-8. It takes the document URI as its argument.
+const commandConvertToUTF8LF = "plaintext.convertToUTF8LF"
+
+// diagnosticSource is the source shown with every diagnostic the server
+// reports.
+const diagnosticSource = "plaintext"
+
+const (
+	codeMixedLineEndings = "mixed-line-endings"
+	codeLegacyEncoding   = "legacy-encoding"
+)
+
+// maxLineEndingDiagnostics bounds how many lines of a document with mixed
+// line endings are flagged, so a file that mixes them throughout does not
+// flood the client.
+const maxLineEndingDiagnostics = 100
+
+// checkFormat reports line endings that differ from the ones most of the
+// document uses, and files stored in an encoding other than UTF-8.
+func (s *Session) checkFormat(snap *document.Snapshot) []DiagnosticValue {
+	var diagnostics []DiagnosticValue
+
+	endings := snap.LineEndings()
+	if endings.Mixed() {
+		dominant := endings.Dominant()
+		for _, br := range document.LineBreaks(snap.Text()) {
+			if br.Ending == dominant {
+				continue
+			}
+			if len(diagnostics) == maxLineEndingDiagnostics {
+				break
+			}
+			rng, err := snap.RangeOf(br.Offset, br.Offset+len(br.Ending), s.Encoding())
+			if err != nil {
+				log.Printf("checking line endings of %s: %v", snap.URI, err)
+				break
+			}
+			diagnostics = append(diagnostics, DiagnosticValue{
+				Range:    rng,
+				Severity: lsp.Warning,
+				Code:     codeMixedLineEndings,
+				Source:   diagnosticSource,
+				Message:  fmt.Sprintf("line ends with %s but most lines end with %s", br.Ending, dominant),
+			})
+		}
+	}
+
+	if !snap.OnDisk() {
+		return diagnostics
+	}
+	if file, err := s.files.ReadDisk(snap.URI); err == nil && !file.Encoding.IsUTF8() {
+		diagnostics = append(diagnostics, DiagnosticValue{
+			Severity: lsp.Information,
+			Code:     codeLegacyEncoding,
+			Source:   diagnosticSource,
+			Message:  fmt.Sprintf("file is stored as %s rather than UTF-8", file.Encoding),
+		})
+	}
+	return diagnostics
+}
+
+// convertToUTF8LF changes every line ending of the document at uri to LF.
+// An open document is changed through the client, which owns its buffer
+// and so also the encoding it is saved in; a file that is not open is
+// rewritten on disk as UTF-8, keeping a byte order mark if it had one.
+func (s *Session) convertToUTF8LF(uri lsp.DocumentURI) error {
+	snap, open := s.documents.Get(uri)
+	if !open {
+		if !docuri.OnDisk(uri) {
+			return errors.Errorf("%s is neither open nor a file", uri)
+		}
+		file, err := s.files.ReadDisk(uri)
+		if err != nil {
+			return err
+		}
+		enc := overlay.UTF8
+		if file.Encoding == overlay.UTF8BOM {
+			enc = overlay.UTF8BOM
+		}
+		text := document.NormalizeLineEndings(file.Text, document.LF)
+		if text == file.Text && enc == file.Encoding {
+			return nil
+		}
+		if err := s.files.WriteFile(uri, text, enc); err != nil {
+			return err
+		}
+		log.Printf("converted %s from %s to %s with LF line endings", uri, file.Encoding, enc)
+		return nil
+	}
+
+	var edits []lsp.TextEdit
+	for _, br := range document.LineBreaks(snap.Text()) {
+		if br.Ending == document.LF {
+			continue
+		}
+		rng, err := snap.RangeOf(br.Offset, br.Offset+len(br.Ending), s.Encoding())
+		if err != nil {
+			return errors.Wrap(err, "converting line endings")
+		}
+		edits = append(edits, lsp.TextEdit{Range: rng, NewText: "\n"})
+	}
+	if len(edits) > 0 {
+		edit := lsp.WorkspaceEdit{Changes: map[string][]lsp.TextEdit{string(uri): edits}}
+		if err := s.applyEdit("Convert line endings to LF", edit); err != nil {
+			return err
+		}
+	}
+
+	if !snap.OnDisk() {
+		return nil
+	}
+	if file, err := s.files.ReadDisk(uri); err == nil && !file.Encoding.IsUTF8() {
+		message := fmt.Sprintf("%s is stored as %s; save it with the UTF-8 encoding to convert it.", uri, file.Encoding)
+		return s.showMessage(lsp.MTWarning, message)
+	}
+	return nil
+}
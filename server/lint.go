@@ -0,0 +1,371 @@
+package tcpserver
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+
+	"lsp/server/document"
+	"lsp/server/docuri"
+	"lsp/server/lint"
+	"lsp/server/position"
+	"lsp/server/workspace"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+const (
+	// codeLintConfig is the code of problems found in a lint
+	// configuration file.
+	codeLintConfig = "lint-config"
+	// codeUnusedSuppression is the code of hints at directives that turn
+	// nothing off.
+	codeUnusedSuppression = "unused-suppression"
+)
+
+// checkLint reports every hit of the lint rules in snap. A lint
+// configuration file is checked for mistakes instead, as the terms it
+// lists would all be hits.
+func (s *Session) checkLint(snap *document.Snapshot) []DiagnosticValue {
+	if _, ok := s.lintConfigFolder(snap.URI); ok {
+		_, errs := lint.ParseConfig([]byte(snap.Text()))
+		return s.configDiagnostics(snap.Text(), errs)
+	}
+	hits, hints := s.lintHits(snap)
+	var diagnostics []DiagnosticValue
+	for _, hit := range hits {
+		diagnostics = append(diagnostics, hit.diagnostic)
+	}
+	return append(diagnostics, hints...)
+}
+
+// lintHit is a lint finding along with the diagnostic reported for it.
+type lintHit struct {
+	finding    lint.Finding
+	diagnostic DiagnosticValue
+}
+
+// lintHits lints snap, returning its hits along with hints at the
+// suppressions in it that are unused. Lint configuration files have
+// neither.
+func (s *Session) lintHits(snap *document.Snapshot) ([]lintHit, []DiagnosticValue) {
+	if _, ok := s.lintConfigFolder(snap.URI); ok {
+		return nil, nil
+	}
+	linter, rel := s.linterFor(snap.URI)
+	var report lint.Report
+	if doc, ok := s.pluginDocument(snap, rel); ok {
+		report = linter.LintDocument(doc)
+	} else {
+		report = linter.Lint(rel, snap.Text())
+	}
+	enc := s.Encoding()
+
+	var hints []DiagnosticValue
+	for _, u := range report.Unused {
+		rng, err := snap.RangeOf(u.Start, u.End, enc)
+		if err != nil {
+			log.Printf("linting %s: %v", snap.URI, err)
+			break
+		}
+		hints = append(hints, DiagnosticValue{
+			Range:    rng,
+			Severity: lsp.Hint,
+			Code:     codeUnusedSuppression,
+			Source:   diagnosticSource,
+			Message:  u.Message,
+		})
+	}
+
+	var hits []lintHit
+	for _, f := range report.Findings {
+		if s.acceptedWord(snap.URI, f.Match) {
+			continue
+		}
+		rng, err := snap.RangeOf(f.Start, f.End, enc)
+		if err != nil {
+			log.Printf("linting %s: %v", snap.URI, err)
+			break
+		}
+		message := f.Message()
+		if f.Rule.Rationale != "" {
+			message += "\n" + f.Rule.Rationale
+		}
+		diagnostic := DiagnosticValue{
+			Range:    rng,
+			Severity: f.Rule.Severity,
+			Code:     f.Rule.Code,
+			Source:   diagnosticSource,
+			Message:  message,
+		}
+		if f.Rule.URL != "" {
+			diagnostic.CodeDescription = &CodeDescriptionValue{Href: f.Rule.URL}
+		}
+		hits = append(hits, lintHit{finding: f, diagnostic: diagnostic})
+	}
+	return hits, hints
+}
+
+// linterFor returns the engine that checks the document at uri: that of
+// its workspace folder when the folder has a configuration file, and the
+// default one otherwise. rel is the document's path within the folder.
+func (s *Session) linterFor(uri lsp.DocumentURI) (linter *lint.Engine, rel string) {
+	s.mu.Lock()
+	linter = s.linter
+	s.mu.Unlock()
+
+	f, ok := s.folders.For(uri)
+	if !ok {
+		return linter, ""
+	}
+	if path, err := docuri.Filename(uri); err == nil {
+		if r, err := filepath.Rel(f.Path, path); err == nil {
+			rel = filepath.ToSlash(r)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.linters[f.Path]; ok {
+		linter = l.engine
+	}
+	return linter, rel
+}
+
+// lintSettings is the part of a folder's settings about linting:
+//
+//	{"plaintext": {"lint": {"enablePlugins": true}}}
+type lintSettings struct {
+	Lint struct {
+		// EnablePlugins lets the plugins named in the folder's
+		// configuration file run. It is off unless the user turns it on,
+		// as the file comes with the workspace and could name any command.
+		EnablePlugins bool `json:"enablePlugins"`
+	} `json:"lint"`
+}
+
+// pluginDocument returns what lint plugins are given to check snap, and
+// whether they may check it at all: only documents in a workspace folder
+// whose settings enable plugins are.
+func (s *Session) pluginDocument(snap *document.Snapshot, rel string) (lint.Document, bool) {
+	f, ok := s.folders.For(snap.URI)
+	if !ok {
+		return lint.Document{}, false
+	}
+	var settings lintSettings
+	if err := f.DecodeSettings(&settings); err != nil {
+		log.Printf("linting %s: %v", snap.URI, err)
+		return lint.Document{}, false
+	}
+	if !settings.Lint.EnablePlugins {
+		return lint.Document{}, false
+	}
+	return lint.Document{
+		URI:        string(snap.URI),
+		LanguageID: snap.LanguageID,
+		Path:       rel,
+		Dir:        f.Path,
+		Text:       snap.Text(),
+	}, true
+}
+
+// runLintPlugins runs the lint plugins that have yet to check the text of
+// snap in the background, and reports its lint diagnostics again with
+// what they found once they are done. Their results are cached by
+// content, so undoing back to text they have seen needs no new run.
+func (s *Session) runLintPlugins(snap *document.Snapshot) {
+	if _, ok := s.lintConfigFolder(snap.URI); ok {
+		return
+	}
+	linter, rel := s.linterFor(snap.URI)
+	doc, ok := s.pluginDocument(snap, rel)
+	if !ok || !linter.PendingPlugins(doc) {
+		return
+	}
+	go func() {
+		for _, err := range linter.RunPlugins(context.Background(), doc) {
+			log.Printf("linting %s: %v", snap.URI, err)
+		}
+		if cur, ok := s.documents.Get(snap.URI); !ok || cur.Version != snap.Version {
+			return
+		}
+		if err := s.ReportDiagnostics(snap, "lint", s.checkLint(snap)); err != nil {
+			log.Printf("linting %s: %v", snap.URI, err)
+		}
+		s.refreshDiagnostics()
+	}()
+}
+
+// lintConfigFolder returns the folder whose configuration file is at uri.
+func (s *Session) lintConfigFolder(uri lsp.DocumentURI) (*workspace.Folder, bool) {
+	f, ok := s.folders.For(uri)
+	if !ok {
+		return nil, false
+	}
+	path, err := docuri.Filename(uri)
+	if err != nil || path != filepath.Join(f.Path, lint.ConfigFile) {
+		return nil, false
+	}
+	return f, true
+}
+
+// folderLinter is the lint configuration of a folder that has a file for
+// it.
+type folderLinter struct {
+	engine *lint.Engine
+	// clean is set when engine was compiled from a file without mistakes.
+	clean bool
+	// text is the file as last read, whether or not it took effect, so
+	// that reading it again unchanged does not relint every document.
+	text string
+}
+
+// loadLintConfig reads the configuration file of f, from the editor if it
+// is open there and from disk otherwise, and applies it.
+func (s *Session) loadLintConfig(f *workspace.Folder) {
+	uri := docuri.FromPath(filepath.Join(f.Path, lint.ConfigFile))
+	if snap, open := s.documents.Get(uri); open {
+		s.applyLintConfig(f, snap.Text(), true)
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(f.Path, lint.ConfigFile))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("reading lint config of %s: %v", f.Name, err)
+	}
+	s.applyLintConfig(f, string(data), err == nil)
+}
+
+// applyLintConfig compiles the configuration text of f and, if anything
+// changed, swaps the folder's rules for the new ones and relints its open
+// documents. A file with mistakes keeps the last one that had none in
+// effect; until there is one, the rules without mistakes apply, or the
+// default rules if the file is not valid YAML. Without a file the
+// default rules apply too. The mistakes are published on the file itself,
+// unless it is open, in which case linting it already reports them.
+func (s *Session) applyLintConfig(f *workspace.Folder, text string, exists bool) {
+	uri := docuri.FromPath(filepath.Join(f.Path, lint.ConfigFile))
+	s.mu.Lock()
+	cur, ok := s.linters[f.Path]
+	s.mu.Unlock()
+
+	if !exists {
+		if ok {
+			s.setLinter(f, nil)
+		}
+		return
+	}
+	if ok && cur.text == text {
+		return
+	}
+
+	next := &folderLinter{text: text}
+	cfg, errs := lint.ParseConfig([]byte(text))
+	if cfg != nil {
+		engine, err := lint.New(cfg)
+		if err != nil {
+			log.Printf("compiling lint config of %s: %v", f.Name, err)
+		} else {
+			next.engine, next.clean = engine, len(errs) == 0
+		}
+	}
+	switch {
+	case next.clean:
+		log.Printf("loaded %d lint rules for %s", len(cfg.Rules), f.Name)
+	case ok && cur.clean:
+		log.Printf("lint config of %s has mistakes; keeping the last one without", f.Name)
+		next.engine, next.clean = cur.engine, true
+	case next.engine != nil:
+		log.Printf("lint config of %s has mistakes; loaded the %d rules without", f.Name, len(cfg.Rules))
+	default:
+		log.Printf("lint config of %s is not usable; using the default rules", f.Name)
+		s.mu.Lock()
+		next.engine = s.linter
+		s.mu.Unlock()
+	}
+
+	if _, open := s.documents.Get(uri); !open {
+		if err := s.publishFileDiagnostics(uri, s.configDiagnostics(text, errs)); err != nil {
+			log.Printf("reporting lint config of %s: %v", f.Name, err)
+		}
+	}
+	if ok && next.engine == cur.engine {
+		// the rules are the same; only remember what was read
+		s.mu.Lock()
+		s.linters[f.Path] = next
+		s.mu.Unlock()
+		return
+	}
+	s.setLinter(f, next)
+}
+
+// lintConfigChanged reloads the configuration of the folder whose
+// configuration file changed on disk. While the file is open, the editor's
+// copy is the one that applies.
+func (s *Session) lintConfigChanged(uri lsp.DocumentURI, change lsp.FileChangeType) {
+	f, ok := s.lintConfigFolder(uri)
+	if !ok {
+		return
+	}
+	if _, open := s.documents.Get(uri); open {
+		return
+	}
+	s.loadLintConfig(f)
+}
+
+// setLinter makes linter check the documents of f, or the default rules
+// when it is nil, and relints the open ones. Documents being linted
+// meanwhile finish with the rules they started with.
+func (s *Session) setLinter(f *workspace.Folder, linter *folderLinter) {
+	s.mu.Lock()
+	if linter != nil {
+		s.linters[f.Path] = linter
+	} else {
+		delete(s.linters, f.Path)
+	}
+	s.mu.Unlock()
+	s.relint(f)
+}
+
+// relint checks the open documents inside f again, other than its
+// configuration file, whose mistakes do not depend on the rules in effect.
+func (s *Session) relint(f *workspace.Folder) {
+	for _, snap := range s.documents.All() {
+		if _, config := s.lintConfigFolder(snap.URI); f.Contains(snap.URI) && !config {
+			s.documentChanged(snap)
+		}
+	}
+	// files that are not open are affected too
+	s.refreshDiagnostics()
+}
+
+// configDiagnostics turns the mistakes found in a configuration file into
+// diagnostics spanning the rest of the line each one is on.
+func (s *Session) configDiagnostics(text string, errs []*lint.ConfigError) []DiagnosticValue {
+	enc := s.Encoding()
+	diagnostics := []DiagnosticValue{}
+	for _, e := range errs {
+		pos := lsp.Position{Line: e.Line - 1, Character: e.Column - 1}
+		start, err := position.ToOffset(text, pos, position.UTF32)
+		if err != nil {
+			start = len(text)
+		}
+		pos.Character = len(text)
+		end, err := position.ToOffset(text, pos, position.UTF32)
+		if err != nil {
+			end = len(text)
+		}
+		rng, err := position.ToRange(text, start, end, enc)
+		if err != nil {
+			log.Printf("locating lint config error: %v", err)
+			continue
+		}
+		diagnostics = append(diagnostics, DiagnosticValue{
+			Range:    rng,
+			Severity: lsp.Error,
+			Code:     codeLintConfig,
+			Source:   diagnosticSource,
+			Message:  e.Message,
+		})
+	}
+	return diagnostics
+}
@@ -0,0 +1,153 @@
+package lint
+
+import "sort"
+
+// automaton finds every occurrence of a set of strings in a text in one
+// pass over it, in time linear in the length of the text plus the number
+// of matches, however many strings there are (Aho and Corasick, 1975).
+//
+// Nodes are numbered from 0, the root, and their fields are kept in
+// parallel slices, which keeps the scan loop tight.
+type automaton struct {
+	// the trie transitions out of node n are edgeBytes[edges[n]:edges[n+1]]
+	// and edgeTo likewise, sorted by byte
+	edges     []int32
+	edgeBytes []byte
+	edgeTo    []int32
+	// root holds the transitions out of the root for every byte, where the
+	// scan spends most of its time, to the root itself where the trie has
+	// none
+	root [256]int32
+	// fail is the node for the longest proper suffix of a node's string
+	// that is also in the trie
+	fail []int32
+	// dict is the nearest node along the fail links with strings ending at
+	// it, or -1
+	dict []int32
+	// out lists the strings that end at a node
+	out [][]int32
+	// lengths holds the length of every string, by index
+	lengths []int
+}
+
+// newAutomaton builds the automaton for strs.
+func newAutomaton(strs []string) *automaton {
+	a := &automaton{lengths: make([]int, len(strs))}
+	children := []map[byte]int32{{}}
+	a.out = [][]int32{nil}
+	for id, s := range strs {
+		a.lengths[id] = len(s)
+		n := int32(0)
+		for i := 0; i < len(s); i++ {
+			next, ok := children[n][s[i]]
+			if !ok {
+				next = int32(len(children))
+				children = append(children, map[byte]int32{})
+				a.out = append(a.out, nil)
+				children[n][s[i]] = next
+			}
+			n = next
+		}
+		a.out[n] = append(a.out[n], int32(id))
+	}
+
+	a.edges = make([]int32, len(children)+1)
+	for n, edges := range children {
+		a.edges[n] = int32(len(a.edgeBytes))
+		start := len(a.edgeBytes)
+		for b := range edges {
+			a.edgeBytes = append(a.edgeBytes, b)
+		}
+		bytes := a.edgeBytes[start:]
+		sort.Slice(bytes, func(i, j int) bool { return bytes[i] < bytes[j] })
+		for _, b := range bytes {
+			a.edgeTo = append(a.edgeTo, edges[b])
+		}
+	}
+	a.edges[len(children)] = int32(len(a.edgeBytes))
+	for i := a.edges[0]; i < a.edges[1]; i++ {
+		a.root[a.edgeBytes[i]] = a.edgeTo[i]
+	}
+
+	// fail links, breadth first so a node's fail link is always set before
+	// those of its children
+	a.fail = make([]int32, len(children))
+	a.dict = make([]int32, len(children))
+	a.dict[0] = -1
+	queue := append([]int32(nil), a.edgeTo[a.edges[0]:a.edges[1]]...)
+	for _, n := range queue {
+		a.dict[n] = -1
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for i := a.edges[n]; i < a.edges[n+1]; i++ {
+			b, child := a.edgeBytes[i], a.edgeTo[i]
+			f := a.fail[n]
+			for {
+				if to, ok := a.step(f, b); ok {
+					f = to
+					break
+				}
+				if f == 0 {
+					break
+				}
+				f = a.fail[f]
+			}
+			a.fail[child] = f
+			if len(a.out[f]) > 0 {
+				a.dict[child] = f
+			} else {
+				a.dict[child] = a.dict[f]
+			}
+			queue = append(queue, child)
+		}
+	}
+	return a
+}
+
+// step follows the trie transition out of n on b.
+func (a *automaton) step(n int32, b byte) (int32, bool) {
+	lo, hi := a.edges[n], a.edges[n+1]
+	for lo < hi {
+		mid := int32(uint32(lo+hi) >> 1)
+		if a.edgeBytes[mid] < b {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo < a.edges[n+1] && a.edgeBytes[lo] == b {
+		return a.edgeTo[lo], true
+	}
+	return 0, false
+}
+
+// scan calls fn with the index, start and end of every occurrence of the
+// automaton's strings in text, overlapping ones included, in order of
+// their ends.
+func (a *automaton) scan(text string, fn func(id, start, end int)) {
+	n := int32(0)
+	for i := 0; i < len(text); i++ {
+		b := text[i]
+		for n != 0 {
+			if to, ok := a.step(n, b); ok {
+				n = to
+				break
+			}
+			n = a.fail[n]
+		}
+		if n == 0 {
+			n = a.root[b]
+		}
+		m := n
+		if len(a.out[m]) == 0 {
+			m = a.dict[m]
+		}
+		for ; m > 0; m = a.dict[m] {
+			for _, id := range a.out[m] {
+				fn(int(id), i+1-a.lengths[id], i+1)
+			}
+		}
+	}
+}
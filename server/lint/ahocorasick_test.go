@@ -0,0 +1,128 @@
+package lint
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutomaton(t *testing.T) {
+	tests := []struct {
+		name string
+		strs []string
+		text string
+		want []string
+	}{
+		{name: "none", strs: []string{"foo"}, text: "bar"},
+		{name: "overlapping", strs: []string{"he", "she", "his", "hers"}, text: "ushers", want: []string{"she@1", "he@2", "hers@2"}},
+		{name: "suffix of another", strs: []string{"abcd", "bc"}, text: "abcx abcd", want: []string{"bc@1", "bc@6", "abcd@5"}},
+		{name: "repeated", strs: []string{"aa"}, text: "aaaa", want: []string{"aa@0", "aa@1", "aa@2"}},
+		{name: "same string twice", strs: []string{"x", "x"}, text: "x", want: []string{"x@0", "x@0"}},
+		{name: "multibyte", strs: []string{"été"}, text: "l'été", want: []string{"été@2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			newAutomaton(tt.strs).scan(tt.text, func(id, start, end int) {
+				require.Equal(t, tt.strs[id], tt.text[start:end])
+				got = append(got, fmt.Sprintf("%s@%d", tt.strs[id], start))
+			})
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLintPositions(t *testing.T) {
+	e, err := New(&Config{Rules: []Rule{{Term: "foo"}}})
+	require.NoError(t, err)
+	var got [][2]int
+	for _, f := range e.Lint("", "foo\r\n  foo\rfoo\n\nx foo").Findings {
+		got = append(got, [2]int{f.Line, f.Column})
+	}
+	require.Equal(t, [][2]int{{0, 0}, {1, 2}, {2, 0}, {4, 2}}, got)
+}
+
+// randomWords returns n distinct lower case words of 4 to 12 letters.
+func randomWords(r *rand.Rand, n int) []string {
+	seen := map[string]bool{}
+	var words []string
+	for len(words) < n {
+		b := make([]byte, 4+r.Intn(9))
+		for i := range b {
+			b[i] = byte('a' + r.Intn(26))
+		}
+		if w := string(b); !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// termEngine builds an engine for n random terms, folding case, as the
+// large legal and trademark lists do.
+func termEngine(b *testing.B, r *rand.Rand, n int) (*Engine, []string) {
+	terms := randomWords(r, n)
+	rules := make([]Rule, len(terms))
+	for i, term := range terms {
+		rules[i] = Rule{Term: term, IgnoreCase: true}
+	}
+	e, err := New(&Config{Rules: rules})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return e, terms
+}
+
+// document returns about size bytes of random words, one in fifty of them
+// a term.
+func document(r *rand.Rand, size int, terms []string) string {
+	var sb strings.Builder
+	filler := randomWords(r, 1000)
+	for sb.Len() < size {
+		if r.Intn(50) == 0 {
+			sb.WriteString(terms[r.Intn(len(terms))])
+		} else {
+			sb.WriteString(filler[r.Intn(len(filler))])
+		}
+		if r.Intn(12) == 0 {
+			sb.WriteByte('\n')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+	return sb.String()
+}
+
+func BenchmarkNew(b *testing.B) {
+	for _, n := range []int{1000, 20000} {
+		b.Run(fmt.Sprintf("terms=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				termEngine(b, rand.New(rand.NewSource(1)), n)
+			}
+		})
+	}
+}
+
+// BenchmarkLint shows linting is linear in the size of the document: for
+// either number of terms, the throughput stays the same as the document
+// grows a hundredfold.
+func BenchmarkLint(b *testing.B) {
+	for _, n := range []int{100, 20000} {
+		r := rand.New(rand.NewSource(1))
+		e, terms := termEngine(b, r, n)
+		for _, size := range []int{10 << 10, 100 << 10, 1 << 20} {
+			text := document(r, size, terms)
+			b.Run(fmt.Sprintf("terms=%d/size=%dKiB", n, size>>10), func(b *testing.B) {
+				b.SetBytes(int64(len(text)))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					e.Lint("", text)
+				}
+			})
+		}
+	}
+}
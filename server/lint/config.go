@@ -0,0 +1,718 @@
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"lsp/server/overlay"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the name of the lint configuration file read at the root
+// of every workspace folder:
+//
+//	rules:
+//	  - term: foo
+//	    severity: error
+//	    message: say what you mean
+//	    replacements: [example]
+//	    include: ["docs/"]
+//	    exclude: ["CHANGELOG.md"]
+//	  - term: naïve approach
+//	    ignoreCase: true
+//	    ignoreDiacritics: true
+//	  - pattern: 'TODO\((?P<who>\w+)\)'
+//	    code: todo
+//	    message: ask ${who} about this
+//	  - term: master
+//	    disabled: true
+//	packs: [inclusive-language, product-names]
+//	allow:
+//	  - foo bar
+//	plugins:
+//	  - name: house-style
+//	    command: [python3, scripts/style.py, "${path}"]
+//	    timeout: 5s
+//	    languages: [plaintext, markdown]
+//	pluginConcurrency: 2
+//	prose:
+//	  long-sentence:
+//	    maxWords: 30
+//	  passive-voice: hint
+//	  weasel-word: on
+//	  double-space: off
+//
+// Packs adds the rules of the packs built into the server, listed by
+// Packs. A rule with the same term as one of theirs changes only the keys
+// it sets, so "disabled: true" is enough to turn one off.
+//
+// Plugin commands are run as described at Plugin.
+//
+// Prose sets the checks listed by ProseChecks, which are on or off as they
+// say unless the file says otherwise: a severity or "on" turns one on,
+// "off" turns it off, and a mapping can also set its url, include and
+// exclude, and for long-sentence maxWords. A rule's url links its
+// diagnostics to where the rule is documented.
+const ConfigFile = ".plaintextlint.yaml"
+
+// Config is what a configuration file sets.
+type Config struct {
+	Rules []Rule
+	// Packs names the rule packs whose rules are in Rules.
+	Packs []string
+	// Allow lists text that is never a finding, whichever rule matches it.
+	Allow []string
+	// Plugins are the external commands that check documents too.
+	Plugins []Plugin
+	// PluginConcurrency is how many plugins may run at once; zero means
+	// DefaultPluginConcurrency.
+	PluginConcurrency int
+	// Prose lists the prose checks to run.
+	Prose []Prose
+}
+
+// ConfigError is a problem at one place in a configuration file. Line and
+// Column count from 1, Column in characters.
+type ConfigError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+var severities = map[string]lsp.DiagnosticSeverity{
+	"error":       lsp.Error,
+	"warning":     lsp.Warning,
+	"information": lsp.Information,
+	"info":        lsp.Information,
+	"hint":        lsp.Hint,
+}
+
+// yamlErrorLine finds the line yaml names in its error messages.
+var yamlErrorLine = regexp.MustCompile(`line (\d+): `)
+
+// ParseConfig reads a configuration file. Rules with errors are left out
+// and the rest kept; the config is nil only if the file is not valid YAML
+// at all.
+func ParseConfig(data []byte) (*Config, []*ConfigError) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		msg := strings.TrimPrefix(err.Error(), "yaml: ")
+		line := 1
+		if m := yamlErrorLine.FindStringSubmatchIndex(msg); m != nil {
+			line, _ = strconv.Atoi(msg[m[2]:m[3]])
+			msg = msg[:m[0]] + msg[m[1]:]
+		}
+		return nil, []*ConfigError{{Line: line, Column: 1, Message: msg}}
+	}
+
+	p := &configParser{terms: map[string]bool{}, plugins: map[string]bool{}, fromPack: map[*yaml.Node]packEntry{}}
+	cfg := &Config{}
+	if len(root.Content) == 0 {
+		cfg.Prose = defaultProse(nil)
+		return cfg, nil
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		p.fail(doc, "expected a mapping with a rules key")
+		cfg.Prose = defaultProse(nil)
+		return cfg, p.errs
+	}
+	var rules, packs []*yaml.Node
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+		switch key.Value {
+		case "rules":
+			if value.Kind != yaml.SequenceNode {
+				p.fail(value, "rules must be a list")
+				continue
+			}
+			rules = value.Content
+		case "packs":
+			switch value.Kind {
+			case yaml.ScalarNode:
+				packs = []*yaml.Node{value}
+			case yaml.SequenceNode:
+				packs = value.Content
+			default:
+				p.fail(value, "expected a list of rule packs")
+			}
+		case "allow":
+			p.list(value, &cfg.Allow)
+		case "plugins":
+			if value.Kind != yaml.SequenceNode {
+				p.fail(value, "plugins must be a list")
+				continue
+			}
+			for _, item := range value.Content {
+				if plugin, ok := p.plugin(item); ok {
+					cfg.Plugins = append(cfg.Plugins, plugin)
+				}
+			}
+		case "prose":
+			if value.Kind != yaml.MappingNode {
+				p.fail(value, "prose must be a mapping of prose checks")
+				continue
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				if prose, ok := p.prose(value.Content[j], value.Content[j+1]); ok {
+					cfg.Prose = append(cfg.Prose, prose)
+				}
+			}
+		case "pluginConcurrency":
+			if value.Kind != yaml.ScalarNode || value.Decode(&cfg.PluginConcurrency) != nil || cfg.PluginConcurrency < 1 {
+				p.fail(value, "pluginConcurrency must be a positive number")
+				cfg.PluginConcurrency = 0
+			}
+		default:
+			p.fail(key, fmt.Sprintf("unknown key %q", key.Value))
+		}
+	}
+
+	for _, n := range p.withPacks(cfg, packs, rules) {
+		if rule, ok := p.rule(n); ok {
+			cfg.Rules = append(cfg.Rules, rule)
+		}
+	}
+	cfg.Prose = append(cfg.Prose, defaultProse(cfg.Prose)...)
+	return cfg, p.errs
+}
+
+// AllowText returns the configuration file data with text added to its
+// allow list. Only the new entry is written; the rest of the file is kept
+// as it is.
+func AllowText(data []byte, text string) ([]byte, error) {
+	at, insert, err := AllowEdit(data, text)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(data)+len(insert))
+	out = append(append(append(out, data[:at]...), insert...), data[at:]...)
+	return out, nil
+}
+
+// AllowEdit returns the insertion that adds text to the allow list of the
+// configuration file data: at is the byte offset it goes at. Nothing is
+// inserted when text is allowed already.
+func AllowEdit(data []byte, text string) (at int, insert string, err error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return 0, "", errors.Wrap(err, "parsing lint config")
+	}
+	eol := "\n"
+	if bytes.Contains(data, []byte("\r\n")) {
+		eol = "\r\n"
+	}
+
+	if len(root.Content) == 0 {
+		at, sep := afterLine(data, strings.Count(string(data), "\n")+1, eol)
+		return checkAllowEdit(data, text, at, sep+"allow:"+eol+"  - "+yamlScalar(text, false)+eol)
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return 0, "", errors.New("lint config is not a mapping")
+	}
+	var key, allow *yaml.Node
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "allow" {
+			key, allow = doc.Content[i], doc.Content[i+1]
+		}
+	}
+
+	switch {
+	case allow == nil:
+		if doc.Style&yaml.FlowStyle != 0 {
+			return 0, "", errors.New("lint config is a flow mapping; add to its allow list by hand")
+		}
+		at, sep := afterLine(data, strings.Count(string(data), "\n")+1, eol)
+		return checkAllowEdit(data, text, at, sep+"allow:"+eol+"  - "+yamlScalar(text, false)+eol)
+	case allow.Kind == yaml.ScalarNode && allow.Tag == "!!null" && allow.Value == "":
+		// allow: with nothing after it; the list goes on the next line
+		at, sep := afterLine(data, key.Line, eol)
+		indent := strings.Repeat(" ", key.Column-1)
+		return checkAllowEdit(data, text, at, sep+indent+"  - "+yamlScalar(text, false)+eol)
+	case allow.Kind != yaml.SequenceNode:
+		return 0, "", errors.New("allow in lint config is not a list")
+	}
+	for _, item := range allow.Content {
+		if item.Value == text {
+			return 0, "", nil
+		}
+	}
+
+	if allow.Style&yaml.FlowStyle != 0 {
+		if len(allow.Content) == 0 {
+			// just inside the [
+			at := offsetOf(data, allow.Line, allow.Column) + 1
+			return checkAllowEdit(data, text, at, yamlScalar(text, true))
+		}
+		at, ok := flowSequenceEnd(data, allow.Content[len(allow.Content)-1])
+		if !ok {
+			return 0, "", errors.New("cannot find the end of the allow list in lint config")
+		}
+		return checkAllowEdit(data, text, at, ", "+yamlScalar(text, true))
+	}
+
+	// a new item under the last one, with the same dash and indent
+	last := allow.Content[len(allow.Content)-1]
+	prefix := string(data[offsetOf(data, last.Line, 1):offsetOf(data, last.Line, last.Column)])
+	if strings.TrimSpace(prefix) != "-" {
+		return 0, "", errors.New("cannot find the end of the allow list in lint config")
+	}
+	at, sep := afterLine(data, last.Line, eol)
+	return checkAllowEdit(data, text, at, sep+prefix+yamlScalar(text, false)+eol)
+}
+
+// checkAllowEdit makes sure inserting insert at at leaves data a valid
+// configuration that allows text, and returns them if so. Layouts the edit
+// does not foresee, such as a list item spanning lines, are refused rather
+// than broken.
+func checkAllowEdit(data []byte, text string, at int, insert string) (int, string, error) {
+	edited := string(data[:at]) + insert + string(data[at:])
+	var before, after struct {
+		Allow []string `yaml:"allow"`
+	}
+	// data parsed already, so only the edit can make this fail
+	yaml.Unmarshal(data, &before)
+	if err := yaml.Unmarshal([]byte(edited), &after); err != nil ||
+		len(after.Allow) != len(before.Allow)+1 || after.Allow[len(after.Allow)-1] != text {
+		return 0, "", errors.New("cannot add to the allow list of this lint config; add it by hand")
+	}
+	return at, insert, nil
+}
+
+// yamlScalar writes text as a YAML scalar, quoted if need be, to go on a
+// line of its own or, with flow set, in a [] list.
+func yamlScalar(text string, flow bool) string {
+	out, err := yaml.Marshal(text)
+	if err != nil {
+		// a string always marshals
+		panic(err)
+	}
+	s := strings.TrimSuffix(string(out), "\n")
+	if strings.Contains(s, "\n") || (flow && strings.ContainsAny(s, ",[]{}") && s[0] != '"' && s[0] != '\'') {
+		// Go escapes are YAML escapes too
+		s = strconv.Quote(text)
+	}
+	return s
+}
+
+// offsetOf returns the byte offset in data of a position as the YAML
+// parser gives it: a line and a column in characters, both counting from 1.
+func offsetOf(data []byte, line, column int) int {
+	i := 0
+	for n := 1; n < line; n++ {
+		next := bytes.IndexByte(data[i:], '\n')
+		if next < 0 {
+			return len(data)
+		}
+		i += next + 1
+	}
+	for c := 1; c < column && i < len(data) && data[i] != '\n'; c++ {
+		_, size := utf8.DecodeRune(data[i:])
+		i += size
+	}
+	return i
+}
+
+// afterLine returns the offset of the start of the line after line, and
+// the line ending to insert first if line is the last and has none.
+func afterLine(data []byte, line int, eol string) (int, string) {
+	at := offsetOf(data, line+1, 1)
+	if at == len(data) && at > 0 && data[at-1] != '\n' {
+		return at, eol
+	}
+	return at, ""
+}
+
+// flowSequenceEnd returns the offset of the ] closing the flow sequence
+// whose last item is last.
+func flowSequenceEnd(data []byte, last *yaml.Node) (int, bool) {
+	i := offsetOf(data, last.Line, last.Column)
+	switch last.Style {
+	case yaml.DoubleQuotedStyle:
+		for i++; i < len(data) && data[i] != '"'; i++ {
+			if data[i] == '\\' {
+				i++
+			}
+		}
+		i++
+	case yaml.SingleQuotedStyle:
+		for i++; i < len(data); i++ {
+			if data[i] == '\'' {
+				if i+1 < len(data) && data[i+1] == '\'' {
+					i++
+					continue
+				}
+				break
+			}
+		}
+		i++
+	default:
+		i += len(last.Value)
+	}
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		case '#':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case ']':
+			return i, true
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+type configParser struct {
+	errs    []*ConfigError
+	terms   map[string]bool
+	plugins map[string]bool
+	// fromPack holds the nodes read from rule packs rather than from the
+	// configuration file, with the entry of packs that brought them in.
+	fromPack map[*yaml.Node]packEntry
+}
+
+// packEntry is an entry of the packs list.
+type packEntry struct {
+	name string
+	node *yaml.Node
+}
+
+// fail reports a mistake at n. One in a rule pack is reported at the entry
+// naming the pack, since its line and column are in a file the user does
+// not have.
+func (p *configParser) fail(n *yaml.Node, msg string) {
+	if pack, ok := p.fromPack[n]; ok {
+		n = pack.node
+		msg = fmt.Sprintf("rule pack %q: %s", pack.name, msg)
+	}
+	p.errs = append(p.errs, &ConfigError{Line: n.Line, Column: n.Column, Message: msg})
+}
+
+// markPack records that n and everything in it came from a rule pack.
+func (p *configParser) markPack(n *yaml.Node, pack packEntry) {
+	p.fromPack[n] = pack
+	for _, c := range n.Content {
+		p.markPack(c, pack)
+	}
+}
+
+// rule reads one entry of the rules list.
+func (p *configParser) rule(n *yaml.Node) (Rule, bool) {
+	var rule Rule
+	if n.Kind != yaml.MappingNode {
+		p.fail(n, "a rule must be a mapping")
+		return rule, false
+	}
+	ok := true
+	var termNode *yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		switch key.Value {
+		case "term":
+			termNode = value
+			ok = p.scalar(value, &rule.Term) && ok
+		case "pattern":
+			if ok = p.scalar(value, &rule.Pattern) && ok; rule.Pattern != "" {
+				if _, err := regexp.Compile(rule.Pattern); err != nil {
+					p.fail(value, fmt.Sprintf("invalid pattern: %v", err))
+					ok = false
+				}
+			}
+		case "code":
+			ok = p.scalar(value, &rule.Code) && ok
+		case "message":
+			ok = p.scalar(value, &rule.Message) && ok
+		case "rationale":
+			ok = p.scalar(value, &rule.Rationale) && ok
+		case "url":
+			ok = p.scalar(value, &rule.URL) && ok
+		case "disabled":
+			ok = p.boolean(value, &rule.Disabled) && ok
+		case "severity":
+			ok = p.severity(value, &rule.Severity) && ok
+		case "ignoreCase":
+			ok = p.boolean(value, &rule.IgnoreCase) && ok
+		case "ignoreDiacritics":
+			ok = p.boolean(value, &rule.IgnoreDiacritics) && ok
+		case "wholeWord":
+			ok = p.boolean(value, &rule.WholeWord) && ok
+		case "replacements":
+			ok = p.list(value, &rule.Replacements) && ok
+		case "include":
+			ok = p.list(value, &rule.Include) && p.globs(value) && ok
+		case "exclude":
+			ok = p.list(value, &rule.Exclude) && p.globs(value) && ok
+		default:
+			p.fail(key, fmt.Sprintf("unknown rule key %q", key.Value))
+			ok = false
+		}
+	}
+	if !ok {
+		return rule, false
+	}
+	switch {
+	case rule.Term == "" && rule.Pattern == "":
+		p.fail(n, "a rule needs a term or a pattern")
+		return rule, false
+	case rule.Term != "" && rule.Pattern != "":
+		p.fail(n, "a rule cannot have both a term and a pattern")
+		return rule, false
+	case rule.Term != "" && strings.TrimSpace(rule.Term) == "":
+		p.fail(termNode, "term is blank")
+		return rule, false
+	case rule.Term != "" && p.terms[rule.Term]:
+		p.fail(termNode, fmt.Sprintf("term %q is listed twice", rule.Term))
+		return rule, false
+	}
+	if rule.Term != "" {
+		p.terms[rule.Term] = true
+	}
+	return rule, true
+}
+
+// withPacks returns the rules of the packs, each overridden by the rule
+// with the same term if there is one, followed by the rules that override
+// none of them.
+func (p *configParser) withPacks(cfg *Config, packs, rules []*yaml.Node) []*yaml.Node {
+	var all []*yaml.Node
+	byTerm := map[string]int{}
+	for _, n := range packs {
+		var name string
+		if !p.scalar(n, &name) {
+			continue
+		}
+		if contains(cfg.Packs, name) {
+			p.fail(n, fmt.Sprintf("rule pack %q is listed twice", name))
+			continue
+		}
+		nodes, err := packRules(name)
+		if err != nil {
+			var names []string
+			for _, pack := range Packs() {
+				names = append(names, pack.Name)
+			}
+			p.fail(n, fmt.Sprintf("unknown rule pack %q; use one of %s", name, strings.Join(names, ", ")))
+			continue
+		}
+		cfg.Packs = append(cfg.Packs, name)
+		for _, node := range nodes {
+			p.markPack(node, packEntry{name: name, node: n})
+			if term := mappingValue(node, "term"); term != nil {
+				byTerm[term.Value] = len(all)
+			}
+			all = append(all, node)
+		}
+	}
+
+	overridden := map[int]bool{}
+	for _, n := range rules {
+		if term := mappingValue(n, "term"); term != nil {
+			if i, ok := byTerm[term.Value]; ok && !overridden[i] {
+				all[i] = mergeNodes(all[i], n)
+				overridden[i] = true
+				continue
+			}
+		}
+		all = append(all, n)
+	}
+	return all
+}
+
+// plugin reads one entry of the plugins list. A command given as a single
+// string is split at spaces; no shell is involved either way.
+func (p *configParser) plugin(n *yaml.Node) (Plugin, bool) {
+	var plugin Plugin
+	if n.Kind != yaml.MappingNode {
+		p.fail(n, "a plugin must be a mapping")
+		return plugin, false
+	}
+	ok := true
+	var nameNode *yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		switch key.Value {
+		case "name":
+			nameNode = value
+			ok = p.scalar(value, &plugin.Name) && ok
+		case "command":
+			if value.Kind == yaml.ScalarNode {
+				plugin.Command = strings.Fields(value.Value)
+			} else {
+				ok = p.list(value, &plugin.Command) && ok
+			}
+		case "timeout":
+			var s string
+			if p.scalar(value, &s) {
+				d, err := time.ParseDuration(s)
+				if err != nil || d <= 0 {
+					p.fail(value, fmt.Sprintf("invalid timeout %q; use a duration such as 5s", s))
+					ok = false
+				}
+				plugin.Timeout = d
+			} else {
+				ok = false
+			}
+		case "languages":
+			ok = p.list(value, &plugin.Languages) && ok
+		case "include":
+			ok = p.list(value, &plugin.Include) && p.globs(value) && ok
+		case "exclude":
+			ok = p.list(value, &plugin.Exclude) && p.globs(value) && ok
+		default:
+			p.fail(key, fmt.Sprintf("unknown plugin key %q", key.Value))
+			ok = false
+		}
+	}
+	if !ok {
+		return plugin, false
+	}
+	switch {
+	case plugin.Name == "":
+		p.fail(n, "a plugin needs a name")
+		return plugin, false
+	case p.plugins[plugin.Name]:
+		p.fail(nameNode, fmt.Sprintf("plugin %q is listed twice", plugin.Name))
+		return plugin, false
+	case len(plugin.Command) == 0 || plugin.Command[0] == "":
+		p.fail(n, "a plugin needs a command")
+		return plugin, false
+	}
+	p.plugins[plugin.Name] = true
+	return plugin, true
+}
+
+// prose reads the setting of one prose check: a mapping, or on its own
+// a severity, "on" or "off".
+func (p *configParser) prose(key, value *yaml.Node) (Prose, bool) {
+	prose := Prose{Code: key.Value}
+	if _, known := proseCheckOf(prose.Code); !known {
+		p.fail(key, fmt.Sprintf("unknown prose check %q; use one of %s", prose.Code, strings.Join(proseCodes(), ", ")))
+		return prose, false
+	}
+	if value.Kind == yaml.ScalarNode {
+		switch strings.ToLower(value.Value) {
+		case "on", "true":
+			return prose, true
+		case "off", "false":
+			prose.Disabled = true
+			return prose, true
+		}
+		return prose, p.severity(value, &prose.Severity)
+	}
+	if value.Kind != yaml.MappingNode {
+		p.fail(value, "expected a severity, on, off or a mapping")
+		return prose, false
+	}
+	ok := true
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		k, v := value.Content[i], value.Content[i+1]
+		switch k.Value {
+		case "severity":
+			ok = p.severity(v, &prose.Severity) && ok
+		case "url":
+			ok = p.scalar(v, &prose.URL) && ok
+		case "disabled":
+			ok = p.boolean(v, &prose.Disabled) && ok
+		case "maxWords":
+			if prose.Code != CodeLongSentence {
+				p.fail(k, fmt.Sprintf("maxWords only applies to %s", CodeLongSentence))
+				ok = false
+			} else if v.Kind != yaml.ScalarNode || v.Decode(&prose.MaxWords) != nil || prose.MaxWords < 1 {
+				p.fail(v, "maxWords must be a positive number")
+				prose.MaxWords = 0
+				ok = false
+			}
+		case "include":
+			ok = p.list(v, &prose.Include) && p.globs(v) && ok
+		case "exclude":
+			ok = p.list(v, &prose.Exclude) && p.globs(v) && ok
+		default:
+			p.fail(k, fmt.Sprintf("unknown prose check key %q", k.Value))
+			ok = false
+		}
+	}
+	return prose, ok
+}
+
+func (p *configParser) severity(n *yaml.Node, v *lsp.DiagnosticSeverity) bool {
+	var name string
+	if !p.scalar(n, &name) {
+		return false
+	}
+	severity, known := severities[strings.ToLower(name)]
+	if !known {
+		p.fail(n, fmt.Sprintf("unknown severity %q; use error, warning, information or hint", name))
+		return false
+	}
+	*v = severity
+	return true
+}
+
+func (p *configParser) scalar(n *yaml.Node, v *string) bool {
+	if n.Kind != yaml.ScalarNode {
+		p.fail(n, "expected a string")
+		return false
+	}
+	*v = n.Value
+	return true
+}
+
+func (p *configParser) boolean(n *yaml.Node, v *bool) bool {
+	if n.Kind != yaml.ScalarNode || n.Decode(v) != nil {
+		p.fail(n, "expected true or false")
+		return false
+	}
+	return true
+}
+
+// list reads a list of strings, or a single string as a list of one.
+func (p *configParser) list(n *yaml.Node, v *[]string) bool {
+	if n.Kind == yaml.ScalarNode {
+		*v = []string{n.Value}
+		return true
+	}
+	if n.Kind != yaml.SequenceNode {
+		p.fail(n, "expected a list of strings")
+		return false
+	}
+	for _, item := range n.Content {
+		var s string
+		if !p.scalar(item, &s) {
+			return false
+		}
+		*v = append(*v, s)
+	}
+	return true
+}
+
+func (p *configParser) globs(n *yaml.Node) bool {
+	items := n.Content
+	if n.Kind == yaml.ScalarNode {
+		items = []*yaml.Node{n}
+	}
+	ok := true
+	for _, item := range items {
+		if !overlay.ValidGlob(item.Value) {
+			p.fail(item, fmt.Sprintf("invalid glob %q", item.Value))
+			ok = false
+		}
+	}
+	return ok
+}
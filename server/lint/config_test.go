@@ -0,0 +1,268 @@
+package lint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, errs := ParseConfig([]byte(`rules:
+  - term: foo
+    severity: error
+    message: say what you mean
+    replacements: [example, sample]
+    include: "docs/"
+    exclude: ["CHANGELOG.md"]
+  - pattern: 'TODO\(\w+\)'
+    code: todo
+    wholeWord: true
+  - term: naïve
+    ignoreCase: yes
+    ignoreDiacritics: true
+`))
+	require.Empty(t, errs)
+	require.Equal(t, []Rule{
+		{
+			Term:         "foo",
+			Severity:     lsp.Error,
+			Message:      "say what you mean",
+			Replacements: []string{"example", "sample"},
+			Include:      []string{"docs/"},
+			Exclude:      []string{"CHANGELOG.md"},
+		},
+		{Pattern: `TODO\(\w+\)`, Code: "todo", WholeWord: true},
+		{Term: "naïve", IgnoreCase: true, IgnoreDiacritics: true},
+	}, cfg.Rules)
+
+	cfg, errs = ParseConfig(nil)
+	require.Empty(t, errs)
+	require.Empty(t, cfg.Rules)
+}
+
+func TestParseConfigPlugins(t *testing.T) {
+	cfg, errs := ParseConfig([]byte(`plugins:
+  - name: style
+    command: [python3, style.py, "${path}"]
+    timeout: 2s
+    languages: [markdown]
+    exclude: [vendor/]
+  - name: words
+    command: ./words --json
+pluginConcurrency: 2
+`))
+	require.Empty(t, errs)
+	require.Equal(t, []Plugin{
+		{
+			Name:      "style",
+			Command:   []string{"python3", "style.py", "${path}"},
+			Timeout:   2 * time.Second,
+			Languages: []string{"markdown"},
+			Exclude:   []string{"vendor/"},
+		},
+		{Name: "words", Command: []string{"./words", "--json"}},
+	}, cfg.Plugins)
+	require.Equal(t, 2, cfg.PluginConcurrency)
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		wantRules int
+		wantErrs  []ConfigError
+		wantNil   bool
+	}{
+		{
+			name:     "not yaml",
+			config:   "a: b\n c: d\n",
+			wantNil:  true,
+			wantErrs: []ConfigError{{Line: 2, Column: 1, Message: "mapping values are not allowed in this context"}},
+		},
+		{
+			name:     "unknown top-level key",
+			config:   "rulez: []\n",
+			wantErrs: []ConfigError{{Line: 1, Column: 1, Message: `unknown key "rulez"`}},
+		},
+		{
+			name:      "bad severity",
+			config:    "rules:\n  - term: foo\n    severity: fatal\n  - term: bar\n",
+			wantRules: 1,
+			wantErrs:  []ConfigError{{Line: 3, Column: 15}},
+		},
+		{
+			name:     "bad pattern",
+			config:   "rules:\n  - pattern: '('\n",
+			wantErrs: []ConfigError{{Line: 2, Column: 14}},
+		},
+		{
+			name:     "no term",
+			config:   "rules:\n  - message: hi\n",
+			wantErrs: []ConfigError{{Line: 2, Column: 5, Message: "a rule needs a term or a pattern"}},
+		},
+		{
+			name:      "duplicate term",
+			config:    "rules:\n  - term: foo\n  - term: foo\n",
+			wantRules: 1,
+			wantErrs:  []ConfigError{{Line: 3, Column: 11, Message: `term "foo" is listed twice`}},
+		},
+		{
+			name:     "bad glob",
+			config:   "rules:\n  - term: foo\n    include: ['[a']\n",
+			wantErrs: []ConfigError{{Line: 3, Column: 15, Message: `invalid glob "[a"`}},
+		},
+		{
+			name:     "not a bool",
+			config:   "rules:\n  - term: foo\n    ignoreCase: maybe\n",
+			wantErrs: []ConfigError{{Line: 3, Column: 17, Message: "expected true or false"}},
+		},
+		{
+			name:     "blank term",
+			config:   "rules:\n  - term: ' '\n",
+			wantErrs: []ConfigError{{Line: 2, Column: 11, Message: "term is blank"}},
+		},
+		{
+			name:     "unknown rule key",
+			config:   "rules:\n  - term: foo\n    level: 1\n",
+			wantErrs: []ConfigError{{Line: 3, Column: 5, Message: `unknown rule key "level"`}},
+		},
+		{
+			name:     "plugin without command",
+			config:   "plugins:\n  - name: x\n",
+			wantErrs: []ConfigError{{Line: 2, Column: 5, Message: "a plugin needs a command"}},
+		},
+		{
+			name:     "duplicate plugin",
+			config:   "plugins:\n  - name: x\n    command: x\n  - name: x\n    command: y\n",
+			wantErrs: []ConfigError{{Line: 4, Column: 11, Message: `plugin "x" is listed twice`}},
+		},
+		{
+			name:     "bad timeout",
+			config:   "plugins:\n  - name: x\n    command: x\n    timeout: soon\n",
+			wantErrs: []ConfigError{{Line: 4, Column: 14, Message: `invalid timeout "soon"; use a duration such as 5s`}},
+		},
+		{
+			name:     "bad concurrency",
+			config:   "pluginConcurrency: 0\n",
+			wantErrs: []ConfigError{{Line: 1, Column: 20, Message: "pluginConcurrency must be a positive number"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, errs := ParseConfig([]byte(tt.config))
+			if tt.wantNil {
+				require.Nil(t, cfg)
+			} else {
+				require.Len(t, cfg.Rules, tt.wantRules)
+			}
+			require.Len(t, errs, len(tt.wantErrs))
+			for i, want := range tt.wantErrs {
+				require.Equal(t, want.Line, errs[i].Line)
+				require.Equal(t, want.Column, errs[i].Column)
+				if want.Message != "" {
+					require.Equal(t, want.Message, errs[i].Message)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowText(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{name: "empty", config: "", want: "allow:\n  - foo\n"},
+		{
+			name:   "new list",
+			config: "# blocked terms\nrules:\n  - term: foo\n",
+			want:   "# blocked terms\nrules:\n  - term: foo\nallow:\n  - foo\n",
+		},
+		{
+			name:   "existing list",
+			config: "allow:\n  - bar\n",
+			want:   "allow:\n  - bar\n  - foo\n",
+		},
+		{
+			name:   "already allowed",
+			config: "allow: [foo]\n",
+			want:   "allow: [foo]\n",
+		},
+		{
+			name:   "comments and layout kept",
+			config: "allow:\n    # names\n    -   bar  # a name\n\n# rules follow\nrules: [] # none\n",
+			want:   "allow:\n    # names\n    -   bar  # a name\n    -   foo\n\n# rules follow\nrules: [] # none\n",
+		},
+		{
+			name:   "dash at the key's indent",
+			config: "allow:\n- bar\n",
+			want:   "allow:\n- bar\n- foo\n",
+		},
+		{
+			name:   "flow list",
+			config: "allow: [bar, 'b''az'] # names\n",
+			want:   "allow: [bar, 'b''az', foo] # names\n",
+		},
+		{
+			name:   "empty flow list",
+			config: "allow: []\n",
+			want:   "allow: [foo]\n",
+		},
+		{
+			name:   "empty list",
+			config: "allow: # names\nrules: []\n",
+			want:   "allow: # names\n  - foo\nrules: []\n",
+		},
+		{
+			name:   "no final newline",
+			config: "rules: []",
+			want:   "rules: []\nallow:\n  - foo\n",
+		},
+		{
+			name:   "line endings kept",
+			config: "allow:\r\n  - bar\r\n",
+			want:   "allow:\r\n  - bar\r\n  - foo\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AllowText([]byte(tt.config), "foo")
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(got))
+
+			cfg, errs := ParseConfig(got)
+			require.Empty(t, errs)
+			require.Contains(t, cfg.Allow, "foo")
+		})
+	}
+
+	_, err := AllowText([]byte("allow: foo\n"), "bar")
+	require.Error(t, err)
+}
+
+func TestAllowTextQuotes(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		text   string
+		want   string
+	}{
+		{name: "indicator", config: "allow:\n  - bar\n", text: "- foo", want: "allow:\n  - bar\n  - '- foo'\n"},
+		{name: "comma in a flow list", config: "allow: [bar]\n", text: "foo, bar", want: "allow: [bar, \"foo, bar\"]\n"},
+		{name: "newline", config: "allow:\n  - bar\n", text: "foo\nbar", want: "allow:\n  - bar\n  - \"foo\\nbar\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AllowText([]byte(tt.config), tt.text)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(got))
+
+			cfg, errs := ParseConfig(got)
+			require.Empty(t, errs)
+			require.Contains(t, cfg.Allow, tt.text)
+		})
+	}
+}
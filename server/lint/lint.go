@@ -0,0 +1,382 @@
+// Package lint finds the terms a workspace does not want used in its
+// documents.
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lsp/server/overlay"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// CodeBlockedTerm is the code of findings for rules that do not name one.
+const CodeBlockedTerm = "blocked-term"
+
+// Rule is one term or pattern the engine looks for. Terms are words or
+// phrases and match whole words only, whatever white space separates the
+// words of a phrase in the text. Patterns are regular expressions and
+// match wherever they do, unless WholeWord is set; a pattern's message
+// can refer to its capture groups as $1 or ${name}.
+type Rule struct {
+	Term    string
+	Pattern string
+	// IgnoreCase and IgnoreDiacritics fold the case and the accents of a
+	// term and of the text it is looked for in. Patterns fold case with
+	// (?i) instead.
+	IgnoreCase       bool
+	IgnoreDiacritics bool
+	WholeWord        bool
+	// Code identifies the rule in diagnostics. It defaults to
+	// CodeBlockedTerm.
+	Code     string
+	Severity lsp.DiagnosticSeverity
+	// Message is shown for every hit. It defaults to naming the match, and
+	// the replacements if there are any.
+	Message string
+	// Rationale explains why the rule exists, and URL links to where it is
+	// documented.
+	Rationale    string
+	URL          string
+	Replacements []string
+	// Include and Exclude are globs of the slash separated paths, relative
+	// to the workspace folder, the rule applies to. With no Include the
+	// rule applies everywhere.
+	Include []string
+	Exclude []string
+	// Disabled turns the rule off, such as one a pack adds.
+	Disabled bool
+}
+
+// Name is what the rule goes by in suppression directives: its term, or
+// its code for a pattern.
+func (r *Rule) Name() string {
+	if r.Term != "" {
+		return r.Term
+	}
+	return r.Code
+}
+
+// Named reports whether name refers to the rule, by its term or its code.
+func (r *Rule) Named(name string) bool {
+	return name != "" && (name == r.Term || name == r.Code)
+}
+
+// Applies reports whether the rule checks the file at rel. Documents that
+// are not workspace files have an empty rel and are only checked by rules
+// without an Include.
+func (r *Rule) Applies(rel string) bool {
+	if rel == "" {
+		return len(r.Include) == 0
+	}
+	included := len(r.Include) == 0
+	for _, glob := range r.Include {
+		if overlay.MatchGlob(glob, rel) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, glob := range r.Exclude {
+		if overlay.MatchGlob(glob, rel) {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultConfig is the blocklist used when a workspace has no
+// configuration of its own.
+func DefaultConfig() *Config {
+	return &Config{
+		Rules: []Rule{
+			{Term: "foo", Severity: lsp.Warning},
+			{Term: "bar", Severity: lsp.Warning},
+			{Term: "baz", Severity: lsp.Warning},
+		},
+		Prose: defaultProse(nil),
+	}
+}
+
+// Finding is one hit of a rule. Start and End are the byte offsets of the
+// matched text; Line and Column locate Start, counting from zero, Column
+// in bytes from the start of the line.
+type Finding struct {
+	Rule   *Rule
+	Start  int
+	End    int
+	Line   int
+	Column int
+	Match  string
+	// message is the rule's message with a pattern's capture groups
+	// filled in, or what a prose check says about the finding.
+	message string
+	// replacements are those a prose check suggests for the finding.
+	replacements []string
+}
+
+// Message describes the finding for the user.
+func (f Finding) Message() string {
+	if f.message != "" {
+		return f.message
+	}
+	if f.Rule.Message != "" {
+		return f.Rule.Message
+	}
+	if replacements := f.Replacements(); len(replacements) > 0 {
+		quoted := make([]string, len(replacements))
+		for i, r := range replacements {
+			quoted[i] = strconv.Quote(r)
+		}
+		return fmt.Sprintf("use %s instead of %q", strings.Join(quoted, " or "), f.Match)
+	}
+	return fmt.Sprintf("%q is a blocked term", f.Match)
+}
+
+// Replacements returns what the match could be replaced with.
+func (f Finding) Replacements() []string {
+	if f.replacements != nil {
+		return f.replacements
+	}
+	return f.Rule.Replacements
+}
+
+// Fix returns the text to replace the match with when there is exactly
+// one replacement, which makes the fix safe to apply unattended.
+func (f Finding) Fix() (string, bool) {
+	replacements := f.Replacements()
+	if len(replacements) != 1 {
+		return "", false
+	}
+	return replacements[0], true
+}
+
+// Report is what linting a document found.
+type Report struct {
+	Findings []Finding
+	// Unused lists the suppressions in the document that turned nothing
+	// off, so they can be cleaned up.
+	Unused []Unused
+}
+
+// Engine matches a fixed set of rules against documents. It is built once
+// for a set of rules and is safe for concurrent use.
+type Engine struct {
+	rules    []Rule
+	allow    map[string]bool
+	terms    map[fold]*termSet
+	folds    []fold
+	patterns []patternRule
+	prose    []*proseCheck
+	plugins  []Plugin
+	runner   *pluginRunner
+}
+
+// termSet is the terms of the rules that fold text the same way, with the
+// automaton that finds them all.
+type termSet struct {
+	rules []*Rule
+	ac    *automaton
+}
+
+type patternRule struct {
+	rule *Rule
+	re   *regexp.Regexp
+}
+
+// New compiles the rules of cfg into an engine.
+func New(cfg *Config) (*Engine, error) {
+	e := &Engine{
+		allow: map[string]bool{},
+		terms: map[fold]*termSet{},
+		// plugins run in goroutines, so they get a copy of their own
+		plugins: make([]Plugin, len(cfg.Plugins)),
+		runner:  newPluginRunner(cfg.PluginConcurrency),
+	}
+	for _, rule := range cfg.Rules {
+		if !rule.Disabled {
+			e.rules = append(e.rules, rule)
+		}
+	}
+	copy(e.plugins, cfg.Plugins)
+	names := map[string]bool{}
+	for i := range e.plugins {
+		p := &e.plugins[i]
+		switch {
+		case p.Name == "":
+			return nil, errors.Errorf("plugin %d has no name", i+1)
+		case names[p.Name]:
+			return nil, errors.Errorf("plugin %q is listed twice", p.Name)
+		case len(p.Command) == 0 || p.Command[0] == "":
+			return nil, errors.Errorf("plugin %q has no command", p.Name)
+		}
+		if err := validPluginGlobs(p); err != nil {
+			return nil, errors.Wrapf(err, "plugin %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	for _, text := range cfg.Allow {
+		e.allow[text] = true
+	}
+	prose, err := newProseChecks(cfg.Prose)
+	if err != nil {
+		return nil, err
+	}
+	e.prose = prose
+
+	seen := map[string]bool{}
+	folded := map[fold][]string{}
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if rule.Code == "" {
+			rule.Code = CodeBlockedTerm
+		}
+		if rule.Severity == 0 {
+			rule.Severity = lsp.Warning
+		}
+		switch {
+		case rule.Term != "" && rule.Pattern != "":
+			return nil, errors.Errorf("rule %d has both a term and a pattern", i+1)
+		case rule.Term != "":
+			if seen[rule.Term] {
+				return nil, errors.Errorf("term %q is listed twice", rule.Term)
+			}
+			seen[rule.Term] = true
+			f := foldOf(rule)
+			term := foldTerm(rule.Term, f)
+			if term == "" {
+				return nil, errors.Errorf("term of rule %d is blank", i+1)
+			}
+			if _, ok := e.terms[f]; !ok {
+				e.terms[f] = &termSet{}
+				e.folds = append(e.folds, f)
+			}
+			e.terms[f].rules = append(e.terms[f].rules, rule)
+			folded[f] = append(folded[f], term)
+		case rule.Pattern != "":
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "compiling pattern of rule %d", i+1)
+			}
+			e.patterns = append(e.patterns, patternRule{rule: rule, re: re})
+		default:
+			return nil, errors.Errorf("rule %d has no term or pattern", i+1)
+		}
+	}
+	for f, set := range e.terms {
+		set.ac = newAutomaton(folded[f])
+	}
+	return e, nil
+}
+
+// Rules returns the rules of the engine.
+func (e *Engine) Rules() []Rule {
+	return append([]Rule(nil), e.rules...)
+}
+
+// Lint returns every finding in text, in the order they appear, those of
+// the prose checks included. rel is the document's path as Rule.Applies
+// takes it. Allowed text and findings turned off by a directive are left
+// out.
+func (e *Engine) Lint(rel, text string) Report {
+	return e.lint(rel, text, nil)
+}
+
+// LintDocument is Lint with the findings of the plugins that have been run
+// on doc's text added in. Directives turn those off like any other.
+func (e *Engine) LintDocument(doc Document) Report {
+	return e.lint(doc.Path, doc.Text, e.pluginFindings(doc))
+}
+
+func (e *Engine) lint(rel, text string, extra []Finding) Report {
+	// rules with globs are checked against rel once, not once a match
+	applies := map[*Rule]bool{}
+	appliesTo := func(rule *Rule) bool {
+		ok, seen := applies[rule]
+		if !seen {
+			ok = rule.Applies(rel)
+			applies[rule] = ok
+		}
+		return ok
+	}
+
+	var findings []Finding
+	for _, f := range e.folds {
+		ft := foldText(text, f)
+		set := e.terms[f]
+		set.ac.scan(ft.text, func(id, i, j int) {
+			rule := set.rules[id]
+			start, end := ft.offsets[i], ft.offsets[j]
+			if !appliesTo(rule) || !isWordBoundary(text, start) || !isWordBoundary(text, end) || e.allow[text[start:end]] {
+				return
+			}
+			findings = append(findings, Finding{Rule: rule, Start: start, End: end, Match: text[start:end]})
+		})
+	}
+	for _, p := range e.patterns {
+		if !p.rule.Applies(rel) {
+			continue
+		}
+		for _, loc := range p.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if start == end || e.allow[text[start:end]] {
+				continue
+			}
+			if p.rule.WholeWord && (!isWordBoundary(text, start) || !isWordBoundary(text, end)) {
+				continue
+			}
+			finding := Finding{Rule: p.rule, Start: start, End: end, Match: text[start:end]}
+			if strings.Contains(p.rule.Message, "$") {
+				finding.message = string(p.re.ExpandString(nil, p.rule.Message, text, loc))
+			}
+			findings = append(findings, finding)
+		}
+	}
+	if len(e.prose) > 0 {
+		prose := blankCode(text)
+		for _, c := range e.prose {
+			if !appliesTo(c.rule) {
+				continue
+			}
+			for _, f := range c.find(prose, c) {
+				if !e.allow[f.Match] {
+					findings = append(findings, f)
+				}
+			}
+		}
+	}
+	for _, f := range extra {
+		if !e.allow[f.Match] {
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Start < findings[j].Start
+	})
+	findings, unused := suppress(text, findings)
+	locate(text, findings)
+	return Report{Findings: findings, Unused: unused}
+}
+
+// locate sets the line and column of findings, which are in order, in one
+// pass over text.
+func locate(text string, findings []Finding) {
+	line, lineStart, i := 0, 0, 0
+	for k := range findings {
+		for ; i < findings[k].Start; i++ {
+			if text[i] == '\n' || (text[i] == '\r' && (i+1 == len(text) || text[i+1] != '\n')) {
+				line++
+				lineStart = i + 1
+			}
+		}
+		findings[k].Line = line
+		findings[k].Column = findings[k].Start - lineStart
+	}
+}
@@ -0,0 +1,96 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	e, err := New(DefaultConfig())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		text string
+		want []Finding
+	}{
+		{name: "none", text: "nothing to see here"},
+		{name: "word", text: "a foo b", want: []Finding{{Start: 2, End: 5, Match: "foo"}}},
+		{name: "every hit", text: "bar\nbaz foo", want: []Finding{
+			{Start: 0, End: 3, Match: "bar"},
+			{Start: 4, End: 7, Match: "baz"},
+			{Start: 8, End: 11, Match: "foo"},
+		}},
+		{name: "whole words only", text: "food barn rebaz foo_bar"},
+		{name: "punctuation", text: "(foo).", want: []Finding{{Start: 1, End: 4, Match: "foo"}}},
+		{name: "case sensitive", text: "Foo BAR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := e.Lint("", tt.text).Findings
+			require.Len(t, got, len(tt.want))
+			for i, f := range got {
+				require.Equal(t, tt.want[i].Start, f.Start)
+				require.Equal(t, tt.want[i].End, f.End)
+				require.Equal(t, tt.want[i].Match, f.Match)
+				require.Equal(t, f.Match, f.Rule.Term)
+				require.Equal(t, CodeBlockedTerm, f.Rule.Code)
+				require.EqualValues(t, lsp.Warning, f.Rule.Severity)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(&Config{Rules: []Rule{{Term: ""}}})
+	require.Error(t, err)
+
+	_, err = New(&Config{Rules: []Rule{{Term: "foo"}, {Term: "foo"}}})
+	require.Error(t, err)
+
+	e, err := New(&Config{Rules: []Rule{{Term: "a.b", Code: "dotted", Severity: lsp.Error, Message: "no dots"}}})
+	require.NoError(t, err)
+	got := e.Lint("", "a.b axb").Findings
+	require.Len(t, got, 1)
+	require.Equal(t, "dotted", got[0].Rule.Code)
+	require.Equal(t, "no dots", got[0].Message())
+
+	e, err = New(&Config{})
+	require.NoError(t, err)
+	require.Empty(t, e.Lint("", "foo").Findings)
+}
+
+func TestLintPatternsAndGlobs(t *testing.T) {
+	e, err := New(&Config{Rules: []Rule{
+		{Term: "foo", Include: []string{"docs/"}, Exclude: []string{"CHANGELOG.md"}},
+		{Pattern: `TODO\(\w+\)`, Code: "todo"},
+	}})
+	require.NoError(t, err)
+
+	text := "TODO(ann) foo"
+	tests := []struct {
+		rel  string
+		want []string
+	}{
+		{rel: "docs/guide.txt", want: []string{"TODO(ann)", "foo"}},
+		{rel: "docs/CHANGELOG.md", want: []string{"TODO(ann)"}},
+		{rel: "notes.txt", want: []string{"TODO(ann)"}},
+		{rel: "", want: []string{"TODO(ann)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			var got []string
+			for _, f := range e.Lint(tt.rel, text).Findings {
+				got = append(got, f.Match)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err = New(&Config{Rules: []Rule{{Term: "a", Pattern: "b"}}})
+	require.Error(t, err)
+	_, err = New(&Config{Rules: []Rule{{Pattern: "("}}})
+	require.Error(t, err)
+}
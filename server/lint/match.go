@@ -0,0 +1,213 @@
+package lint
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// fold says how text is normalized before terms are looked for in it.
+// Whatever the fold, every run of white space, line breaks included, reads
+// as a single space, so phrases match however they are wrapped.
+type fold uint8
+
+const (
+	foldCase fold = 1 << iota
+	foldDiacritics
+)
+
+// foldOf returns the fold a rule asks for.
+func foldOf(r *Rule) fold {
+	var f fold
+	if r.IgnoreCase {
+		f |= foldCase
+	}
+	if r.IgnoreDiacritics {
+		f |= foldDiacritics
+	}
+	return f
+}
+
+// folded is a text after folding, with the offset in the original text of
+// every byte in it. offsets has one more entry than text, for its end.
+type folded struct {
+	text    string
+	offsets []int
+}
+
+func foldText(text string, f fold) folded {
+	out := make([]byte, 0, len(text))
+	offsets := make([]int, 0, len(text)+1)
+	space := false
+	for i := 0; i < len(text); {
+		c := text[i]
+		if c < utf8.RuneSelf {
+			// ASCII, most of most documents, needs no decoding
+			switch {
+			case c == ' ' || (c >= '\t' && c <= '\r'):
+				if !space {
+					out = append(out, ' ')
+					offsets = append(offsets, i)
+				}
+				space = true
+			case f&foldCase != 0 && c >= 'A' && c <= 'Z':
+				out = append(out, c+'a'-'A')
+				offsets = append(offsets, i)
+				space = false
+			default:
+				out = append(out, c)
+				offsets = append(offsets, i)
+				space = false
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsSpace(r) {
+			if !space {
+				out = append(out, ' ')
+				offsets = append(offsets, i)
+			}
+			space = true
+			i += size
+			continue
+		}
+		space = false
+		if r, keep := foldRune(r, f); keep {
+			var buf [utf8.UTFMax]byte
+			n := utf8.EncodeRune(buf[:], r)
+			out = append(out, buf[:n]...)
+			for j := 0; j < n; j++ {
+				offsets = append(offsets, i)
+			}
+		}
+		i += size
+	}
+	offsets = append(offsets, len(text))
+	return folded{text: string(out), offsets: offsets}
+}
+
+// foldTerm folds a term the way the text it is looked for in is folded,
+// dropping white space at its ends.
+func foldTerm(term string, f fold) string {
+	return strings.TrimSpace(foldText(term, f).text)
+}
+
+// foldRune folds one rune. Marks are dropped when folding diacritics, so
+// decomposed letters fold like precomposed ones.
+func foldRune(r rune, f fold) (rune, bool) {
+	if f&foldDiacritics != 0 {
+		if unicode.Is(unicode.Mn, r) {
+			return 0, false
+		}
+		if base, ok := diacriticBase[r]; ok {
+			r = base
+		}
+	}
+	if f&foldCase != 0 {
+		r = unicode.ToLower(unicode.ToUpper(r))
+	}
+	return r, true
+}
+
+// diacriticBase maps the precomposed letters of the Latin-1, Latin
+// Extended-A and Greek blocks to the letter without its diacritic.
+var diacriticBase = map[rune]rune{}
+
+func init() {
+	for base, letters := range map[rune]string{
+		'A': "ÀÁÂÃÄÅĀĂĄ", 'a': "àáâãäåāăą",
+		'C': "ÇĆĈĊČ", 'c': "çćĉċč",
+		'D': "ĎĐ", 'd': "ďđ",
+		'E': "ÈÉÊËĒĔĖĘĚ", 'e': "èéêëēĕėęě",
+		'G': "ĜĞĠĢ", 'g': "ĝğġģ",
+		'H': "ĤĦ", 'h': "ĥħ",
+		'I': "ÌÍÎÏĨĪĬĮİ", 'i': "ìíîïĩīĭįı",
+		'J': "Ĵ", 'j': "ĵ",
+		'K': "Ķ", 'k': "ķ",
+		'L': "ĹĻĽĿŁ", 'l': "ĺļľŀł",
+		'N': "ÑŃŅŇ", 'n': "ñńņň",
+		'O': "ÒÓÔÕÖØŌŎŐ", 'o': "òóôõöøōŏő",
+		'R': "ŔŖŘ", 'r': "ŕŗř",
+		'S': "ŚŜŞŠ", 's': "śŝşš",
+		'T': "ŢŤŦ", 't': "ţťŧ",
+		'U': "ÙÚÛÜŨŪŬŮŰŲ", 'u': "ùúûüũūŭůűų",
+		'W': "Ŵ", 'w': "ŵ",
+		'Y': "ÝŶŸ", 'y': "ýÿŷ",
+		'Z': "ŹŻŽ", 'z': "źżž",
+		'Α': "Ά", 'α': "ά",
+		'Ε': "Έ", 'ε': "έ",
+		'Η': "Ή", 'η': "ή",
+		'Ι': "ΊΪ", 'ι': "ίϊΐ",
+		'Ο': "Ό", 'ο': "ό",
+		'Υ': "ΎΫ", 'υ': "ύϋΰ",
+		'Ω': "Ώ", 'ω': "ώ",
+	} {
+		for _, r := range letters {
+			diacriticBase[r] = base
+		}
+	}
+}
+
+// isWordBoundary reports whether a word may start or end at offset i of
+// text, following the word boundary rules of Unicode Standard Annex #29
+// short of dictionary segmentation: letters, digits, marks and connectors
+// such as _ make up words, an apostrophe or a full stop between two
+// letters does not end one, and neither does a comma or a full stop
+// between two digits. Ideographs and the scripts written without spaces
+// are words of one character each.
+func isWordBoundary(text string, i int) bool {
+	if i <= 0 || i >= len(text) {
+		return true
+	}
+	prev, n := utf8.DecodeLastRuneInString(text[:i])
+	next, m := utf8.DecodeRuneInString(text[i:])
+	if unicode.In(next, unicode.Mn, unicode.Mc, unicode.Me, unicode.Cf) {
+		// marks and format characters belong with what precedes them
+		return false
+	}
+	if isWordRune(prev) && isWordRune(next) {
+		return breaksAlways(prev) || breaksAlways(next)
+	}
+
+	// a separator between two letters, or between two digits, that does
+	// not break the word they make up
+	before, _ := utf8.DecodeLastRuneInString(text[:i-n])
+	after, _ := utf8.DecodeRuneInString(text[i+m:])
+	switch {
+	case isMidLetter(next):
+		return !joinsAcross(prev, next, after)
+	case isMidLetter(prev):
+		return !joinsAcross(before, prev, next)
+	}
+	return true
+}
+
+// joinsAcross reports whether the letters or digits a and b make up one
+// word across the separator mid.
+func joinsAcross(a, mid, b rune) bool {
+	letters := unicode.IsLetter(a) && unicode.IsLetter(b) && isMidLetter(mid) && mid != ',' && mid != ';'
+	digits := unicode.IsDigit(a) && unicode.IsDigit(b) && (mid == '.' || mid == ',' || mid == ';' || mid == '\'' || mid == '’')
+	return letters || digits
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.In(r, unicode.Mn, unicode.Mc, unicode.Pc)
+}
+
+// isMidLetter reports whether r is one of the separators that can join the
+// parts of a word.
+func isMidLetter(r rune) bool {
+	switch r {
+	case '\'', '’', '‘', '.', '·', '‧', ',', ';':
+		return true
+	}
+	return false
+}
+
+// breaksAlways reports whether r is written without spaces between words,
+// so that each character counts as a word of its own.
+func breaksAlways(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar)
+}
@@ -0,0 +1,71 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintUnicode(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		text string
+		want []string
+	}{
+		{name: "accented term", rule: Rule{Term: "café"}, text: "a café, cafés", want: []string{"café"}},
+		{name: "accent is not a boundary", rule: Rule{Term: "caf"}, text: "café"},
+		{name: "non-latin script", rule: Rule{Term: "мир"}, text: "мир миру мир", want: []string{"мир", "мир"}},
+		{name: "case folding", rule: Rule{Term: "Straße", IgnoreCase: true}, text: "STRAßE straße", want: []string{"STRAßE", "straße"}},
+		{name: "case sensitive by default", rule: Rule{Term: "Café"}, text: "café"},
+		{name: "diacritic folding", rule: Rule{Term: "naive", IgnoreDiacritics: true}, text: "naïve naive", want: []string{"naïve", "naive"}},
+		{name: "folded term", rule: Rule{Term: "Naïve", IgnoreCase: true, IgnoreDiacritics: true}, text: "NAIVE", want: []string{"NAIVE"}},
+		{name: "decomposed text", rule: Rule{Term: "cafe", IgnoreDiacritics: true}, text: "cafe\u0301!", want: []string{"cafe\u0301"}},
+		{name: "phrase across lines", rule: Rule{Term: "going  forward"}, text: "and going\r\n   forward, we", want: []string{"going\r\n   forward"}},
+		{name: "phrase needs every word", rule: Rule{Term: "going forward"}, text: "going forwards"},
+		{name: "apostrophe inside a word", rule: Rule{Term: "don"}, text: "don't don", want: []string{"don"}},
+		{name: "quotes around a word", rule: Rule{Term: "foo"}, text: "'foo'", want: []string{"foo"}},
+		{name: "digits with separators", rule: Rule{Term: "1"}, text: "1,000 1.5 1", want: []string{"1"}},
+		{name: "ideographs", rule: Rule{Term: "東京"}, text: "東京都", want: []string{"東京"}},
+		{name: "whole word pattern", rule: Rule{Pattern: `é\w*`, WholeWord: true}, text: "été té", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(&Config{Rules: []Rule{tt.rule}})
+			require.NoError(t, err)
+			var got []string
+			for _, f := range e.Lint("", tt.text).Findings {
+				got = append(got, tt.text[f.Start:f.End])
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPatternMessage(t *testing.T) {
+	e, err := New(&Config{Rules: []Rule{
+		{Pattern: `TODO\((?P<who>\w+)\)`, Message: "ask ${who} about this"},
+		{Pattern: `v(\d+)`, Message: "version $1 is gone"},
+	}})
+	require.NoError(t, err)
+	var got []string
+	for _, f := range e.Lint("", "TODO(ann) for v2").Findings {
+		got = append(got, f.Message())
+	}
+	require.Equal(t, []string{"ask ann about this", "version 2 is gone"}, got)
+}
+
+func TestIsWordBoundary(t *testing.T) {
+	text := "l'été, 3.14 foo_bar"
+	var got []int
+	for i := range text {
+		if isWordBoundary(text, i) {
+			got = append(got, i)
+		}
+	}
+	if isWordBoundary(text, len(text)) {
+		got = append(got, len(text))
+	}
+	// start, end of l'été, after the comma, 3.14, the space, foo_bar
+	require.Equal(t, []int{0, 7, 8, 9, 13, 14, 21}, got)
+}
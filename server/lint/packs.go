@@ -0,0 +1,126 @@
+package lint
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// packFiles are the rule packs built into the server, one YAML file each:
+//
+//	description: what the pack is for
+//	defaults:
+//	  code: misspelling
+//	  rationale: why these terms are flagged
+//	rules:
+//	  - term: teh
+//	    replacements: [the]
+//
+// Every rule takes the keys of defaults it does not set itself, and is
+// otherwise written as in a configuration file.
+//
+//go:embed packs/*.yaml
+var builtinPacks embed.FS
+
+// packFiles is where packs are read from, the built-in ones but in tests.
+var packFiles fs.FS = builtinPacks
+
+// Pack is a set of rules built into the server that a configuration file
+// can enable by name.
+type Pack struct {
+	Name        string
+	Description string
+}
+
+// Packs lists the rule packs built into the server by name.
+func Packs() []Pack {
+	entries, err := fs.ReadDir(packFiles, "packs")
+	if err != nil {
+		panic(err)
+	}
+	var packs []Pack
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+		file, err := readPack(name)
+		if err != nil {
+			panic(err)
+		}
+		packs = append(packs, Pack{Name: name, Description: file.Description})
+	}
+	sort.Slice(packs, func(i, j int) bool {
+		return packs[i].Name < packs[j].Name
+	})
+	return packs
+}
+
+// packFile is a rule pack as written.
+type packFile struct {
+	Description string      `yaml:"description"`
+	Defaults    yaml.Node   `yaml:"defaults"`
+	Rules       []yaml.Node `yaml:"rules"`
+}
+
+func readPack(name string) (*packFile, error) {
+	data, err := fs.ReadFile(packFiles, "packs/"+name+".yaml")
+	if err != nil {
+		return nil, errors.Errorf("unknown rule pack %q", name)
+	}
+	var file packFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrapf(err, "reading rule pack %s", name)
+	}
+	return &file, nil
+}
+
+// packRules returns the rules of a pack as nodes, with the pack's defaults
+// merged into each.
+func packRules(name string) ([]*yaml.Node, error) {
+	file, err := readPack(name)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]*yaml.Node, len(file.Rules))
+	for i := range file.Rules {
+		rules[i] = &file.Rules[i]
+		if file.Defaults.Kind == yaml.MappingNode {
+			rules[i] = mergeNodes(&file.Defaults, rules[i])
+		}
+	}
+	return rules, nil
+}
+
+// mergeNodes returns a mapping with the keys of over, and those of base
+// that over does not set. It sits where over does, so that mistakes in it
+// are reported there.
+func mergeNodes(base, over *yaml.Node) *yaml.Node {
+	if base.Kind != yaml.MappingNode || over.Kind != yaml.MappingNode {
+		return over
+	}
+	merged := *over
+	merged.Content = nil
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		if mappingValue(over, base.Content[i].Value) == nil {
+			merged.Content = append(merged.Content, base.Content[i], base.Content[i+1])
+		}
+	}
+	merged.Content = append(merged.Content, over.Content...)
+	return &merged
+}
+
+// mappingValue returns the value of key in a mapping, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
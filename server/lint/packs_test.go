@@ -0,0 +1,131 @@
+package lint
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacks(t *testing.T) {
+	packs := Packs()
+	require.NotEmpty(t, packs)
+
+	var names []string
+	for _, pack := range packs {
+		require.NotEmpty(t, pack.Description, pack.Name)
+		names = append(names, pack.Name)
+
+		cfg, errs := ParseConfig([]byte(fmt.Sprintf("packs: [%s]\n", pack.Name)))
+		require.Empty(t, errs, pack.Name)
+		require.NotEmpty(t, cfg.Rules, pack.Name)
+		for _, rule := range cfg.Rules {
+			require.NotEmpty(t, rule.Rationale, rule.Term)
+			require.NotEmpty(t, rule.Code, rule.Term)
+		}
+	}
+
+	// every pack can be enabled at once
+	cfg, errs := ParseConfig([]byte(fmt.Sprintf("packs: [%s]\n", strings.Join(names, ", "))))
+	require.Empty(t, errs)
+	require.Equal(t, names, cfg.Packs)
+	_, err := New(cfg)
+	require.NoError(t, err)
+}
+
+func TestParseConfigPacks(t *testing.T) {
+	cfg, errs := ParseConfig([]byte(`packs: product-names
+rules:
+  - term: Github
+    severity: error
+  - term: Wifi
+    disabled: true
+  - term: foo
+`))
+	require.Empty(t, errs)
+	engine, err := New(cfg)
+	require.NoError(t, err)
+
+	findings := engine.Lint("", "Github and Wifi and foo and Javascript").Findings
+	require.Equal(t, []string{"Github", "foo", "Javascript"}, matches(findings))
+
+	// overriding keeps what the rule does not set
+	github := findings[0]
+	require.EqualValues(t, lsp.Error, github.Rule.Severity)
+	require.Equal(t, "product-name", github.Rule.Code)
+	require.NotEmpty(t, github.Rule.Rationale)
+	require.Equal(t, `use "GitHub" instead of "Github"`, github.Message())
+	fix, ok := github.Fix()
+	require.True(t, ok)
+	require.Equal(t, "GitHub", fix)
+
+	require.EqualValues(t, lsp.Warning, findings[2].Rule.Severity)
+}
+
+func TestParseConfigPackErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		wantErrs []ConfigError
+	}{
+		{
+			name:     "unknown pack",
+			config:   "packs: [profanity, slang]\n",
+			wantErrs: []ConfigError{{Line: 1, Column: 20}},
+		},
+		{
+			name:     "listed twice",
+			config:   "packs: [profanity, profanity]\n",
+			wantErrs: []ConfigError{{Line: 1, Column: 20, Message: `rule pack "profanity" is listed twice`}},
+		},
+		{
+			name:     "not a list",
+			config:   "packs: {profanity: true}\n",
+			wantErrs: []ConfigError{{Line: 1, Column: 8, Message: "expected a list of rule packs"}},
+		},
+		{
+			name:     "bad override",
+			config:   "packs: [profanity]\nrules:\n  - term: damn\n    severity: severe\n",
+			wantErrs: []ConfigError{{Line: 4, Column: 15}},
+		},
+		{
+			name:     "overridden twice",
+			config:   "packs: [profanity]\nrules:\n  - term: damn\n  - term: damn\n",
+			wantErrs: []ConfigError{{Line: 4, Column: 11, Message: `term "damn" is listed twice`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := ParseConfig([]byte(tt.config))
+			require.Len(t, errs, len(tt.wantErrs))
+			for i, want := range tt.wantErrs {
+				require.Equal(t, want.Line, errs[i].Line)
+				require.Equal(t, want.Column, errs[i].Column)
+				if want.Message != "" {
+					require.Equal(t, want.Message, errs[i].Message)
+				}
+			}
+		})
+	}
+	_, errs := ParseConfig([]byte("packs: [slang]\n"))
+	require.Contains(t, errs[0].Message, `unknown rule pack "slang"; use one of inclusive-language, misspellings, product-names, profanity`)
+}
+
+func TestParseConfigPackRuleErrors(t *testing.T) {
+	defer func(files fs.FS) { packFiles = files }(packFiles)
+	packFiles = fstest.MapFS{
+		"packs/one.yaml": {Data: []byte("description: one\nrules:\n  - term: foo\n  - term: bar\n    severity: severe\n")},
+		"packs/two.yaml": {Data: []byte("description: two\nrules:\n  - term: foo\n")},
+	}
+
+	cfg, errs := ParseConfig([]byte("# packs\npacks:\n  - one\n  - two\n"))
+	require.Len(t, errs, 2)
+	// both at the entries of the packs, not where the packs have them
+	require.Equal(t, ConfigError{Line: 3, Column: 5, Message: `rule pack "one": unknown severity "severe"; use error, warning, information or hint`}, *errs[0])
+	require.Equal(t, ConfigError{Line: 4, Column: 5, Message: `rule pack "two": term "foo" is listed twice`}, *errs[1])
+	require.Len(t, cfg.Rules, 1)
+}
@@ -0,0 +1,448 @@
+package lint
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"lsp/server/overlay"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+const (
+	// DefaultPluginTimeout bounds a plugin run that sets no timeout.
+	DefaultPluginTimeout = 10 * time.Second
+	// DefaultPluginConcurrency is how many plugins run at once unless the
+	// configuration says otherwise.
+	DefaultPluginConcurrency = 4
+	// pluginCacheSize is how many plugin results are kept.
+	pluginCacheSize = 512
+)
+
+// Plugin is an external command that checks documents. It is run in the
+// workspace folder with the document's text on stdin, and is told about
+// the document through the environment:
+//
+//	PLAINTEXT_LINT_URI          the document URI
+//	PLAINTEXT_LINT_LANGUAGE_ID  its language ID
+//	PLAINTEXT_LINT_PATH         its path within the folder, if it has one
+//
+// ${uri}, ${languageId} and ${path} in its arguments are replaced the
+// same way. It writes its diagnostics to stdout as JSON, either a list or
+// an object with a "diagnostics" list, each one like
+//
+//	{"line": 0, "column": 4, "endLine": 0, "endColumn": 9,
+//	 "severity": "warning", "code": "house-style", "message": "...",
+//	 "replacements": ["..."]}
+//
+// with lines and columns counted from zero, columns in characters, or with
+// "start" and "end" byte offsets instead. Its exit status is ignored as
+// long as it writes valid output, since many checkers exit non-zero when
+// they find something.
+type Plugin struct {
+	Name    string
+	Command []string
+	Timeout time.Duration
+	// Languages limits the plugin to documents with these language IDs.
+	Languages []string
+	Include   []string
+	Exclude   []string
+}
+
+// Applies reports whether the plugin checks a document.
+func (p *Plugin) Applies(doc Document) bool {
+	if len(p.Languages) > 0 && !contains(p.Languages, doc.LanguageID) {
+		return false
+	}
+	rule := Rule{Include: p.Include, Exclude: p.Exclude}
+	return rule.Applies(doc.Path)
+}
+
+// Document is what plugins are given to check.
+type Document struct {
+	URI        string
+	LanguageID string
+	// Path is the slash separated path within the workspace folder, empty
+	// if the document is not a workspace file.
+	Path string
+	// Dir is the workspace folder plugins run in.
+	Dir  string
+	Text string
+}
+
+func (d Document) hash() string {
+	sum := sha256.Sum256([]byte(d.Text))
+	return hex.EncodeToString(sum[:])
+}
+
+// pluginKey identifies one run of a plugin. Output may depend on the URI
+// and language as much as on the text.
+type pluginKey struct {
+	plugin     int
+	uri        string
+	languageID string
+	hash       string
+}
+
+// pluginRunner runs an engine's plugins, at most so many at a time, and
+// remembers what they found by content hash.
+type pluginRunner struct {
+	sem chan struct{}
+
+	mu      sync.Mutex
+	cache   map[pluginKey][]Finding
+	order   []pluginKey
+	running map[pluginKey]chan struct{}
+}
+
+func newPluginRunner(concurrency int) *pluginRunner {
+	if concurrency <= 0 {
+		concurrency = DefaultPluginConcurrency
+	}
+	return &pluginRunner{
+		sem:     make(chan struct{}, concurrency),
+		cache:   map[pluginKey][]Finding{},
+		running: map[pluginKey]chan struct{}{},
+	}
+}
+
+func (r *pluginRunner) cached(key pluginKey) ([]Finding, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	findings, ok := r.cache[key]
+	return findings, ok
+}
+
+func (r *pluginRunner) store(key pluginKey, findings []Finding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.cache[key]; !ok {
+		r.order = append(r.order, key)
+		if len(r.order) > pluginCacheSize {
+			delete(r.cache, r.order[0])
+			r.order = r.order[1:]
+		}
+	}
+	r.cache[key] = findings
+}
+
+// PendingPlugins reports whether some plugin that checks doc has not yet
+// been run on its current text.
+func (e *Engine) PendingPlugins(doc Document) bool {
+	hash := doc.hash()
+	for i := range e.plugins {
+		if !e.plugins[i].Applies(doc) {
+			continue
+		}
+		if _, ok := e.runner.cached(pluginKey{i, doc.URI, doc.LanguageID, hash}); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RunPlugins runs every plugin that checks doc and has not yet been run on
+// its text, and waits for them. It returns the errors of the runs that
+// failed; those count as finding nothing, so a broken plugin is not run
+// again on every keystroke.
+func (e *Engine) RunPlugins(ctx context.Context, doc Document) []error {
+	hash := doc.hash()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	for i := range e.plugins {
+		p := &e.plugins[i]
+		if !p.Applies(doc) {
+			continue
+		}
+		key := pluginKey{i, doc.URI, doc.LanguageID, hash}
+		if _, ok := e.runner.cached(key); ok {
+			continue
+		}
+
+		e.runner.mu.Lock()
+		if done, ok := e.runner.running[key]; ok {
+			// another caller is running it already
+			e.runner.mu.Unlock()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-done
+			}()
+			continue
+		}
+		done := make(chan struct{})
+		e.runner.running[key] = done
+		e.runner.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			findings, err := e.runner.run(ctx, p, doc)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, errors.Wrapf(err, "running plugin %s", p.Name))
+				mu.Unlock()
+			}
+			e.runner.store(key, findings)
+			e.runner.mu.Lock()
+			delete(e.runner.running, key)
+			e.runner.mu.Unlock()
+			close(done)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// pluginFindings returns what the plugins that check doc found in its
+// text, as far as they have been run.
+func (e *Engine) pluginFindings(doc Document) []Finding {
+	hash := doc.hash()
+	var findings []Finding
+	for i := range e.plugins {
+		if !e.plugins[i].Applies(doc) {
+			continue
+		}
+		cached, _ := e.runner.cached(pluginKey{i, doc.URI, doc.LanguageID, hash})
+		findings = append(findings, cached...)
+	}
+	return findings
+}
+
+// run runs one plugin on doc once a slot is free.
+func (r *pluginRunner) run(ctx context.Context, p *Plugin, doc Document) ([]Finding, error) {
+	select {
+	case r.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-r.sem }()
+
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultPluginTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	vars := strings.NewReplacer("${uri}", doc.URI, "${languageId}", doc.LanguageID, "${path}", doc.Path)
+	args := make([]string, len(p.Command))
+	for i, arg := range p.Command {
+		args[i] = vars.Replace(arg)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = doc.Dir
+	cmd.Env = append(os.Environ(),
+		"PLAINTEXT_LINT_URI="+doc.URI,
+		"PLAINTEXT_LINT_LANGUAGE_ID="+doc.LanguageID,
+		"PLAINTEXT_LINT_PATH="+doc.Path,
+	)
+	cmd.Stdin = strings.NewReader(doc.Text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	newProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "starting")
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Killing the command is not enough to be done with it: anything it
+		// started may hold its output open, and Wait would wait for that
+		// too. Where it can, the whole process group is killed; either way
+		// the rest is left to the goroutine.
+		killProcessGroup(cmd)
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, errors.Errorf("timed out after %s", timeout)
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil && stdout.Len() == 0 {
+		return nil, errors.Wrapf(err, "%s", strings.TrimSpace(stderr.String()))
+	}
+	return parsePluginOutput(p, doc.Text, stdout.Bytes())
+}
+
+// pluginDiagnostic is one diagnostic as a plugin writes it.
+type pluginDiagnostic struct {
+	Start        *int            `json:"start"`
+	End          *int            `json:"end"`
+	Line         *int            `json:"line"`
+	Column       int             `json:"column"`
+	EndLine      *int            `json:"endLine"`
+	EndColumn    *int            `json:"endColumn"`
+	Severity     json.RawMessage `json:"severity"`
+	Code         string          `json:"code"`
+	Message      string          `json:"message"`
+	Replacements []string        `json:"replacements"`
+}
+
+// parsePluginOutput turns a plugin's output into findings in text.
+func parsePluginOutput(p *Plugin, text string, out []byte) ([]Finding, error) {
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return nil, nil
+	}
+	var diagnostics []pluginDiagnostic
+	if out[0] == '{' {
+		var wrapped struct {
+			Diagnostics []pluginDiagnostic `json:"diagnostics"`
+		}
+		if err := json.Unmarshal(out, &wrapped); err != nil {
+			return nil, errors.Wrap(err, "decoding output")
+		}
+		diagnostics = wrapped.Diagnostics
+	} else if err := json.Unmarshal(out, &diagnostics); err != nil {
+		return nil, errors.Wrap(err, "decoding output")
+	}
+
+	starts := lineStarts(text)
+	var findings []Finding
+	for i, d := range diagnostics {
+		start, end, err := d.offsets(text, starts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "diagnostic %d", i+1)
+		}
+		severity, err := pluginSeverity(d.Severity)
+		if err != nil {
+			return nil, errors.Wrapf(err, "diagnostic %d", i+1)
+		}
+		code := d.Code
+		if code == "" {
+			code = p.Name
+		}
+		message := d.Message
+		if message == "" {
+			message = fmt.Sprintf("%s flagged %q", p.Name, text[start:end])
+		}
+		findings = append(findings, Finding{
+			Rule: &Rule{
+				Code:         code,
+				Severity:     severity,
+				Message:      message,
+				Replacements: d.Replacements,
+			},
+			Start: start,
+			End:   end,
+			Match: text[start:end],
+		})
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Start < findings[j].Start
+	})
+	return findings, nil
+}
+
+// offsets returns the byte offsets a diagnostic covers in text. A
+// diagnostic without an end covers the rest of its line.
+func (d pluginDiagnostic) offsets(text string, starts []int) (int, int, error) {
+	if d.Start != nil {
+		start := *d.Start
+		end := start
+		if d.End != nil {
+			end = *d.End
+		}
+		if start < 0 || end < start || end > len(text) || !utf8.RuneStart(byteAt(text, start)) || !utf8.RuneStart(byteAt(text, end)) {
+			return 0, 0, errors.Errorf("offsets %d to %d are not in the document", start, end)
+		}
+		return start, end, nil
+	}
+	if d.Line == nil {
+		return 0, 0, errors.New("no start or line")
+	}
+	start, err := lineColumn(text, starts, *d.Line, d.Column)
+	if err != nil {
+		return 0, 0, err
+	}
+	endLine := *d.Line
+	if d.EndLine != nil {
+		endLine = *d.EndLine
+	}
+	endColumn := len(text)
+	if d.EndColumn != nil {
+		endColumn = *d.EndColumn
+	}
+	end, err := lineColumn(text, starts, endLine, endColumn)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, errors.New("ends before it starts")
+	}
+	return start, end, nil
+}
+
+func byteAt(text string, i int) byte {
+	if i >= len(text) {
+		// the end of the text is a rune boundary
+		return 0
+	}
+	return text[i]
+}
+
+// lineColumn returns the offset of a zero based line and character column,
+// clamping a column past the end of its line.
+func lineColumn(text string, starts []int, line, column int) (int, error) {
+	if line < 0 || line >= len(starts) || column < 0 {
+		return 0, errors.Errorf("line %d column %d is not in the document", line, column)
+	}
+	offset := starts[line]
+	for ; column > 0 && offset < len(text); column-- {
+		if text[offset] == '\n' || text[offset] == '\r' {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		offset += size
+	}
+	return offset, nil
+}
+
+func pluginSeverity(raw json.RawMessage) (lsp.DiagnosticSeverity, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return lsp.Warning, nil
+	}
+	var n int
+	if err := json.Unmarshal(raw, &n); err == nil {
+		if n < int(lsp.Error) || n > int(lsp.Hint) {
+			return 0, errors.Errorf("unknown severity %d", n)
+		}
+		return lsp.DiagnosticSeverity(n), nil
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return 0, errors.Errorf("unknown severity %s", raw)
+	}
+	severity, ok := severities[strings.ToLower(name)]
+	if !ok {
+		return 0, errors.Errorf("unknown severity %q", name)
+	}
+	return severity, nil
+}
+
+// validPluginGlobs reports the first malformed glob of a plugin.
+func validPluginGlobs(p *Plugin) error {
+	for _, glob := range append(append([]string(nil), p.Include...), p.Exclude...) {
+		if !overlay.ValidGlob(glob) {
+			return errors.Errorf("invalid glob %q", glob)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package lint
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePluginOutput(t *testing.T) {
+	const text = "héllo world\nsecond line\n"
+	tests := []struct {
+		name    string
+		out     string
+		want    []Finding
+		wantErr string
+	}{
+		{name: "nothing", out: "  \n"},
+		{name: "empty list", out: "[]"},
+		{
+			name: "line and column in characters",
+			out:  `[{"line": 0, "column": 1, "endLine": 0, "endColumn": 5, "severity": "error", "code": "e", "message": "no"}]`,
+			want: []Finding{{
+				Rule:  &Rule{Code: "e", Severity: lsp.Error, Message: "no"},
+				Start: 1, End: 6, Match: "éllo",
+			}},
+		},
+		{
+			name: "rest of line",
+			out:  `{"diagnostics": [{"line": 1, "column": 7, "severity": 3}]}`,
+			want: []Finding{{
+				Rule:  &Rule{Code: "check", Severity: lsp.Information, Message: `check flagged "line"`},
+				Start: 20, End: 24, Match: "line",
+			}},
+		},
+		{
+			name: "byte offsets",
+			out:  `[{"start": 7, "end": 12, "replacements": ["earth"]}, {"start": 0, "end": 1}]`,
+			want: []Finding{
+				{Rule: &Rule{Code: "check", Severity: lsp.Warning, Message: `check flagged "h"`}, Start: 0, End: 1, Match: "h"},
+				{Rule: &Rule{Code: "check", Severity: lsp.Warning, Message: `check flagged "world"`, Replacements: []string{"earth"}}, Start: 7, End: 12, Match: "world"},
+			},
+		},
+		{name: "not json", out: "oops", wantErr: "decoding output"},
+		{name: "mid rune", out: `[{"start": 2, "end": 3}]`, wantErr: "not in the document"},
+		{name: "past the end", out: `[{"line": 9, "column": 0}]`, wantErr: "not in the document"},
+		{name: "no position", out: `[{"message": "?"}]`, wantErr: "no start or line"},
+		{name: "bad severity", out: `[{"start": 0, "severity": "fatal"}]`, wantErr: `unknown severity "fatal"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePluginOutput(&Plugin{Name: "check"}, text, []byte(tt.out))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// script writes an executable shell script to dir.
+func script(t *testing.T, dir, name, body string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755))
+	return path
+}
+
+func TestRunPlugins(t *testing.T) {
+	dir := t.TempDir()
+	// reports the word "draft", and counts its runs
+	script(t, dir, "drafts", `echo run >> runs
+grep -q draft || { echo '[]'; exit 0; }
+echo "[{\"line\": 0, \"column\": 0, \"endColumn\": 5, \"code\": \"$PLAINTEXT_LINT_LANGUAGE_ID\", \"message\": \"$1\"}]"
+exit 1
+`)
+	engine, err := New(&Config{
+		Rules:   []Rule{{Term: "foo"}},
+		Plugins: []Plugin{{Name: "drafts", Command: []string{"./drafts", "${path}"}}},
+	})
+	require.NoError(t, err)
+
+	doc := Document{URI: "file:///w/a.txt", LanguageID: "plaintext", Path: "a.txt", Dir: dir, Text: "draft with foo"}
+	require.Equal(t, []string{"foo"}, matches(engine.LintDocument(doc).Findings))
+	require.True(t, engine.PendingPlugins(doc))
+
+	require.Empty(t, engine.RunPlugins(context.Background(), doc))
+	require.False(t, engine.PendingPlugins(doc))
+	findings := engine.LintDocument(doc).Findings
+	require.Equal(t, []string{"draft", "foo"}, matches(findings))
+	require.Equal(t, "plaintext", findings[0].Rule.Code)
+	require.Equal(t, "a.txt", findings[0].Message())
+
+	// the same text is not checked twice
+	require.Empty(t, engine.RunPlugins(context.Background(), doc))
+	runs, err := os.ReadFile(filepath.Join(dir, "runs"))
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(runs), "run"))
+
+	// directives turn plugin findings off too
+	doc.Text = "draft <!-- plaintext-lint-disable-file plaintext -->\n"
+	require.Empty(t, engine.RunPlugins(context.Background(), doc))
+	require.Empty(t, engine.LintDocument(doc).Findings)
+
+	// Lint leaves plugins out
+	doc.Text = "draft with foo"
+	require.Equal(t, []string{"foo"}, matches(engine.Lint(doc.Path, doc.Text).Findings))
+}
+
+func TestRunPluginsErrors(t *testing.T) {
+	dir := t.TempDir()
+	script(t, dir, "slow", "sleep 5\n")
+	script(t, dir, "fails", "echo broken >&2\nexit 2\n")
+	engine, err := New(&Config{Plugins: []Plugin{
+		{Name: "slow", Command: []string{"./slow"}, Timeout: 100 * time.Millisecond},
+		{Name: "fails", Command: []string{"./fails"}},
+		{Name: "missing", Command: []string{"./missing"}},
+		{Name: "markdown", Command: []string{"./fails"}, Languages: []string{"markdown"}},
+	}})
+	require.NoError(t, err)
+
+	doc := Document{URI: "file:///w/a.txt", LanguageID: "plaintext", Dir: dir, Text: "text"}
+	start := time.Now()
+	errs := engine.RunPlugins(context.Background(), doc)
+	require.Less(t, int64(time.Since(start)), int64(4*time.Second))
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	require.Len(t, msgs, 3)
+	require.Contains(t, strings.Join(msgs, "\n"), "running plugin slow: timed out after 100ms")
+	require.Contains(t, strings.Join(msgs, "\n"), "running plugin fails: broken")
+
+	// failures count as having checked the text
+	require.False(t, engine.PendingPlugins(doc))
+	require.Empty(t, engine.LintDocument(doc).Findings)
+}
+
+func TestNewPluginErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		plugins []Plugin
+		wantErr string
+	}{
+		{name: "no name", plugins: []Plugin{{Command: []string{"x"}}}, wantErr: "plugin 1 has no name"},
+		{name: "no command", plugins: []Plugin{{Name: "x"}}, wantErr: `plugin "x" has no command`},
+		{
+			name:    "twice",
+			plugins: []Plugin{{Name: "x", Command: []string{"x"}}, {Name: "x", Command: []string{"y"}}},
+			wantErr: `plugin "x" is listed twice`,
+		},
+		{
+			name:    "bad glob",
+			plugins: []Plugin{{Name: "x", Command: []string{"x"}, Include: []string{"[a"}}},
+			wantErr: `invalid glob "[a"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(&Config{Plugins: tt.plugins})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func matches(findings []Finding) []string {
+	var out []string
+	for _, f := range findings {
+		out = append(out, f.Match)
+	}
+	return out
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package lint
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// newProcessGroup makes cmd start a process group of its own, so that
+// whatever it runs can be killed along with it.
+func newProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
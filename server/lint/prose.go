@@ -0,0 +1,503 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// The codes of the prose checks, which look at how a text is written
+// rather than at the terms in it.
+const (
+	CodeRepeatedWord = "repeated-word"
+	CodeLongSentence = "long-sentence"
+	CodeDoubleSpace  = "double-space"
+	CodePassiveVoice = "passive-voice"
+	CodeWeaselWord   = "weasel-word"
+	CodeCliche       = "cliche"
+)
+
+// DefaultMaxWords is how many words a sentence may have before the
+// long-sentence check flags it, unless the configuration says otherwise.
+const DefaultMaxWords = 40
+
+// Prose turns on one prose check. Code says which; the other fields are
+// the check's own defaults where they are zero.
+type Prose struct {
+	Code     string
+	Severity lsp.DiagnosticSeverity
+	// URL documents the check. It defaults to a page about what the check
+	// looks for.
+	URL      string
+	Disabled bool
+	// MaxWords is the longest sentence the long-sentence check lets be.
+	MaxWords int
+	Include  []string
+	Exclude  []string
+}
+
+// ProseCheck describes a built-in prose check.
+type ProseCheck struct {
+	Code        string
+	Description string
+	Severity    lsp.DiagnosticSeverity
+	URL         string
+	// Enabled is whether the check runs when a configuration file does not
+	// mention it. Checks of matters of taste are off until asked for.
+	Enabled bool
+	find    func(text string, c *proseCheck) []Finding
+}
+
+// proseChecks are the built-in prose checks, in the order ProseChecks
+// lists them.
+var proseChecks = []ProseCheck{
+	{
+		Code:        CodeRepeatedWord,
+		Description: `a word written twice in a row, as in "the the"`,
+		Severity:    lsp.Warning,
+		URL:         "https://en.wikipedia.org/wiki/Dittography",
+		Enabled:     true,
+		find:        findRepeatedWords,
+	},
+	{
+		Code:        CodeLongSentence,
+		Description: "a sentence with more words than maxWords",
+		Severity:    lsp.Information,
+		URL:         "https://en.wikipedia.org/wiki/Plain_language",
+		Enabled:     true,
+		find:        findLongSentences,
+	},
+	{
+		Code:        CodeDoubleSpace,
+		Description: "more than one space between words or sentences",
+		Severity:    lsp.Information,
+		URL:         "https://en.wikipedia.org/wiki/Sentence_spacing",
+		Enabled:     true,
+		find:        findDoubleSpaces,
+	},
+	{
+		Code:        CodePassiveVoice,
+		Description: `a form of "to be" followed by a past participle`,
+		Severity:    lsp.Information,
+		URL:         "https://en.wikipedia.org/wiki/English_passive_voice",
+		find:        findPassiveVoice,
+	},
+	{
+		Code:        CodeWeaselWord,
+		Description: "hedges and weasel words that weaken a claim without saying why",
+		Severity:    lsp.Information,
+		URL:         "https://en.wikipedia.org/wiki/Weasel_word",
+		find:        findWeaselWords,
+	},
+	{
+		Code:        CodeCliche,
+		Description: "an overused phrase",
+		Severity:    lsp.Information,
+		URL:         "https://en.wikipedia.org/wiki/Clich%C3%A9",
+		find:        findCliches,
+	},
+}
+
+// ProseChecks lists the built-in prose checks.
+func ProseChecks() []ProseCheck {
+	checks := make([]ProseCheck, len(proseChecks))
+	copy(checks, proseChecks)
+	for i := range checks {
+		checks[i].find = nil
+	}
+	return checks
+}
+
+func proseCheckOf(code string) (ProseCheck, bool) {
+	for _, c := range proseChecks {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return ProseCheck{}, false
+}
+
+// defaultProse turns on the checks that are on unless a configuration
+// file says otherwise, other than those it mentions.
+func defaultProse(mentioned []Prose) []Prose {
+	var prose []Prose
+	for _, c := range proseChecks {
+		if !c.Enabled {
+			continue
+		}
+		found := false
+		for _, p := range mentioned {
+			found = found || p.Code == c.Code
+		}
+		if !found {
+			prose = append(prose, Prose{Code: c.Code})
+		}
+	}
+	return prose
+}
+
+func proseCodes() []string {
+	codes := make([]string, len(proseChecks))
+	for i, c := range proseChecks {
+		codes[i] = c.Code
+	}
+	return codes
+}
+
+// proseCheck is a prose check as configured, with the rule its findings
+// are reported under.
+type proseCheck struct {
+	rule     *Rule
+	maxWords int
+	find     func(text string, c *proseCheck) []Finding
+}
+
+// newProseChecks returns the checks cfg turns on, as it configures them.
+func newProseChecks(cfg []Prose) ([]*proseCheck, error) {
+	byCode := map[string]Prose{}
+	for _, p := range cfg {
+		if _, ok := proseCheckOf(p.Code); !ok {
+			return nil, errors.Errorf("unknown prose check %q", p.Code)
+		}
+		if _, ok := byCode[p.Code]; ok {
+			return nil, errors.Errorf("prose check %q is listed twice", p.Code)
+		}
+		if p.MaxWords < 0 || p.MaxWords > 0 && p.Code != CodeLongSentence {
+			return nil, errors.Errorf("prose check %q has an invalid maxWords", p.Code)
+		}
+		byCode[p.Code] = p
+	}
+
+	var checks []*proseCheck
+	for _, builtin := range proseChecks {
+		p, ok := byCode[builtin.Code]
+		if !ok || p.Disabled {
+			continue
+		}
+		rule := &Rule{
+			Code:     builtin.Code,
+			Severity: builtin.Severity,
+			URL:      builtin.URL,
+			Include:  p.Include,
+			Exclude:  p.Exclude,
+		}
+		if p.Severity != 0 {
+			rule.Severity = p.Severity
+		}
+		if p.URL != "" {
+			rule.URL = p.URL
+		}
+		c := &proseCheck{rule: rule, maxWords: p.MaxWords, find: builtin.find}
+		if c.maxWords == 0 {
+			c.maxWords = DefaultMaxWords
+		}
+		checks = append(checks, c)
+	}
+	return checks, nil
+}
+
+// codeSpans matches fenced code blocks, closed or running to the end of the
+// text, and inline code, which prose checks leave alone.
+var codeSpans = regexp.MustCompile("(?ms)^[ \t]*(```|~~~).*?(^[ \t]*(```|~~~)[ \t]*$|\\z)|`+[^`\n]+?`+")
+
+// blankCode returns text with its code replaced by NUL bytes, keeping
+// every offset and line break where it was, so that the prose checks see
+// neither words nor spaces in it.
+func blankCode(text string) string {
+	spans := codeSpans.FindAllStringIndex(text, -1)
+	if len(spans) == 0 {
+		return text
+	}
+	b := []byte(text)
+	for _, span := range spans {
+		for i := span[0]; i < span[1]; i++ {
+			if b[i] != '\n' && b[i] != '\r' {
+				b[i] = 0
+			}
+		}
+	}
+	return string(b)
+}
+
+// proseWord is a word of the text at byte offsets [start, end).
+type proseWord struct {
+	start, end int
+}
+
+// proseWords returns the words of text: runs of letters and digits, with
+// apostrophes and hyphens inside them.
+func proseWords(text string) []proseWord {
+	var words []proseWord
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if !inWord && start >= 0 && (r == '\'' || r == '’' || r == '-') {
+			next, _ := utf8.DecodeRuneInString(text[i+utf8.RuneLen(r):])
+			inWord = unicode.IsLetter(next) || unicode.IsDigit(next)
+		}
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			words = append(words, proseWord{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, proseWord{start, len(text)})
+	}
+	return words
+}
+
+// findRepeatedWords flags a word that follows itself with only white space
+// between, whatever the case of either.
+func findRepeatedWords(text string, c *proseCheck) []Finding {
+	var findings []Finding
+	words := proseWords(text)
+	for i := 1; i < len(words); i++ {
+		prev, cur := words[i-1], words[i]
+		first, second := text[prev.start:prev.end], text[cur.start:cur.end]
+		if strings.TrimSpace(text[prev.end:cur.start]) != "" || !strings.EqualFold(first, second) {
+			continue
+		}
+		if unicode.IsDigit([]rune(first)[0]) {
+			// "1 1" is more likely data than a slip
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:         c.rule,
+			Start:        prev.start,
+			End:          cur.end,
+			Match:        text[prev.start:cur.end],
+			message:      fmt.Sprintf("%q is repeated", second),
+			replacements: []string{first},
+		})
+	}
+	return findings
+}
+
+// sentenceEnd matches where a sentence ends: after a full stop, question
+// or exclamation mark, with any closing quotes or brackets, followed by
+// white space; or at a blank line, as a heading or list item has no full
+// stop.
+var sentenceEnd = regexp.MustCompile(`[.!?]+["'’”)\]]*(\s|$)|\n[ \t]*\r?\n|\n[ \t]*([-*+#>]|\d+[.)])\s`)
+
+// findLongSentences flags every sentence with more than the configured
+// number of words.
+func findLongSentences(text string, c *proseCheck) []Finding {
+	var findings []Finding
+	check := func(start, end int) {
+		sentence := text[start:end]
+		words := proseWords(sentence)
+		if len(words) <= c.maxWords {
+			return
+		}
+		start, end = start+words[0].start, start+words[len(words)-1].end
+		if r, _ := utf8.DecodeRuneInString(text[end:]); strings.ContainsRune(".!?", r) {
+			end++
+		}
+		findings = append(findings, Finding{
+			Rule:    c.rule,
+			Start:   start,
+			End:     end,
+			Match:   text[start:end],
+			message: fmt.Sprintf("sentence has %d words, more than %d; consider splitting it", len(words), c.maxWords),
+		})
+	}
+	start := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(text, -1) {
+		check(start, loc[0])
+		start = loc[1]
+	}
+	check(start, len(text))
+	return findings
+}
+
+// findDoubleSpaces flags runs of spaces between two words or sentences.
+// Indentation, the spaces that end a line and those padding the cells of
+// a table are left alone, as they say nothing about the prose.
+func findDoubleSpaces(text string, c *proseCheck) []Finding {
+	var findings []Finding
+	for i := 0; i < len(text); i++ {
+		if text[i] != ' ' {
+			continue
+		}
+		end := i
+		for end < len(text) && text[end] == ' ' {
+			end++
+		}
+		start := i
+		i = end
+		if end-start < 2 || start == 0 || end == len(text) {
+			continue
+		}
+		before, after := text[start-1], text[end]
+		if isSpaceByte(before) || isSpaceByte(after) || before == '|' || after == '|' {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:         c.rule,
+			Start:        start,
+			End:          end,
+			Match:        text[start:end],
+			message:      fmt.Sprintf("%d spaces in a row", end-start),
+			replacements: []string{" "},
+		})
+	}
+	return findings
+}
+
+func isSpaceByte(b byte) bool {
+	return b == '\n' || b == '\r' || b == '\t' || b == ' '
+}
+
+// irregularParticiples are the past participles that do not end in -ed.
+var irregularParticiples = []string{
+	"arisen", "awoken", "beaten", "become", "begun", "bent", "bet", "bitten",
+	"bled", "blown", "bought", "bound", "bred", "broken", "brought", "built",
+	"burnt", "burst", "caught", "chosen", "come", "cut", "dealt", "done",
+	"drawn", "driven", "drunk", "dug", "eaten", "fallen", "fed", "felt",
+	"fought", "found", "fled", "flown", "forbidden", "forgiven", "forgotten",
+	"frozen", "given", "gone", "got", "gotten", "ground", "grown", "heard",
+	"held", "hidden", "hit", "hung", "hurt", "kept", "knelt", "known", "laid",
+	"led", "left", "lent", "let", "lit", "lost", "made", "meant", "met",
+	"overcome", "paid", "put", "quit", "read", "rid", "ridden", "rung",
+	"run", "said", "seen", "sent", "set", "sewn", "shaken", "shed", "shot",
+	"shown", "shut", "slain", "slid", "sold", "sought", "sown", "spent",
+	"spoken", "spread", "stolen", "struck", "stuck", "sung", "sunk", "swept",
+	"sworn", "swum", "taken", "taught", "thought", "thrown", "told", "torn",
+	"undergone", "understood", "upset", "withdrawn", "woken", "won", "worn",
+	"wound", "woven", "written",
+}
+
+// passiveVoice matches a form of "to be" followed by a past participle,
+// with at most one adverb between them. RE2's \b knows only ASCII, so
+// matches are kept to whole words with findWords instead.
+var passiveVoice = regexp.MustCompile(`(?i)(am|are|is|was|were|be|been|being)\s+([\pL\pM\pN_]+ly\s+)?([\pL\pM\pN_]+ed|` +
+	strings.Join(irregularParticiples, "|") + `)`)
+
+// notParticiples end in -ed but are adjectives more often than not.
+var notParticiples = map[string]bool{
+	"bed": true, "need": true, "red": true, "seed": true, "shed": true,
+	"speed": true, "feed": true, "indeed": true, "hundred": true,
+	"naked": true, "sacred": true, "wicked": true, "tired": true,
+}
+
+// findPassiveVoice flags likely passive constructions.
+func findPassiveVoice(text string, c *proseCheck) []Finding {
+	var findings []Finding
+	for _, loc := range findWords(passiveVoice, text) {
+		if notParticiples[strings.ToLower(text[loc[6]:loc[7]])] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:    c.rule,
+			Start:   loc[0],
+			End:     loc[1],
+			Match:   text[loc[0]:loc[1]],
+			message: fmt.Sprintf("%q may be passive voice; consider saying who does what", text[loc[0]:loc[1]]),
+		})
+	}
+	return findings
+}
+
+// weaselWords are hedges and vague qualifiers.
+var weaselWords = []string{
+	"a bit", "actually", "apparently", "arguably", "basically", "certainly",
+	"clearly", "essentially", "evidently", "experts agree", "extremely",
+	"fairly", "generally", "it has been said", "it is believed",
+	"it is said", "kind of", "largely", "many people", "mostly",
+	"obviously", "of course", "perhaps", "possibly", "practically",
+	"pretty much", "quite", "rather", "really", "relatively",
+	"research shows", "seemingly", "significantly", "simply", "so-called",
+	"some people", "some say", "somewhat", "sort of", "studies show",
+	"surely", "tend to", "to some extent", "totally", "very", "virtually",
+}
+
+// cliches are phrases worn out by use.
+var cliches = []string{
+	"a perfect storm", "at the end of the day", "at this point in time",
+	"avoid like the plague", "back to square one", "ballpark figure",
+	"best of breed", "bite the bullet", "circle back", "cutting edge",
+	"drink the kool-aid", "game changer", "going forward", "hit the ground running",
+	"in this day and age", "it goes without saying", "last but not least",
+	"leave no stone unturned", "level playing field", "low-hanging fruit",
+	"move the needle", "needless to say", "paradigm shift",
+	"par for the course", "push the envelope", "raise the bar",
+	"since the dawn of time", "take it to the next level",
+	"think outside the box", "tip of the iceberg", "touch base",
+	"when all is said and done", "win-win",
+}
+
+// phrasePattern matches any of phrases in any case and whatever white
+// space separates their words, longest first. findWords keeps the matches
+// that are whole words.
+func phrasePattern(phrases []string) *regexp.Regexp {
+	sorted := append([]string(nil), phrases...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	alternatives := make([]string, len(sorted))
+	for i, p := range sorted {
+		alternatives[i] = strings.Join(strings.Fields(regexp.QuoteMeta(p)), `\s+`)
+	}
+	return regexp.MustCompile(`(?i)(` + strings.Join(alternatives, "|") + `)`)
+}
+
+var (
+	weaselPattern = phrasePattern(weaselWords)
+	clichePattern = phrasePattern(cliches)
+)
+
+func findWeaselWords(text string, c *proseCheck) []Finding {
+	return findPhrases(text, c, weaselPattern, "%q weakens the claim; say how much or leave it out")
+}
+
+func findCliches(text string, c *proseCheck) []Finding {
+	return findPhrases(text, c, clichePattern, "%q is a cliché; say it plainly")
+}
+
+func findPhrases(text string, c *proseCheck, re *regexp.Regexp, format string) []Finding {
+	var findings []Finding
+	for _, loc := range findWords(re, text) {
+		findings = append(findings, Finding{
+			Rule:    c.rule,
+			Start:   loc[0],
+			End:     loc[1],
+			Match:   text[loc[0]:loc[1]],
+			message: fmt.Sprintf(format, text[loc[0]:loc[1]]),
+		})
+	}
+	return findings
+}
+
+// findWords returns the submatch indexes of the matches of re in text that
+// start and end at word boundaries. After a match that does not, the search
+// goes on from its second character, so that it hides no match overlapping
+// it.
+func findWords(re *regexp.Regexp, text string) [][]int {
+	var locs [][]int
+	for at := 0; at < len(text); {
+		loc := re.FindStringSubmatchIndex(text[at:])
+		if loc == nil {
+			break
+		}
+		for i := range loc {
+			if loc[i] >= 0 {
+				loc[i] += at
+			}
+		}
+		if loc[0] < loc[1] && isWordBoundary(text, loc[0]) && isWordBoundary(text, loc[1]) {
+			locs = append(locs, loc)
+			at = loc[1]
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[loc[0]:])
+		at = loc[0] + size
+	}
+	return locs
+}
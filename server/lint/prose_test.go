@@ -0,0 +1,180 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProse(t *testing.T) {
+	long := strings.Repeat("word ", 12)
+	tests := []struct {
+		name  string
+		prose Prose
+		text  string
+		want  []string
+		fixes []string
+	}{
+		{
+			name:  "repeated word",
+			prose: Prose{Code: CodeRepeatedWord},
+			text:  "Paris in the\nthe spring, The the end. 1 1 had, had",
+			want:  []string{"the\nthe", "The the"},
+			fixes: []string{"the", "The"},
+		},
+		{
+			name:  "long sentence",
+			prose: Prose{Code: CodeLongSentence, MaxWords: 10},
+			text:  "Short one. " + long + "end! Short again\n\n" + long + "\n- " + long,
+			want:  []string{strings.TrimSpace(long) + " end!", strings.TrimSpace(long), strings.TrimSpace(long)},
+		},
+		{
+			name:  "double space",
+			prose: Prose{Code: CodeDoubleSpace},
+			text:  "One.  Two   three\n    indented  | cell  |\ntrailing  \n",
+			want:  []string{"  ", "   "},
+			fixes: []string{" ", " "},
+		},
+		{
+			name:  "passive voice",
+			prose: Prose{Code: CodePassiveVoice},
+			text:  "The ball was thrown. Mistakes were quickly made. It is red. She is tired. I was walking.",
+			want:  []string{"was thrown", "were quickly made"},
+		},
+		{
+			name:  "passive voice in whole words only",
+			prose: Prose{Code: CodePassiveVoice},
+			text:  "Añis taken. It was takené. This was naïvely pursued. Thesis was written.",
+			want:  []string{"was naïvely pursued", "was written"},
+		},
+		{
+			name:  "weasel words",
+			prose: Prose{Code: CodeWeaselWord},
+			text:  "This is very fast and Clearly better; some  say so. Veryfast is not.",
+			want:  []string{"very", "Clearly", "some  say"},
+		},
+		{
+			name:  "weasel words in whole words only",
+			prose: Prose{Code: CodeWeaselWord},
+			text:  "Ésimply not, simplyé not, très simply yes, Ωvery not, and ωquite not.",
+			want:  []string{"simply"},
+		},
+		{
+			name:  "cliches",
+			prose: Prose{Code: CodeCliche},
+			text:  "At the end of the day, it is low-hanging fruit to think\noutside the box.",
+			want:  []string{"At the end of the day", "low-hanging fruit", "think\noutside the box"},
+		},
+		{
+			name:  "cliches in whole words only",
+			prose: Prose{Code: CodeCliche},
+			text:  "Ça circle backé, but we circle back.",
+			want:  []string{"circle back"},
+		},
+		{
+			name:  "code is not prose",
+			prose: Prose{Code: CodeRepeatedWord},
+			text:  "run `echo echo` then\n```\nthe the\n```\nand the `x` the end",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(&Config{Prose: []Prose{tt.prose}})
+			require.NoError(t, err)
+			got := e.Lint("", tt.text).Findings
+			require.Equal(t, tt.want, matches(got))
+			for i, f := range got {
+				require.Equal(t, tt.prose.Code, f.Rule.Code)
+				require.NotEmpty(t, f.Rule.URL)
+				require.NotEmpty(t, f.Message())
+				if tt.fixes != nil {
+					fix, ok := f.Fix()
+					require.True(t, ok)
+					require.Equal(t, tt.fixes[i], fix)
+				}
+			}
+		})
+	}
+}
+
+func TestProseSettings(t *testing.T) {
+	text := "the the  end"
+	e, err := New(&Config{Prose: []Prose{
+		{Code: CodeRepeatedWord, Severity: lsp.Error, URL: "https://example.com/style#repeats"},
+		{Code: CodeDoubleSpace, Disabled: true},
+	}})
+	require.NoError(t, err)
+	got := e.Lint("", text).Findings
+	require.Equal(t, []string{"the the"}, matches(got))
+	require.EqualValues(t, lsp.Error, got[0].Rule.Severity)
+	require.Equal(t, "https://example.com/style#repeats", got[0].Rule.URL)
+
+	// only the checks a config lists run
+	e, err = New(&Config{})
+	require.NoError(t, err)
+	require.Empty(t, e.Lint("", text).Findings)
+
+	// globs and directives apply as they do to rules
+	e, err = New(&Config{Prose: []Prose{{Code: CodeRepeatedWord, Exclude: []string{"*.log"}}}})
+	require.NoError(t, err)
+	require.Empty(t, e.Lint("build.log", text).Findings)
+	require.Len(t, e.Lint("notes.txt", text).Findings, 1)
+	require.Empty(t, e.Lint("", "<!-- plaintext-lint-disable-next-line repeated-word -->\nthe the").Findings)
+
+	for _, prose := range [][]Prose{
+		{{Code: "grammar"}},
+		{{Code: CodeCliche}, {Code: CodeCliche}},
+		{{Code: CodeCliche, MaxWords: 3}},
+	} {
+		_, err := New(&Config{Prose: prose})
+		require.Error(t, err)
+	}
+}
+
+func TestParseConfigProse(t *testing.T) {
+	cfg, errs := ParseConfig([]byte(`prose:
+  long-sentence:
+    maxWords: 30
+    severity: warning
+    url: https://example.com/style
+  passive-voice: hint
+  weasel-word: on
+  double-space: off
+`))
+	require.Empty(t, errs)
+	require.Equal(t, []Prose{
+		{Code: CodeLongSentence, MaxWords: 30, Severity: lsp.Warning, URL: "https://example.com/style"},
+		{Code: CodePassiveVoice, Severity: lsp.Hint},
+		{Code: CodeWeaselWord},
+		{Code: CodeDoubleSpace, Disabled: true},
+		{Code: CodeRepeatedWord},
+	}, cfg.Prose)
+
+	// the checks that are on by default are on in an empty file
+	cfg, errs = ParseConfig(nil)
+	require.Empty(t, errs)
+	var codes []string
+	for _, p := range cfg.Prose {
+		codes = append(codes, p.Code)
+	}
+	require.Equal(t, []string{CodeRepeatedWord, CodeLongSentence, CodeDoubleSpace}, codes)
+
+	for _, tc := range []struct {
+		config string
+		err    string
+	}{
+		{"prose: [cliche]\n", "prose must be a mapping of prose checks"},
+		{"prose:\n  grammar: on\n", `unknown prose check "grammar"; use one of repeated-word, long-sentence`},
+		{"prose:\n  cliche: loud\n", `unknown severity "loud"`},
+		{"prose:\n  cliche:\n    maxWords: 3\n", "maxWords only applies to long-sentence"},
+		{"prose:\n  long-sentence:\n    maxWords: 0\n", "maxWords must be a positive number"},
+		{"prose:\n  cliche:\n    color: red\n", `unknown prose check key "color"`},
+	} {
+		_, errs := ParseConfig([]byte(tc.config))
+		require.Len(t, errs, 1, tc.config)
+		require.Contains(t, errs[0].Message, tc.err, tc.config)
+	}
+}
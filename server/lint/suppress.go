@@ -0,0 +1,264 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Directives turn rules off in the text of a document itself. Each names
+// the rules it applies to by term or by code, separated by spaces or
+// commas, or applies to every rule if it names none. A name with spaces or
+// commas in it goes in double quotes. The names end with the line, or
+// with the comment the directive is in:
+//
+//	plaintext-lint-disable-next-line foo, todo
+//	plaintext-lint-disable foo
+//	...
+//	plaintext-lint-enable foo
+//	<!-- plaintext-lint-disable-file bar "click here" -->
+const (
+	// DirectiveDisableNextLine turns rules off on the line after it.
+	DirectiveDisableNextLine = "plaintext-lint-disable-next-line"
+	// DirectiveDisableFile turns rules off in the whole document.
+	DirectiveDisableFile = "plaintext-lint-disable-file"
+	// DirectiveDisable turns rules off until DirectiveEnable turns them
+	// back on, or to the end of the document.
+	DirectiveDisable = "plaintext-lint-disable"
+	// DirectiveEnable ends DirectiveDisable for the rules it names, or for
+	// all of them if it names none.
+	DirectiveEnable = "plaintext-lint-enable"
+)
+
+// directivePattern matches a directive with its list of names. The longer
+// directives come first, as the shorter ones are prefixes of them.
+var directivePattern = regexp.MustCompile(`(` + strings.Join([]string{
+	regexp.QuoteMeta(DirectiveDisableNextLine),
+	regexp.QuoteMeta(DirectiveDisableFile),
+	regexp.QuoteMeta(DirectiveDisable),
+	regexp.QuoteMeta(DirectiveEnable),
+}, "|") + `)([ \t][^\r\n]*)?(\r\n|\n|\r|$)`)
+
+// Unused is a directive, or one name in it, that turned nothing off.
+type Unused struct {
+	Start   int
+	End     int
+	Message string
+}
+
+// suppression is one name of a directive, or the whole of a directive
+// without names, and whether it has turned anything off.
+type suppression struct {
+	name       string
+	start, end int
+	used       bool
+}
+
+// scope is a stretch of text in which a suppression holds.
+type scope struct {
+	start, end int
+	s          *suppression
+}
+
+// suppress drops the findings that a directive turns off, and those in the
+// directives themselves, which name the very terms they turn off. It also
+// returns the suppressions that turned nothing off.
+func suppress(text string, findings []Finding) ([]Finding, []Unused) {
+	if !strings.Contains(text, "plaintext-lint-") {
+		return findings, nil
+	}
+	directives := directivePattern.FindAllStringSubmatchIndex(text, -1)
+	if len(directives) == 0 {
+		return findings, nil
+	}
+	starts := lineStarts(text)
+
+	var suppressions []*suppression
+	var scopes []scope
+	// open holds the disable blocks not yet ended
+	var open []scope
+	for _, loc := range directives {
+		kind := text[loc[2]:loc[3]]
+		list := []*suppression{{start: loc[2], end: loc[3]}}
+		if names := splitNames(text, loc[4], loc[5]); len(names) > 0 {
+			list = names
+		}
+
+		if kind == DirectiveEnable {
+			enabled := names(list)
+			kept := open[:0]
+			for _, sc := range open {
+				if len(enabled) == 0 || contains(enabled, sc.s.name) {
+					sc.end = loc[0]
+					scopes = append(scopes, sc)
+				} else {
+					kept = append(kept, sc)
+				}
+			}
+			open = kept
+			continue
+		}
+
+		suppressions = append(suppressions, list...)
+		for _, s := range list {
+			switch kind {
+			case DirectiveDisableNextLine:
+				line := lineOf(starts, loc[0]) + 1
+				if line < len(starts) {
+					end := len(text)
+					if line+1 < len(starts) {
+						end = starts[line+1]
+					}
+					scopes = append(scopes, scope{start: starts[line], end: end, s: s})
+				}
+			case DirectiveDisableFile:
+				scopes = append(scopes, scope{start: 0, end: len(text), s: s})
+			case DirectiveDisable:
+				open = append(open, scope{start: loc[1], s: s})
+			}
+		}
+	}
+	for _, sc := range open {
+		sc.end = len(text)
+		scopes = append(scopes, sc)
+	}
+
+	kept := findings[:0]
+	for _, f := range findings {
+		if inDirective(directives, f.Start) {
+			continue
+		}
+		suppressed := false
+		for _, sc := range scopes {
+			if f.Start >= sc.start && f.Start < sc.end && (sc.s.name == "" || f.Rule.Named(sc.s.name)) {
+				sc.s.used = true
+				suppressed = true
+			}
+		}
+		if !suppressed {
+			kept = append(kept, f)
+		}
+	}
+
+	var unused []Unused
+	for _, s := range suppressions {
+		if s.used {
+			continue
+		}
+		msg := "suppression is unused"
+		if s.name != "" {
+			msg = fmt.Sprintf("suppression of %q is unused", s.name)
+		}
+		unused = append(unused, Unused{Start: s.start, End: s.end, Message: msg})
+	}
+	return kept, unused
+}
+
+// commentEnds are the ends of the comments a directive may be written in,
+// which end its list of names.
+var commentEnds = []string{"-->", "*/", "--}}", "#}"}
+
+// splitNames returns the names listed in text[start:end], each with its
+// offsets, up to the end of any comment they are in. The offsets of a
+// quoted name include its quotes.
+func splitNames(text string, start, end int) []*suppression {
+	if start < 0 {
+		return nil
+	}
+	var list []*suppression
+	i := start
+	for i < end {
+		for i < end && isSeparator(text[i]) {
+			i++
+		}
+		if i == end || isCommentEnd(text[i:end]) {
+			break
+		}
+		if text[i] == '"' {
+			if j := strings.IndexByte(text[i+1:end], '"'); j >= 0 {
+				j += i + 1
+				if j > i+1 {
+					list = append(list, &suppression{name: text[i+1 : j], start: i, end: j + 1})
+				}
+				i = j + 1
+				continue
+			}
+		}
+		j := i
+		for j < end && !isSeparator(text[j]) && !isCommentEnd(text[j:end]) {
+			j++
+		}
+		list = append(list, &suppression{name: text[i:j], start: i, end: j})
+		i = j
+	}
+	return list
+}
+
+func isSeparator(c byte) bool {
+	return c == ' ' || c == '\t' || c == ','
+}
+
+func isCommentEnd(text string) bool {
+	for _, end := range commentEnds {
+		if strings.HasPrefix(text, end) {
+			return true
+		}
+	}
+	return false
+}
+
+// QuoteName writes a rule name for a directive, quoted if it would
+// otherwise be taken for several.
+func QuoteName(name string) string {
+	if strings.ContainsAny(name, " \t,") {
+		return `"` + name + `"`
+	}
+	return name
+}
+
+func names(list []*suppression) []string {
+	var out []string
+	for _, s := range list {
+		if s.name != "" {
+			out = append(out, s.name)
+		}
+	}
+	return out
+}
+
+func contains(list []string, name string) bool {
+	for _, s := range list {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+func inDirective(directives [][]int, offset int) bool {
+	i := sort.Search(len(directives), func(i int) bool { return directives[i][1] > offset })
+	return i < len(directives) && directives[i][0] <= offset
+}
+
+// lineStarts returns the offset of the start of every line of text.
+func lineStarts(text string) []int {
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				i++
+			}
+			starts = append(starts, i+1)
+		case '\n':
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// lineOf returns the zero based line holding offset.
+func lineOf(starts []int, offset int) int {
+	return sort.Search(len(starts), func(i int) bool { return starts[i] > offset }) - 1
+}
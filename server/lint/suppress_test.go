@@ -0,0 +1,88 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuppress(t *testing.T) {
+	e, err := New(&Config{Rules: []Rule{
+		{Term: "foo"},
+		{Term: "bar"},
+		{Term: "click here"},
+		{Pattern: `TODO`, Code: "todo"},
+	}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "no directive", text: "foo bar", want: []string{"foo", "bar"}},
+		{name: "every rule", text: "plaintext-lint-disable-next-line\nfoo bar\nfoo", want: []string{"foo"}},
+		{name: "by term", text: "plaintext-lint-disable-next-line foo\nfoo bar", want: []string{"bar"}},
+		{name: "by code", text: "plaintext-lint-disable-next-line todo\nTODO foo", want: []string{"foo"}},
+		{name: "several names", text: "plaintext-lint-disable-next-line foo, bar\r\nfoo bar TODO", want: []string{"TODO"}},
+		{name: "stacked directives", text: "  plaintext-lint-disable-next-line foo\nplaintext-lint-disable-next-line bar\nfoo bar", want: []string{"foo"}},
+		{name: "indented", text: "\tplaintext-lint-disable-next-line foo\n\tfoo", want: nil},
+		{name: "last line", text: "foo\nplaintext-lint-disable-next-line", want: []string{"foo"}},
+		{name: "block", text: "foo\nplaintext-lint-disable\nfoo bar\nplaintext-lint-enable\nbar", want: []string{"foo", "bar"}},
+		{name: "block to the end", text: "plaintext-lint-disable foo\nfoo bar\nfoo", want: []string{"bar"}},
+		{name: "enable by name", text: "plaintext-lint-disable foo, bar\nfoo\nplaintext-lint-enable foo\nfoo bar", want: []string{"foo"}},
+		{name: "enable all", text: "plaintext-lint-disable foo\nplaintext-lint-enable\nfoo", want: []string{"foo"}},
+		{name: "file", text: "bar foo\nTODO\nplaintext-lint-disable-file foo todo", want: []string{"bar"}},
+		{name: "unknown directive", text: "plaintext-lint-disabled\nfoo", want: []string{"foo"}},
+		{name: "in a comment", text: "<!-- plaintext-lint-disable-next-line foo -->\nfoo bar", want: []string{"bar"}},
+		{name: "comment end against a name", text: "/* plaintext-lint-disable foo*/\nfoo bar", want: []string{"bar"}},
+		{name: "quoted name", text: "plaintext-lint-disable-next-line \"click here\", foo\nclick here, foo bar", want: []string{"bar"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range e.Lint("", tt.text).Findings {
+				got = append(got, f.Match)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUnusedSuppressions(t *testing.T) {
+	e, err := New(&Config{Rules: []Rule{{Term: "foo"}, {Term: "bar"}}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "used", text: "plaintext-lint-disable-next-line foo\nfoo"},
+		{name: "unused", text: "plaintext-lint-disable-next-line foo\nbar", want: []string{"foo"}},
+		{name: "one name unused", text: "plaintext-lint-disable-next-line foo bar\nbar", want: []string{"foo"}},
+		{name: "unused without names", text: "plaintext-lint-disable-next-line\nnothing", want: []string{"plaintext-lint-disable-next-line"}},
+		{name: "comment end is no name", text: "<!-- plaintext-lint-disable-next-line foo -->\nfoo"},
+		{name: "unused quoted name", text: "plaintext-lint-disable-next-line \"foo bar\"\nfoo bar", want: []string{"\"foo bar\""}},
+		{name: "unknown rule", text: "plaintext-lint-disable-file qux\nfoo", want: []string{"qux"}},
+		{name: "unused block", text: "plaintext-lint-disable bar\nfoo\nplaintext-lint-enable bar", want: []string{"bar"}},
+		{name: "enable is not reported", text: "plaintext-lint-enable foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, u := range e.Lint("", tt.text).Unused {
+				got = append(got, tt.text[u.Start:u.End])
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQuoteName(t *testing.T) {
+	for _, name := range []string{"foo", "click here", "a,b", "todo"} {
+		list := splitNames(QuoteName(name), 0, len(QuoteName(name)))
+		require.Len(t, list, 1)
+		require.Equal(t, name, list[0].name)
+	}
+}
@@ -0,0 +1,95 @@
+package tcpserver
+
+import (
+	"path/filepath"
+	"testing"
+
+	"lsp/server/docuri"
+	"lsp/server/lint"
+	"lsp/server/position"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+// flagged returns the text of the lint findings last published for the
+// document at uri, whose text is text.
+func (ts *testSession) flagged(uri lsp.DocumentURI, text string) []string {
+	sets := ts.published(uri)
+	require.NotEmpty(ts.t, sets, "diagnostics of %s", uri)
+	var words []string
+	for _, d := range sets[len(sets)-1] {
+		if d.Code != lint.CodeBlockedTerm {
+			continue
+		}
+		start, err := position.ToOffset(text, d.Range.Start, ts.Encoding())
+		require.NoError(ts.t, err)
+		end, err := position.ToOffset(text, d.Range.End, ts.Encoding())
+		require.NoError(ts.t, err)
+		words = append(words, text[start:end])
+	}
+	return words
+}
+
+func TestApplyLintConfigKeepsLastGood(t *testing.T) {
+	ts := newTestSession(t)
+	f := ts.addFolder("")
+	config := docuri.FromPath(filepath.Join(f.Path, lint.ConfigFile))
+	uri := docuri.FromPath(filepath.Join(f.Path, "a.txt"))
+	text := "foo qux quux\n"
+	ts.open(uri, text)
+	require.Equal(t, []string{"foo"}, ts.flagged(uri, text))
+
+	steps := []struct {
+		name       string
+		config     string
+		wantWords  []string
+		wantErrors int
+	}{
+		{name: "good", config: "rules:\n  - term: qux\n", wantWords: []string{"qux"}},
+		// the rule for quux is fine, but the last good config stays in
+		// effect until the mistake is fixed
+		{name: "broken", config: "rules:\n  - term: quux\n  - term: qux\n    severity: severe\n", wantWords: []string{"qux"}, wantErrors: 1},
+		{name: "fixed", config: "rules:\n  - term: quux\n", wantWords: []string{"quux"}},
+	}
+	for _, step := range steps {
+		ts.applyLintConfig(f, step.config, true)
+		require.Equal(t, step.wantWords, ts.flagged(uri, text), step.name)
+		sets := ts.published(config)
+		require.Len(t, sets[len(sets)-1], step.wantErrors, step.name)
+	}
+
+	// reading the same text again relints nothing
+	published := len(ts.published(uri))
+	ts.applyLintConfig(f, "rules:\n  - term: quux\n", true)
+	require.Len(t, ts.published(uri), published)
+
+	// and without the file the default rules are back
+	ts.applyLintConfig(f, "", false)
+	require.Equal(t, []string{"foo"}, ts.flagged(uri, text))
+}
+
+func TestApplyLintConfigWithoutGood(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		wantWords []string
+	}{
+		{name: "invalid YAML uses the defaults", config: "rules: [\n", wantWords: []string{"foo"}},
+		{name: "mistakes use the rules without", config: "rules:\n  - term: qux\n  - term: quux\n    severity: severe\n", wantWords: []string{"qux"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestSession(t)
+			f := ts.addFolder("")
+			config := docuri.FromPath(filepath.Join(f.Path, lint.ConfigFile))
+			uri := docuri.FromPath(filepath.Join(f.Path, "a.txt"))
+			text := "foo qux quux\n"
+			ts.open(uri, text)
+
+			ts.applyLintConfig(f, tt.config, true)
+			require.Equal(t, tt.wantWords, ts.flagged(uri, text))
+			require.Equal(t, []string{codeLintConfig}, ts.codes(config))
+		})
+	}
+}
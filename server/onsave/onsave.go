@@ -0,0 +1,162 @@
+// Package onsave holds the edits the server offers through
+// textDocument/willSaveWaitUntil, such as trimming trailing whitespace.
+package onsave
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Edit replaces the bytes in [Start, End) of the document with NewText.
+type Edit struct {
+	Start   int
+	End     int
+	NewText string
+}
+
+// Hook computes the edits to make to text before it is written to disk.
+type Hook struct {
+	Name  string
+	Edits func(text string) []Edit
+}
+
+// Builtin returns the hooks shipped with the server. Which of them run is
+// up to the user.
+func Builtin() []Hook {
+	return []Hook{
+		{Name: "trimTrailingWhitespace", Edits: TrimTrailingWhitespace},
+		{Name: "insertFinalNewline", Edits: InsertFinalNewline},
+		{Name: "normalizeQuotes", Edits: NormalizeQuotes},
+	}
+}
+
+// Run collects the edits of every hook against the same text. Hooks still
+// running when ctx expires are abandoned and the edits gathered so far are
+// returned. An edit that overlaps one from an earlier hook is dropped, so
+// the result can always be applied as one batch.
+func Run(ctx context.Context, text string, hooks []Hook) []Edit {
+	var edits []Edit
+	for _, hook := range hooks {
+		done := make(chan []Edit, 1)
+		go func(hook Hook) {
+			done <- hook.Edits(text)
+		}(hook)
+
+		select {
+		case <-ctx.Done():
+			log.Printf("save hook %s: %v, skipping remaining hooks", hook.Name, ctx.Err())
+			return sortEdits(edits)
+		case hookEdits := <-done:
+			for _, edit := range hookEdits {
+				if overlaps(edits, edit) {
+					log.Printf("save hook %s: dropping edit [%d, %d) overlapping an earlier hook", hook.Name, edit.Start, edit.End)
+					continue
+				}
+				edits = append(edits, edit)
+			}
+		}
+	}
+	return sortEdits(edits)
+}
+
+func overlaps(edits []Edit, edit Edit) bool {
+	for _, e := range edits {
+		if edit.Start < e.End && e.Start < edit.End {
+			return true
+		}
+		// an insert where another edit starts has no defined order with it
+		if edit.Start == e.Start && (edit.Start == edit.End || e.Start == e.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortEdits orders edits by where they start, an insert before an edit
+// replacing text from the same spot, and keeps the order of ties otherwise.
+func sortEdits(edits []Edit) []Edit {
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].Start != edits[j].Start {
+			return edits[i].Start < edits[j].Start
+		}
+		return edits[i].Start == edits[i].End && edits[j].Start != edits[j].End
+	})
+	return edits
+}
+
+// Apply returns text with edits applied. Edits must not overlap.
+func Apply(text string, edits []Edit) string {
+	edits = sortEdits(append([]Edit(nil), edits...))
+	var b strings.Builder
+	last := 0
+	for _, edit := range edits {
+		b.WriteString(text[last:edit.Start])
+		b.WriteString(edit.NewText)
+		last = edit.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// TrimTrailingWhitespace removes spaces and tabs before every line break and
+// at the end of the text.
+func TrimTrailingWhitespace(text string) []Edit {
+	var edits []Edit
+	lineEnd := func(end int) {
+		start := end
+		for start > 0 && (text[start-1] == ' ' || text[start-1] == '\t') {
+			start--
+		}
+		if start < end {
+			edits = append(edits, Edit{Start: start, End: end})
+		}
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' || text[i] == '\r' {
+			lineEnd(i)
+			if text[i] == '\r' && i+1 < len(text) && text[i+1] == '\n' {
+				i++
+			}
+		}
+	}
+	lineEnd(len(text))
+	return edits
+}
+
+// InsertFinalNewline makes sure a non-empty text ends in a line break,
+// reusing the line ending the text already uses.
+func InsertFinalNewline(text string) []Edit {
+	if text == "" || strings.HasSuffix(text, "\n") || strings.HasSuffix(text, "\r") {
+		return nil
+	}
+	newline := "\n"
+	if strings.Contains(text, "\r\n") {
+		newline = "\r\n"
+	}
+	return []Edit{{Start: len(text), End: len(text), NewText: newline}}
+}
+
+var straightQuotes = map[rune]string{
+	'\u2018': "'",  // left single quotation mark
+	'\u2019': "'",  // right single quotation mark
+	'\u201a': "'",  // single low-9 quotation mark
+	'\u201b': "'",  // single high-reversed-9 quotation mark
+	'\u201c': "\"", // left double quotation mark
+	'\u201d': "\"", // right double quotation mark
+	'\u201e': "\"", // double low-9 quotation mark
+	'\u201f': "\"", // double high-reversed-9 quotation mark
+}
+
+// NormalizeQuotes replaces typographic quotes with their ASCII equivalents.
+func NormalizeQuotes(text string) []Edit {
+	var edits []Edit
+	for i, r := range text {
+		if q, ok := straightQuotes[r]; ok {
+			edits = append(edits, Edit{Start: i, End: i + utf8.RuneLen(r), NewText: q})
+		}
+	}
+	return edits
+}
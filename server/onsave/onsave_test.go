@@ -0,0 +1,79 @@
+package onsave
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinHooks(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "empty", input: "", want: ""},
+		{name: "trailing spaces", input: "a  \nb\t\n", want: "a\nb\n"},
+		{name: "crlf kept", input: "a \r\nb \r\nc", want: "a\r\nb\r\nc\r\n"},
+		{name: "final newline", input: "last line  ", want: "last line\n"},
+		{name: "smart quotes", input: "“quoted” and ‘single’\n", want: "\"quoted\" and 'single'\n"},
+		{name: "nothing to do", input: "clean\n", want: "clean\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits := Run(context.Background(), tt.input, Builtin())
+			require.Equal(t, tt.want, Apply(tt.input, edits))
+		})
+	}
+}
+
+func TestRunBudget(t *testing.T) {
+	slow := Hook{
+		Name: "slow",
+		Edits: func(text string) []Edit {
+			time.Sleep(time.Second)
+			return []Edit{{Start: 0, End: 0, NewText: "late"}}
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	edits := Run(ctx, "a \n", []Hook{{Name: "trim", Edits: TrimTrailingWhitespace}, slow})
+	require.Equal(t, []Edit{{Start: 1, End: 2}}, edits)
+}
+
+func TestRunDropsOverlaps(t *testing.T) {
+	first := Hook{Name: "first", Edits: func(string) []Edit { return []Edit{{Start: 0, End: 3, NewText: "x"}} }}
+	second := Hook{Name: "second", Edits: func(string) []Edit { return []Edit{{Start: 2, End: 4, NewText: "y"}, {Start: 4, End: 5}} }}
+
+	edits := Run(context.Background(), "abcdef", []Hook{first, second})
+	require.Equal(t, "xdf", Apply("abcdef", edits))
+}
+
+func TestRunDropsInsertAtReplacement(t *testing.T) {
+	for _, hooks := range [][]Hook{
+		{
+			{Name: "replace", Edits: func(string) []Edit { return []Edit{{Start: 2, End: 4, NewText: "x"}} }},
+			{Name: "insert", Edits: func(string) []Edit { return []Edit{{Start: 2, End: 2, NewText: "y"}} }},
+		},
+		{
+			{Name: "insert", Edits: func(string) []Edit { return []Edit{{Start: 2, End: 2, NewText: "y"}} }},
+			{Name: "replace", Edits: func(string) []Edit { return []Edit{{Start: 2, End: 4, NewText: "x"}} }},
+		},
+	} {
+		edits := Run(context.Background(), "abcdef", hooks)
+		require.Len(t, edits, 1, hooks[0].Name)
+	}
+}
+
+func TestApplyOrder(t *testing.T) {
+	// the insert goes first whichever order the edits come in
+	for _, edits := range [][]Edit{
+		{{Start: 2, End: 4, NewText: "x"}, {Start: 2, End: 2, NewText: "y"}},
+		{{Start: 2, End: 2, NewText: "y"}, {Start: 2, End: 4, NewText: "x"}},
+	} {
+		require.Equal(t, "abyxef", Apply("abcdef", edits))
+	}
+}
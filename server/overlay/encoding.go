@@ -0,0 +1,121 @@
+package overlay
+
+import (
+	"bytes"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Encoding names the character encoding a file on disk was stored in.
+type Encoding string
+
+const (
+	UTF8    Encoding = "utf-8"
+	UTF8BOM Encoding = "utf-8-bom"
+	UTF16LE Encoding = "utf-16le"
+	UTF16BE Encoding = "utf-16be"
+	// Windows1252 is assumed for any other text that is not valid UTF-8.
+	// It is a superset of the printable range of Latin-1.
+	Windows1252 Encoding = "windows-1252"
+)
+
+// IsUTF8 reports whether files in e can be used as they are, without
+// converting them.
+func (e Encoding) IsUTF8() bool {
+	return e == UTF8 || e == UTF8BOM
+}
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// binarySniffLen is how much of a file is checked for NUL bytes, the same
+// amount git looks at.
+const binarySniffLen = 8000
+
+// Decode converts the bytes of a file to text. UTF-16 is recognised by its
+// byte order mark, and text that is not valid UTF-8 is read as
+// Windows-1252. A file with a NUL byte near the start is taken to be
+// binary. The byte order mark is not part of the text, so positions in it
+// match what an editor shows.
+func Decode(data []byte) (string, Encoding, error) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		data = data[len(bomUTF8):]
+		if !utf8.Valid(data) {
+			return "", "", errors.New("invalid UTF-8 after byte order mark")
+		}
+		return string(data), UTF8BOM, nil
+	case bytes.HasPrefix(data, bomUTF16LE):
+		text, err := decodeUTF16(data[len(bomUTF16LE):], false)
+		return text, UTF16LE, err
+	case bytes.HasPrefix(data, bomUTF16BE):
+		text, err := decodeUTF16(data[len(bomUTF16BE):], true)
+		return text, UTF16BE, err
+	}
+
+	sniff := data
+	if len(sniff) > binarySniffLen {
+		sniff = sniff[:binarySniffLen]
+	}
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return "", "", ErrBinary
+	}
+	if !utf8.Valid(data) {
+		return decodeWindows1252(data), Windows1252, nil
+	}
+	return string(data), UTF8, nil
+}
+
+// Encode converts text to the bytes of a file in enc. Only the UTF-8
+// encodings can be written.
+func Encode(text string, enc Encoding) ([]byte, error) {
+	switch enc {
+	case UTF8:
+		return []byte(text), nil
+	case UTF8BOM:
+		return append(append([]byte(nil), bomUTF8...), text...), nil
+	}
+	return nil, errors.Errorf("cannot write %s", enc)
+}
+
+func decodeUTF16(data []byte, bigEndian bool) (string, error) {
+	if len(data)%2 != 0 {
+		return "", errors.New("odd number of bytes in UTF-16 text")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		lo, hi := data[2*i], data[2*i+1]
+		if bigEndian {
+			lo, hi = hi, lo
+		}
+		units[i] = uint16(lo) | uint16(hi)<<8
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// windows1252 maps the bytes 0x80 to 0x9f, where Windows-1252 differs from
+// Latin-1. The five bytes it leaves undefined keep their Latin-1 control
+// code.
+var windows1252 = [32]rune{
+	'\u20ac', '\u0081', '\u201a', '\u0192', '\u201e', '\u2026', '\u2020', '\u2021',
+	'\u02c6', '\u2030', '\u0160', '\u2039', '\u0152', '\u008d', '\u017d', '\u008f',
+	'\u0090', '\u2018', '\u2019', '\u201c', '\u201d', '\u2022', '\u2013', '\u2014',
+	'\u02dc', '\u2122', '\u0161', '\u203a', '\u0153', '\u009d', '\u017e', '\u0178',
+}
+
+func decodeWindows1252(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		if b >= 0x80 && b < 0xa0 {
+			runes[i] = windows1252[b-0x80]
+		} else {
+			runes[i] = rune(b)
+		}
+	}
+	return string(runes)
+}
@@ -0,0 +1,157 @@
+package overlay
+
+import (
+	"path"
+	"strings"
+)
+
+// ignoreFile is read in every workspace directory for exclusion rules.
+const ignoreFile = ".gitignore"
+
+// ignoreRule is one pattern line of a .gitignore file.
+type ignoreRule struct {
+	// base is the slash separated directory of the .gitignore file,
+	// relative to the workspace root, or "." for the root itself.
+	base    string
+	segs    []string
+	negate  bool
+	dirOnly bool
+}
+
+// parseIgnore reads the rules of a .gitignore file in the directory base.
+// It follows the gitignore(5) syntax: blank lines and # comments are
+// skipped, ! negates, a trailing / only matches directories, and a pattern
+// with a / anywhere else is anchored to base instead of matching a name at
+// any depth.
+func parseIgnore(base, data string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(data, "\n") {
+		line = trimTrailingSpace(strings.TrimSuffix(line, "\r"))
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		switch {
+		case line[0] == '!':
+			rule.negate = true
+			line = line[1:]
+		case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		rule.segs = strings.Split(line, "/")
+		if !anchored {
+			rule.segs = append([]string{"**"}, rule.segs...)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// trimTrailingSpace drops trailing spaces unless they are escaped with a
+// backslash.
+func trimTrailingSpace(line string) string {
+	end := len(line)
+	for end > 0 && line[end-1] == ' ' {
+		if end > 1 && line[end-2] == '\\' {
+			return line[:end-2] + " "
+		}
+		end--
+	}
+	return line[:end]
+}
+
+// matchRules reports whether the slash separated path rel, relative to the
+// workspace root, is excluded by rules. Later rules win over earlier ones.
+func matchRules(rules []ignoreRule, rel string, isDir bool) bool {
+	excluded := false
+	for _, rule := range rules {
+		if rule.negate != excluded {
+			// this rule cannot change the outcome
+			continue
+		}
+		if rule.match(rel, isDir) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "." {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	return matchSegs(r.segs, strings.Split(rel, "/"))
+}
+
+// matchSegs matches path segments against pattern segments, where ** stands
+// for any number of whole segments. A trailing ** needs at least one, so
+// "dir/**" matches what is inside dir but not dir itself.
+func matchSegs(pattern, segs []string) bool {
+	if len(pattern) == 0 {
+		return len(segs) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return len(segs) > 0
+		}
+		for i := 0; i <= len(segs); i++ {
+			if matchSegs(pattern[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 || !matchName(pattern[0], segs[0]) {
+		return false
+	}
+	return matchSegs(pattern[1:], segs[1:])
+}
+
+// matchName matches one path segment against a glob, translating the
+// gitignore [!...] negated class to the [^...] path.Match understands.
+func matchName(pattern, name string) bool {
+	pattern = strings.Replace(pattern, "[!", "[^", -1)
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+// MatchGlob reports whether the slash separated file path rel matches
+// pattern, written like a .gitignore line: ** spans any number of
+// directories, a pattern without a / matches a name at any depth, and a
+// trailing / matches everything inside a directory.
+func MatchGlob(pattern, rel string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	anchored := strings.Contains(pattern, "/")
+	segs := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	if !anchored {
+		segs = append([]string{"**"}, segs...)
+	}
+	return matchSegs(segs, strings.Split(rel, "/"))
+}
+
+// ValidGlob reports whether pattern is a well-formed glob for MatchGlob.
+func ValidGlob(pattern string) bool {
+	for _, seg := range strings.Split(pattern, "/") {
+		if _, err := path.Match(strings.Replace(seg, "[!", "[^", -1), ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
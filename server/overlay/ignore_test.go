@@ -0,0 +1,68 @@
+package overlay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		ignore string
+		path   string
+		isDir  bool
+		want   bool
+	}{
+		{name: "name at any depth", base: ".", ignore: "*.log", path: "a/b/debug.log", want: true},
+		{name: "comment", base: ".", ignore: "# *.log", path: "debug.log", want: false},
+		{name: "escaped hash", base: ".", ignore: `\#notes`, path: "#notes", want: true},
+		{name: "anchored", base: ".", ignore: "/build", path: "a/build", want: false},
+		{name: "anchored at root", base: ".", ignore: "/build", path: "build", isDir: true, want: true},
+		{name: "directory only", base: ".", ignore: "out/", path: "out", want: false},
+		{name: "directory only matches dir", base: ".", ignore: "out/", path: "src/out", isDir: true, want: true},
+		{name: "negation", base: ".", ignore: "*.txt\n!keep.txt", path: "keep.txt", want: false},
+		{name: "later rule wins", base: ".", ignore: "!keep.txt\n*.txt", path: "keep.txt", want: true},
+		{name: "double star", base: ".", ignore: "docs/**/draft.md", path: "docs/a/b/draft.md", want: true},
+		{name: "double star zero dirs", base: ".", ignore: "docs/**/draft.md", path: "docs/draft.md", want: true},
+		{name: "trailing double star", base: ".", ignore: "vendor/**", path: "vendor", isDir: true, want: false},
+		{name: "trailing double star contents", base: ".", ignore: "vendor/**", path: "vendor/x.go", want: true},
+		{name: "nested base", base: "sub", ignore: "/gen", path: "sub/gen", isDir: true, want: true},
+		{name: "nested base elsewhere", base: "sub", ignore: "gen", path: "other/gen", want: false},
+		{name: "negated class", base: ".", ignore: "[!a]*.md", path: "b.md", want: true},
+		{name: "trailing spaces", base: ".", ignore: "notes.txt  \r", path: "notes.txt", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseIgnore(tt.base, tt.ignore)
+			require.Equal(t, tt.want, matchRules(rules, tt.path, tt.isDir))
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "*.md", path: "README.md", want: true},
+		{pattern: "*.md", path: "docs/a/guide.md", want: true},
+		{pattern: "*.md", path: "notes.txt", want: false},
+		{pattern: "docs/**", path: "docs/a/guide.md", want: true},
+		{pattern: "docs/**", path: "src/docs/guide.md", want: false},
+		{pattern: "/docs/*.md", path: "docs/guide.md", want: true},
+		{pattern: "docs/", path: "docs/a/guide.md", want: true},
+		{pattern: "**/CHANGELOG.md", path: "CHANGELOG.md", want: true},
+		{pattern: "[!a]*.txt", path: "b.txt", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			require.Equal(t, tt.want, MatchGlob(tt.pattern, tt.path))
+		})
+	}
+
+	require.True(t, ValidGlob("docs/**/*.md"))
+	require.False(t, ValidGlob("docs/[a"))
+}
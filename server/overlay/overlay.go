@@ -0,0 +1,347 @@
+// Package overlay reads workspace files the way the client sees them: the
+// text of an open buffer wins over what is on disk, and files the client
+// has not opened are read from under the workspace roots.
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lsp/server/document"
+	"lsp/server/docuri"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// DefaultMaxFileSize is the largest file read from disk when Options does
+// not set one.
+const DefaultMaxFileSize = 2 << 20
+
+var (
+	ErrTooLarge         = errors.New("file too large")
+	ErrBinary           = errors.New("binary file")
+	ErrIgnored          = errors.New("file excluded from workspace")
+	ErrOutsideWorkspace = errors.New("file outside workspace")
+)
+
+// File is the content of a workspace file.
+type File struct {
+	URI  lsp.DocumentURI
+	Text string
+	// Open is set when Text comes from a buffer the client has open, in
+	// which case Version is the buffer's version.
+	Open    bool
+	Version int
+	// Encoding is what the bytes on disk were decoded from. It is empty
+	// for open buffers.
+	Encoding Encoding
+	ModTime  time.Time
+}
+
+type cachedFile struct {
+	file *File
+	size int64
+}
+
+type Options struct {
+	// MaxFileSize is the largest file read from disk, in bytes.
+	MaxFileSize int64
+}
+
+// FS layers the open documents over the files under the workspace roots.
+// It is safe for concurrent use.
+type FS struct {
+	docs        *document.Store
+	maxFileSize int64
+
+	mu     sync.Mutex
+	roots  []string
+	cache  map[string]cachedFile
+	ignore map[string][]ignoreRule
+}
+
+func New(docs *document.Store, opts Options) *FS {
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = DefaultMaxFileSize
+	}
+	return &FS{
+		docs:        docs,
+		maxFileSize: opts.MaxFileSize,
+		cache:       map[string]cachedFile{},
+		ignore:      map[string][]ignoreRule{},
+	}
+}
+
+// AddRoot makes the directory at path part of the workspace.
+func (fs *FS) AddRoot(path string) {
+	path = filepath.Clean(path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, root := range fs.roots {
+		if root == path {
+			return
+		}
+	}
+	fs.roots = append(fs.roots, path)
+	sort.Strings(fs.roots)
+}
+
+// RemoveRoot drops the directory at path from the workspace, along with
+// everything cached for files under it.
+func (fs *FS) RemoveRoot(path string) {
+	path = filepath.Clean(path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for i, root := range fs.roots {
+		if root == path {
+			fs.roots = append(fs.roots[:i], fs.roots[i+1:]...)
+			break
+		}
+	}
+	for p := range fs.cache {
+		if within(path, p) {
+			delete(fs.cache, p)
+		}
+	}
+	for dir := range fs.ignore {
+		if within(path, dir) {
+			delete(fs.ignore, dir)
+		}
+	}
+}
+
+// Roots returns the workspace roots in sorted order.
+func (fs *FS) Roots() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string(nil), fs.roots...)
+}
+
+// ReadFile returns the content of the file at uri. An open buffer is
+// returned as is; anything else must be a file under a workspace root that
+// is not excluded, not too large and not binary.
+func (fs *FS) ReadFile(uri lsp.DocumentURI) (*File, error) {
+	if snap, ok := fs.docs.Get(uri); ok {
+		return &File{URI: uri, Text: snap.Text(), Open: true, Version: snap.Version}, nil
+	}
+	return fs.ReadDisk(uri)
+}
+
+// ReadDisk is ReadFile ignoring open buffers, for callers that need to know
+// how a file is stored.
+func (fs *FS) ReadDisk(uri lsp.DocumentURI) (*File, error) {
+	path, err := docuri.Filename(uri)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := fs.rootOf(path)
+	if !ok {
+		return nil, errors.Wrapf(ErrOutsideWorkspace, "reading %s", uri)
+	}
+	if fs.excluded(root, path, false) {
+		return nil, errors.Wrapf(ErrIgnored, "reading %s", uri)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", uri)
+	}
+	if info.IsDir() {
+		return nil, errors.Errorf("reading %s: is a directory", uri)
+	}
+	if info.Size() > fs.maxFileSize {
+		return nil, errors.Wrapf(ErrTooLarge, "reading %s: %d bytes, limit is %d", uri, info.Size(), fs.maxFileSize)
+	}
+
+	fs.mu.Lock()
+	cached, ok := fs.cache[path]
+	fs.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.file.ModTime.Equal(info.ModTime()) {
+		return cached.file, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", uri)
+	}
+	text, enc, err := Decode(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", uri)
+	}
+	file := &File{URI: uri, Text: text, Encoding: enc, ModTime: info.ModTime()}
+
+	fs.mu.Lock()
+	fs.cache[path] = cachedFile{file: file, size: info.Size()}
+	fs.mu.Unlock()
+	return file, nil
+}
+
+// WriteFile replaces the file at uri on disk with text in enc, keeping its
+// permissions.
+func (fs *FS) WriteFile(uri lsp.DocumentURI, text string, enc Encoding) error {
+	path, err := docuri.Filename(uri)
+	if err != nil {
+		return err
+	}
+	data, err := Encode(text, enc)
+	if err != nil {
+		return errors.Wrapf(err, "writing %s", uri)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrapf(err, "writing %s", uri)
+	}
+	if err := os.WriteFile(path, data, info.Mode().Perm()); err != nil {
+		return errors.Wrapf(err, "writing %s", uri)
+	}
+	fs.Invalidate(uri)
+	return nil
+}
+
+// Invalidate forgets anything cached about the file or directory at uri,
+// so the next read goes back to disk. Changing a .gitignore file also drops
+// the exclusion rules it contributed.
+func (fs *FS) Invalidate(uri lsp.DocumentURI) {
+	path, err := docuri.Filename(uri)
+	if err != nil {
+		return
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for p := range fs.cache {
+		if within(path, p) {
+			delete(fs.cache, p)
+		}
+	}
+	dir := path
+	if filepath.Base(path) == ignoreFile {
+		// rules are cached per directory including those inherited from
+		// parents, so every directory below this one is stale too
+		dir = filepath.Dir(path)
+	}
+	for d := range fs.ignore {
+		if within(dir, d) {
+			delete(fs.ignore, d)
+		}
+	}
+}
+
+// Excluded reports whether path is outside every workspace root or matched
+// by the exclusion rules of the root it is in.
+func (fs *FS) Excluded(path string, isDir bool) bool {
+	root, ok := fs.rootOf(path)
+	return !ok || fs.excluded(root, path, isDir)
+}
+
+// Walk calls fn for every file under the workspace roots that is not
+// excluded. Directories that are excluded are not descended into.
+func (fs *FS) Walk(fn func(uri lsp.DocumentURI) error) error {
+	for _, root := range fs.Roots() {
+		if err := fs.WalkRoot(root, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkRoot is Walk restricted to the workspace root at root.
+func (fs *FS) WalkRoot(root string, fn func(uri lsp.DocumentURI) error) error {
+	root = filepath.Clean(root)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// a file removed mid-walk is not worth stopping for
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		if fs.excluded(root, path, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || !info.Mode().IsRegular() {
+			return nil
+		}
+		return fn(docuri.FromPath(path))
+	})
+	return errors.Wrapf(err, "walking %s", root)
+}
+
+// rootOf returns the innermost workspace root containing path.
+func (fs *FS) rootOf(path string) (string, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	best := ""
+	for _, root := range fs.roots {
+		if within(root, path) && len(root) > len(best) {
+			best = root
+		}
+	}
+	return best, best != ""
+}
+
+// excluded reports whether path, or any directory between it and root, is
+// matched by the exclusion rules. As with git, a file inside an excluded
+// directory cannot be brought back by a negated rule.
+func (fs *FS) excluded(root, path string, isDir bool) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	dir := root
+	for i, part := range parts {
+		last := i == len(parts)-1
+		if part == ".git" && (!last || isDir) {
+			return true
+		}
+		rel := strings.Join(parts[:i+1], "/")
+		if matchRules(fs.rulesFor(root, dir), rel, isDir || !last) {
+			return true
+		}
+		dir = filepath.Join(dir, part)
+	}
+	return false
+}
+
+// rulesFor returns the exclusion rules that apply to entries of dir: those
+// of every .gitignore from root down to dir, in that order.
+func (fs *FS) rulesFor(root, dir string) []ignoreRule {
+	fs.mu.Lock()
+	rules, ok := fs.ignore[dir]
+	fs.mu.Unlock()
+	if ok {
+		return rules
+	}
+
+	if dir != root {
+		rules = append(rules, fs.rulesFor(root, filepath.Dir(dir))...)
+	}
+	base, _ := filepath.Rel(root, dir)
+	if data, err := os.ReadFile(filepath.Join(dir, ignoreFile)); err == nil {
+		rules = append(rules, parseIgnore(filepath.ToSlash(base), string(data))...)
+	}
+
+	fs.mu.Lock()
+	fs.ignore[dir] = rules
+	fs.mu.Unlock()
+	return rules
+}
+
+// within reports whether path is dir or inside it.
+func within(dir, path string) bool {
+	if dir == path {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,187 @@
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"lsp/server/document"
+	"lsp/server/docuri"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore":       "*.log\n/build/\n",
+		"notes.txt":        "on disk",
+		"open.txt":         "on disk",
+		"big.txt":          "0123456789",
+		"debug.log":        "ignored",
+		"build/out.txt":    "ignored",
+		"sub/.gitignore":   "!keep.log\n",
+		"sub/keep.log":     "kept",
+		"image.png":        "\x89PNG\x00\x00",
+		"bom.txt":          "\xef\xbb\xbfbom",
+		"utf16.txt":        "\xff\xfeh\x00i\x00",
+		".git/HEAD":        "ref: refs/heads/main",
+		"latin1.txt":       "caf\xe9",
+		"sub/deep/big.txt": "small",
+	})
+	docs := document.NewStore()
+	_, err := docs.Open(lsp.TextDocumentItem{URI: docuri.FromPath(filepath.Join(root, "open.txt")), Version: 4, Text: "in editor"})
+	require.NoError(t, err)
+
+	fs := New(docs, Options{MaxFileSize: 9})
+	fs.AddRoot(root)
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		enc     Encoding
+		open    bool
+		wantErr error
+	}{
+		{name: "disk", path: "notes.txt", want: "on disk", enc: UTF8},
+		{name: "open buffer wins", path: "open.txt", want: "in editor", open: true},
+		{name: "too large", path: "big.txt", wantErr: ErrTooLarge},
+		{name: "ignored", path: "debug.log", wantErr: ErrIgnored},
+		{name: "ignored directory", path: "build/out.txt", wantErr: ErrIgnored},
+		{name: "negated in subdirectory", path: "sub/keep.log", want: "kept", enc: UTF8},
+		{name: "binary", path: "image.png", wantErr: ErrBinary},
+		{name: "utf-8 bom", path: "bom.txt", want: "bom", enc: UTF8BOM},
+		{name: "utf-16", path: "utf16.txt", want: "hi", enc: UTF16LE},
+		{name: "git directory", path: ".git/HEAD", wantErr: ErrIgnored},
+		{name: "windows-1252", path: "latin1.txt", want: "café", enc: Windows1252},
+		{name: "outside workspace", path: "../elsewhere.txt", wantErr: ErrOutsideWorkspace},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := fs.ReadFile(docuri.FromPath(filepath.Join(root, filepath.FromSlash(tt.path))))
+			if tt.wantErr != nil {
+				require.Equal(t, tt.wantErr, errors.Cause(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, file.Text)
+			require.Equal(t, tt.enc, file.Encoding)
+			require.Equal(t, tt.open, file.Open)
+		})
+	}
+
+	file, err := fs.ReadDisk(docuri.FromPath(filepath.Join(root, "open.txt")))
+	require.NoError(t, err)
+	require.Equal(t, "on disk", file.Text)
+}
+
+func TestInvalidate(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore": "*.tmp\n",
+		"a.tmp":      "scratch",
+		"b.txt":      "before",
+	})
+	fs := New(document.NewStore(), Options{})
+	fs.AddRoot(root)
+
+	uri := docuri.FromPath(filepath.Join(root, "b.txt"))
+	file, err := fs.ReadFile(uri)
+	require.NoError(t, err)
+	require.Equal(t, "before", file.Text)
+
+	// same size and mtime, so only an invalidation can reveal the change
+	info, err := os.Stat(filepath.Join(root, "b.txt"))
+	require.NoError(t, err)
+	writeFiles(t, root, map[string]string{"b.txt": "after!"})
+	require.NoError(t, os.Chtimes(filepath.Join(root, "b.txt"), info.ModTime(), info.ModTime()))
+
+	file, err = fs.ReadFile(uri)
+	require.NoError(t, err)
+	require.Equal(t, "before", file.Text)
+	fs.Invalidate(uri)
+	file, err = fs.ReadFile(uri)
+	require.NoError(t, err)
+	require.Equal(t, "after!", file.Text)
+
+	tmp := docuri.FromPath(filepath.Join(root, "a.tmp"))
+	_, err = fs.ReadFile(tmp)
+	require.Equal(t, ErrIgnored, errors.Cause(err))
+	writeFiles(t, root, map[string]string{".gitignore": ""})
+	fs.Invalidate(docuri.FromPath(filepath.Join(root, ".gitignore")))
+	file, err = fs.ReadFile(tmp)
+	require.NoError(t, err)
+	require.Equal(t, "scratch", file.Text)
+}
+
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore":          "node_modules/\n*.bak\n",
+		"README.md":           "readme",
+		"docs/guide.txt":      "guide",
+		"docs/old.bak":        "old",
+		"node_modules/x/a.js": "js",
+		".git/config":         "[core]",
+	})
+	fs := New(document.NewStore(), Options{})
+	fs.AddRoot(root)
+
+	var got []string
+	require.NoError(t, fs.Walk(func(uri lsp.DocumentURI) error {
+		path, err := docuri.Filename(uri)
+		require.NoError(t, err)
+		rel, err := filepath.Rel(root, path)
+		require.NoError(t, err)
+		got = append(got, filepath.ToSlash(rel))
+		return nil
+	}))
+	sort.Strings(got)
+	require.Equal(t, []string{".gitignore", "README.md", "docs/guide.txt"}, got)
+
+	fs.RemoveRoot(root)
+	require.Empty(t, fs.Roots())
+	_, err := fs.ReadFile(docuri.FromPath(filepath.Join(root, "README.md")))
+	require.Equal(t, ErrOutsideWorkspace, errors.Cause(err))
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+		enc  Encoding
+	}{
+		{name: "utf-8", data: "naïve", want: "naïve", enc: UTF8},
+		{name: "utf-8 bom", data: "\xef\xbb\xbfnaïve", want: "naïve", enc: UTF8BOM},
+		{name: "utf-16be", data: "\xfe\xff\x00h\xd8\x3d\xde\x00", want: "h😀", enc: UTF16BE},
+		{name: "latin-1", data: "na\xefve", want: "naïve", enc: Windows1252},
+		{name: "windows-1252 quotes", data: "\x93quoted\x94 \x80 \x81", want: "“quoted” € \u0081", enc: Windows1252},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, enc, err := Decode([]byte(tt.data))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, text)
+			require.Equal(t, tt.enc, enc)
+		})
+	}
+
+	data, err := Encode("x", UTF8BOM)
+	require.NoError(t, err)
+	require.Equal(t, "\xef\xbb\xbfx", string(data))
+	_, err = Encode("x", Windows1252)
+	require.Error(t, err)
+}
@@ -13,9 +13,20 @@ type LspHeader struct {
 	ContentLength int64
 	ContentType   string
 }
+
+// LspBody is any message from the client. Requests and notifications carry
+// a method; responses to the server's own requests carry a result or error.
 type LspBody struct {
 	Jsonrpc string          `json:"jsonrpc"`
 	Id      int             `json:"id"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *LspError       `json:"error,omitempty"`
+}
+
+type LspError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
 }
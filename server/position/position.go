@@ -0,0 +1,210 @@
+// Package position converts between LSP positions and byte offsets.
+//
+// LSP positions count characters in the encoding negotiated during
+// initialize (UTF-16 code units unless the client offers something else),
+// while Go strings are UTF-8 bytes. Every feature that turns a range into a
+// slice of text, or a match back into a range, goes through this package.
+//
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/#positionEncodingKind
+package position
+
+import (
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+type Encoding string
+
+const (
+	UTF8  Encoding = "utf-8"
+	UTF16 Encoding = "utf-16"
+	UTF32 Encoding = "utf-32"
+)
+
+// serverPreference lists the encodings we can serve, cheapest first.
+var serverPreference = []Encoding{UTF8, UTF32, UTF16}
+
+// Negotiate picks the position encoding to use from the client's
+// general.positionEncodings. UTF-16 is mandatory for every client, so it is
+// the answer whenever the client offers nothing we prefer.
+func Negotiate(offered []string) Encoding {
+	for _, enc := range serverPreference {
+		for _, o := range offered {
+			if Encoding(o) == enc {
+				return enc
+			}
+		}
+	}
+	return UTF16
+}
+
+// Units returns the width of r in the given encoding. In UTF-8,
+// utf8.RuneError is taken for an invalid byte, one unit wide; the rune
+// itself is three bytes, which width counts from its encoded size.
+func Units(r rune, enc Encoding) int {
+	switch enc {
+	case UTF8:
+		if r == utf8.RuneError {
+			// invalid bytes decode one at a time
+			return 1
+		}
+		return utf8.RuneLen(r)
+	case UTF32:
+		return 1
+	default:
+		if r >= 0x10000 {
+			// surrogate pair
+			return 2
+		}
+		return 1
+	}
+}
+
+// width returns the width in enc of the rune r that DecodeRuneInString
+// decoded from size bytes. In UTF-8 that is size itself, which tells a
+// literal U+FFFD from an invalid byte.
+func width(r rune, size int, enc Encoding) int {
+	if enc == UTF8 {
+		return size
+	}
+	return Units(r, enc)
+}
+
+// LineStart returns the byte offset at which line (zero based) begins.
+// \n, \r\n and \r all terminate a line.
+func LineStart(text string, line int) (int, error) {
+	if line < 0 {
+		return 0, errors.Errorf("negative line %d", line)
+	}
+	offset := 0
+	for l := 0; l < line; l++ {
+		next := lineEnd(text, offset)
+		if next == offset || (text[next-1] != '\n' && text[next-1] != '\r') {
+			return 0, errors.Errorf("line %d out of range", line)
+		}
+		offset = next
+	}
+	return offset, nil
+}
+
+// lineEnd returns the offset just past the terminator of the line starting
+// at offset, or len(text) if the line is not terminated.
+func lineEnd(text string, offset int) int {
+	for i := offset; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			return i + 1
+		case '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				return i + 2
+			}
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
+// ToOffset converts pos into a byte offset within text. A character past the
+// end of its line is clamped to the end of the line, as the spec requires; a
+// character that falls inside a multi-unit rune snaps back to the rune start.
+func ToOffset(text string, pos lsp.Position, enc Encoding) (int, error) {
+	start, err := LineStart(text, pos.Line)
+	if err != nil {
+		return 0, errors.Wrap(err, "locating line")
+	}
+	if pos.Character < 0 {
+		return 0, errors.Errorf("negative character %d", pos.Character)
+	}
+	return start + ColumnToByte(text[start:], pos.Character, enc), nil
+}
+
+// ColumnToByte converts a character column in enc into a byte offset within
+// line, stopping at the first line terminator.
+func ColumnToByte(line string, column int, enc Encoding) int {
+	units := 0
+	for i := 0; i < len(line); {
+		if line[i] == '\n' || line[i] == '\r' {
+			return i
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		w := width(r, size, enc)
+		if units+w > column {
+			return i
+		}
+		units += w
+		i += size
+	}
+	return len(line)
+}
+
+// ByteToColumn converts a byte offset within line into a character column in
+// enc.
+func ByteToColumn(line string, offset int, enc Encoding) int {
+	if offset > len(line) {
+		offset = len(line)
+	}
+	units := 0
+	for i := 0; i < offset; {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if i+size > offset {
+			// offset points into the middle of a rune
+			break
+		}
+		units += width(r, size, enc)
+		i += size
+	}
+	return units
+}
+
+// FromOffset converts a byte offset within text into a position.
+func FromOffset(text string, offset int, enc Encoding) (lsp.Position, error) {
+	if offset < 0 || offset > len(text) {
+		return lsp.Position{}, errors.Errorf("offset %d out of range [0, %d]", offset, len(text))
+	}
+	line, start := 0, 0
+	for {
+		next := lineEnd(text, start)
+		terminated := next > start && (text[next-1] == '\n' || text[next-1] == '\r')
+		// an offset between \r and \n still belongs to the earlier line
+		if !terminated || next > offset {
+			break
+		}
+		line++
+		start = next
+	}
+	return lsp.Position{
+		Line:      line,
+		Character: ByteToColumn(text[start:], offset-start, enc),
+	}, nil
+}
+
+// ToRange converts a byte span of text into an LSP range.
+func ToRange(text string, start, end int, enc Encoding) (lsp.Range, error) {
+	s, err := FromOffset(text, start, enc)
+	if err != nil {
+		return lsp.Range{}, errors.Wrap(err, "converting range start")
+	}
+	e, err := FromOffset(text, end, enc)
+	if err != nil {
+		return lsp.Range{}, errors.Wrap(err, "converting range end")
+	}
+	return lsp.Range{Start: s, End: e}, nil
+}
+
+// FromRange converts an LSP range into a byte span of text.
+func FromRange(text string, rng lsp.Range, enc Encoding) (start, end int, err error) {
+	start, err = ToOffset(text, rng.Start, enc)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "converting range start")
+	}
+	end, err = ToOffset(text, rng.End, enc)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "converting range end")
+	}
+	if end < start {
+		return 0, 0, errors.Errorf("range end %d before start %d", end, start)
+	}
+	return start, end, nil
+}
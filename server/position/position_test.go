@@ -0,0 +1,128 @@
+package position
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name    string
+		offered []string
+		want    Encoding
+	}{
+		{name: "nothing offered", offered: nil, want: UTF16},
+		{name: "only utf-16", offered: []string{"utf-16"}, want: UTF16},
+		{name: "prefers utf-8", offered: []string{"utf-16", "utf-32", "utf-8"}, want: UTF8},
+		{name: "utf-32 over utf-16", offered: []string{"utf-16", "utf-32"}, want: UTF32},
+		{name: "unknown encodings", offered: []string{"latin1"}, want: UTF16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, Negotiate(tt.offered))
+		})
+	}
+}
+
+func TestToOffset(t *testing.T) {
+	// "😀" is U+1F600: 4 bytes, a surrogate pair in UTF-16, one code point.
+	// "é" below is "e" followed by U+0301 COMBINING ACUTE ACCENT.
+	const text = "a😀b\n漢字x\néz\r\nlast"
+	tests := []struct {
+		name string
+		pos  lsp.Position
+		enc  Encoding
+		want int
+	}{
+		{name: "start", pos: lsp.Position{Line: 0, Character: 0}, enc: UTF16, want: 0},
+		{name: "after surrogate pair utf-16", pos: lsp.Position{Line: 0, Character: 3}, enc: UTF16, want: 5},
+		{name: "after emoji utf-32", pos: lsp.Position{Line: 0, Character: 2}, enc: UTF32, want: 5},
+		{name: "after emoji utf-8", pos: lsp.Position{Line: 0, Character: 5}, enc: UTF8, want: 5},
+		{name: "inside surrogate pair snaps back", pos: lsp.Position{Line: 0, Character: 2}, enc: UTF16, want: 1},
+		{name: "inside utf-8 sequence snaps back", pos: lsp.Position{Line: 0, Character: 3}, enc: UTF8, want: 1},
+		{name: "cjk utf-16", pos: lsp.Position{Line: 1, Character: 2}, enc: UTF16, want: 13},
+		{name: "cjk utf-8", pos: lsp.Position{Line: 1, Character: 6}, enc: UTF8, want: 13},
+		{name: "combining mark counts separately", pos: lsp.Position{Line: 2, Character: 2}, enc: UTF16, want: 18},
+		{name: "past end of line clamps before crlf", pos: lsp.Position{Line: 2, Character: 40}, enc: UTF16, want: 19},
+		{name: "line after crlf", pos: lsp.Position{Line: 3, Character: 1}, enc: UTF16, want: 22},
+		{name: "end of text", pos: lsp.Position{Line: 3, Character: 4}, enc: UTF16, want: 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToOffset(text, tt.pos, tt.enc)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := ToOffset(text, lsp.Position{Line: 9}, UTF16)
+	require.Error(t, err)
+}
+
+func TestFromOffset(t *testing.T) {
+	const text = "a😀b\n漢字x\néz\r\nlast\n"
+	tests := []struct {
+		name   string
+		offset int
+		enc    Encoding
+		want   lsp.Position
+	}{
+		{name: "start", offset: 0, enc: UTF16, want: lsp.Position{Line: 0, Character: 0}},
+		{name: "after surrogate pair", offset: 5, enc: UTF16, want: lsp.Position{Line: 0, Character: 3}},
+		{name: "after emoji utf-32", offset: 5, enc: UTF32, want: lsp.Position{Line: 0, Character: 2}},
+		{name: "after emoji utf-8", offset: 5, enc: UTF8, want: lsp.Position{Line: 0, Character: 5}},
+		{name: "newline belongs to its line", offset: 6, enc: UTF16, want: lsp.Position{Line: 0, Character: 4}},
+		{name: "start of second line", offset: 7, enc: UTF16, want: lsp.Position{Line: 1, Character: 0}},
+		{name: "cjk", offset: 13, enc: UTF16, want: lsp.Position{Line: 1, Character: 2}},
+		{name: "combining mark", offset: 18, enc: UTF16, want: lsp.Position{Line: 2, Character: 2}},
+		{name: "after crlf", offset: 21, enc: UTF16, want: lsp.Position{Line: 3, Character: 0}},
+		{name: "after final newline", offset: 26, enc: UTF16, want: lsp.Position{Line: 4, Character: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromOffset(text, tt.offset, tt.enc)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+
+			back, err := ToOffset(text, got, tt.enc)
+			require.NoError(t, err)
+			require.Equal(t, tt.offset, back)
+		})
+	}
+
+	_, err := FromOffset(text, len(text)+1, UTF16)
+	require.Error(t, err)
+}
+
+func TestReplacementCharacter(t *testing.T) {
+	// a literal U+FFFD is three bytes; an invalid byte is one byte that
+	// decodes to U+FFFD too
+	tests := []struct {
+		name   string
+		text   string
+		enc    Encoding
+		offset int
+		want   lsp.Position
+	}{
+		{name: "literal utf-8", text: "\uFFFDfoo", enc: UTF8, offset: 3, want: lsp.Position{Character: 3}},
+		{name: "literal utf-8 after", text: "\uFFFDfoo", enc: UTF8, offset: 5, want: lsp.Position{Character: 5}},
+		{name: "literal utf-16", text: "\uFFFDfoo", enc: UTF16, offset: 3, want: lsp.Position{Character: 1}},
+		{name: "literal utf-32", text: "\uFFFDfoo", enc: UTF32, offset: 4, want: lsp.Position{Character: 2}},
+		{name: "invalid byte utf-8", text: "\xfffoo", enc: UTF8, offset: 1, want: lsp.Position{Character: 1}},
+		{name: "invalid bytes utf-8", text: "\xe2\x82foo", enc: UTF8, offset: 3, want: lsp.Position{Character: 3}},
+		{name: "invalid byte utf-16", text: "\xfffoo", enc: UTF16, offset: 2, want: lsp.Position{Character: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromOffset(tt.text, tt.offset, tt.enc)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+
+			back, err := ToOffset(tt.text, tt.want, tt.enc)
+			require.NoError(t, err)
+			require.Equal(t, tt.offset, back)
+		})
+	}
+}
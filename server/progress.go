@@ -0,0 +1,94 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const windowWorkDoneProgressCreate = "window/workDoneProgress/create"
+
+const (
+	workDoneBegin  = "begin"
+	workDoneReport = "report"
+	workDoneEnd    = "end"
+)
+
+// workDoneCreateTimeout is how long to wait for the client to accept a
+// progress token before doing the work without reporting it.
+const workDoneCreateTimeout = 5 * time.Second
+
+type WorkDoneProgressCreateParamsValue struct {
+	Token string `json:"token"`
+}
+
+// WorkDoneProgressValue is the value of a $/progress notification about
+// work of the server's own. Title is only sent when it begins.
+type WorkDoneProgressValue struct {
+	Kind    string `json:"kind"`
+	Title   string `json:"title,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// workDone reports the progress of some work to the client. A nil workDone
+// reports nothing, so callers need not check whether the client shows
+// progress.
+type workDone struct {
+	conn  *Conn
+	token string
+}
+
+// beginWork tells a client that shows progress that work with the given
+// title has begun, and returns nil for one that does not. It waits for the
+// client to accept the token, so it must not be called on the read loop.
+func (s *Session) beginWork(title string) *workDone {
+	s.mu.Lock()
+	supported := s.clientCapabilities.Window.WorkDoneProgress
+	s.workDoneTokens++
+	token := fmt.Sprintf("%s/%d", ServerName, s.workDoneTokens)
+	s.mu.Unlock()
+	if !supported {
+		return nil
+	}
+
+	created := make(chan error, 1)
+	err := s.conn.Call(windowWorkDoneProgressCreate, WorkDoneProgressCreateParamsValue{Token: token}, func(_ json.RawMessage, err error) {
+		created <- err
+	})
+	if err == nil {
+		select {
+		case err = <-created:
+		case <-time.After(workDoneCreateTimeout):
+			err = errors.New("client did not answer")
+		}
+	}
+	if err != nil {
+		log.Printf("creating progress for %s: %v", title, err)
+		return nil
+	}
+	w := &workDone{conn: s.conn, token: token}
+	w.notify(WorkDoneProgressValue{Kind: workDoneBegin, Title: title})
+	return w
+}
+
+// report tells the client what the work is doing now.
+func (w *workDone) report(message string) {
+	w.notify(WorkDoneProgressValue{Kind: workDoneReport, Message: message})
+}
+
+// end tells the client the work is over.
+func (w *workDone) end(message string) {
+	w.notify(WorkDoneProgressValue{Kind: workDoneEnd, Message: message})
+}
+
+func (w *workDone) notify(value WorkDoneProgressValue) {
+	if w == nil {
+		return
+	}
+	if err := w.conn.Notify(progress, &ProgressParamsValue{Token: w.token, Value: value}); err != nil {
+		log.Printf("reporting progress: %v", err)
+	}
+}
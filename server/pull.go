@@ -0,0 +1,448 @@
+package tcpserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"lsp/server/document"
+	"lsp/server/docuri"
+	"lsp/server/overlay"
+	"lsp/server/parse"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+const (
+	workspaceDiagnosticRefresh = "workspace/diagnostic/refresh"
+	progress                   = "$/progress"
+)
+
+const (
+	reportFull      = "full"
+	reportUnchanged = "unchanged"
+)
+
+// workspaceDiagnosticBatch is how many files' reports go in one partial
+// result of workspace/diagnostic.
+const workspaceDiagnosticBatch = 50
+
+// workspaceDiagnosticDelay is how long a held workspace/diagnostic waits
+// after a change for more before checking again, so that typing does not
+// check the document at every keystroke.
+const workspaceDiagnosticDelay = 200 * time.Millisecond
+
+type DiagnosticOptionsValue struct {
+	Identifier string `json:"identifier,omitempty"`
+	// InterFileDependencies is set because a change to a lint
+	// configuration file changes the diagnostics of other files.
+	InterFileDependencies bool `json:"interFileDependencies"`
+	WorkspaceDiagnostics  bool `json:"workspaceDiagnostics"`
+}
+
+type DocumentDiagnosticParamsValue struct {
+	TextDocument     lsp.TextDocumentIdentifier `json:"textDocument"`
+	Identifier       string                     `json:"identifier,omitempty"`
+	PreviousResultID string                     `json:"previousResultId,omitempty"`
+}
+
+type FullDocumentDiagnosticReportValue struct {
+	Kind     string            `json:"kind"`
+	ResultID string            `json:"resultId"`
+	Items    []DiagnosticValue `json:"items"`
+}
+
+type UnchangedDocumentDiagnosticReportValue struct {
+	Kind     string `json:"kind"`
+	ResultID string `json:"resultId"`
+}
+
+type WorkspaceDiagnosticParamsValue struct {
+	Identifier         string                  `json:"identifier,omitempty"`
+	PreviousResultIDs  []PreviousResultIDValue `json:"previousResultIds"`
+	PartialResultToken interface{}             `json:"partialResultToken,omitempty"`
+}
+
+type PreviousResultIDValue struct {
+	URI   lsp.DocumentURI `json:"uri"`
+	Value string          `json:"value"`
+}
+
+type WorkspaceDiagnosticReportValue struct {
+	// Items holds a WorkspaceFullDocumentDiagnosticReportValue or a
+	// WorkspaceUnchangedDocumentDiagnosticReportValue for each file.
+	Items []interface{} `json:"items"`
+}
+
+type WorkspaceFullDocumentDiagnosticReportValue struct {
+	FullDocumentDiagnosticReportValue
+	URI lsp.DocumentURI `json:"uri"`
+	// Version is that of the open document the report is for, and null
+	// for a file that is not open.
+	Version *int `json:"version"`
+}
+
+type WorkspaceUnchangedDocumentDiagnosticReportValue struct {
+	UnchangedDocumentDiagnosticReportValue
+	URI     lsp.DocumentURI `json:"uri"`
+	Version *int            `json:"version"`
+}
+
+type ProgressParamsValue struct {
+	Token interface{} `json:"token"`
+	Value interface{} `json:"value"`
+}
+
+// pullsDiagnostics reports whether the client asks for diagnostics rather
+// than being sent them. Such clients are sent none unasked.
+func (s *Session) pullsDiagnostics() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clientCapabilities.TextDocument.Diagnostic != nil
+}
+
+// diagnosticProvider is what initialize advertises to clients that pull
+// diagnostics, and nil for those that do not.
+func (s *Session) diagnosticProvider() *DiagnosticOptionsValue {
+	if !s.pullsDiagnostics() {
+		return nil
+	}
+	return &DiagnosticOptionsValue{
+		Identifier:            diagnosticSource,
+		InterFileDependencies: true,
+		WorkspaceDiagnostics:  true,
+	}
+}
+
+// refreshDiagnostics asks a client that pulls diagnostics to pull them all
+// again, after something other than an edit changed them.
+func (s *Session) refreshDiagnostics() {
+	s.diagnosticsMayChange()
+	if !s.pullsDiagnostics() {
+		return
+	}
+	s.mu.Lock()
+	refresh := s.clientCapabilities.Workspace.Diagnostics.RefreshSupport
+	s.mu.Unlock()
+	if !refresh {
+		return
+	}
+	err := s.conn.Call(workspaceDiagnosticRefresh, nil, func(_ json.RawMessage, err error) {
+		if err != nil {
+			log.Printf("refreshing diagnostics: %v", err)
+		}
+	})
+	if err != nil {
+		log.Printf("refreshing diagnostics: %v", err)
+	}
+}
+
+// DocumentDiagnostic answers textDocument/diagnostic with what the checks
+// find in a document, open or not. The result ID is derived from the
+// diagnostics themselves, so the client is told nothing changed whenever
+// they are the same as the ones it has.
+func (s *Session) DocumentDiagnostic(body *parse.LspBody) (interface{}, error) {
+	params := DocumentDiagnosticParamsValue{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return nil, errors.Wrap(err, "decoding diagnostic params")
+	}
+	uri := params.TextDocument.URI
+
+	snap, ok := s.documents.Get(uri)
+	if ok && snap.OutOfSync {
+		// its ranges would be wrong; keep what the client has until the
+		// document is back in sync
+		if params.PreviousResultID != "" {
+			return &UnchangedDocumentDiagnosticReportValue{Kind: reportUnchanged, ResultID: params.PreviousResultID}, nil
+		}
+		return &FullDocumentDiagnosticReportValue{Kind: reportFull, Items: []DiagnosticValue{}}, nil
+	}
+	if !ok {
+		file, err := s.files.ReadFile(uri)
+		if err != nil {
+			log.Printf("pulling diagnostics of %s: %v", uri, err)
+			return &FullDocumentDiagnosticReportValue{Kind: reportFull, Items: []DiagnosticValue{}}, nil
+		}
+		snap = fileSnapshot(file)
+	}
+	full, unchanged := s.diagnosticReport(snap, params.PreviousResultID)
+	if unchanged != nil {
+		return unchanged, nil
+	}
+	return full, nil
+}
+
+// WorkspaceDiagnostic answers workspace/diagnostic with a report for every
+// file indexed in the workspace folders, reading each through the overlay
+// so open documents are checked as they are in the editor. Given a partial
+// result token, the reports are streamed in batches as $/progress
+// notifications and the response itself is empty. When the client has
+// results already and none of them changed, the request is held open until
+// one does or the client cancels it; then only the files that changed are
+// checked again. It blocks meanwhile, so it must not be called on the read
+// loop.
+func (s *Session) WorkspaceDiagnostic(body *parse.LspBody) (*WorkspaceDiagnosticReportValue, error) {
+	params := WorkspaceDiagnosticParamsValue{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return nil, errors.Wrap(err, "decoding workspace diagnostic params")
+	}
+	ctx, done := s.startRequest(body.Id)
+	defer done()
+	// started before the first pass, so a change during it is not missed
+	watch, stop := s.watchDiagnostics()
+	defer stop()
+
+	var changed map[lsp.DocumentURI]bool
+	for {
+		result, ok, err := s.workspaceReports(ctx, params, changed)
+		if err != nil || ok {
+			return result, err
+		}
+		select {
+		case <-watch.wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		select {
+		case <-time.After(workspaceDiagnosticDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		uris, all := watch.take()
+		if all {
+			uris = nil
+		}
+		changed = uris
+	}
+}
+
+// workspaceReports checks the workspace files for WorkspaceDiagnostic:
+// every one, or, given changed, only those in it and those the client has
+// no result for; the rest are known to be unchanged. It returns false,
+// having sent nothing, if the client has results already and every one of
+// them is unchanged. Files the client has results for that are gone get an
+// empty report.
+func (s *Session) workspaceReports(ctx context.Context, params WorkspaceDiagnosticParamsValue, changed map[lsp.DocumentURI]bool) (*WorkspaceDiagnosticReportValue, bool, error) {
+	previous := map[lsp.DocumentURI]string{}
+	for _, id := range params.PreviousResultIDs {
+		previous[docuri.Normalize(id.URI)] = id.Value
+	}
+	// unchanged is set while every report so far is unchanged; until one
+	// is not, nothing is streamed, in case the request is held
+	unchanged := len(previous) > 0
+
+	result := &WorkspaceDiagnosticReportValue{Items: []interface{}{}}
+	flush := func(final bool) error {
+		if unchanged || params.PartialResultToken == nil {
+			return nil
+		}
+		for len(result.Items) >= workspaceDiagnosticBatch || (final && len(result.Items) > 0) {
+			n := len(result.Items)
+			if n > workspaceDiagnosticBatch {
+				n = workspaceDiagnosticBatch
+			}
+			batch := &WorkspaceDiagnosticReportValue{Items: result.Items[:n]}
+			if err := s.conn.Notify(progress, &ProgressParamsValue{Token: params.PartialResultToken, Value: batch}); err != nil {
+				return errors.Wrap(err, "reporting workspace diagnostics")
+			}
+			result.Items = result.Items[n:]
+		}
+		return nil
+	}
+	add := func(uri lsp.DocumentURI, version *int, full *FullDocumentDiagnosticReportValue, same *UnchangedDocumentDiagnosticReportValue) error {
+		if same != nil {
+			result.Items = append(result.Items, &WorkspaceUnchangedDocumentDiagnosticReportValue{
+				UnchangedDocumentDiagnosticReportValue: *same,
+				URI:                                    uri,
+				Version:                                version,
+			})
+		} else {
+			unchanged = false
+			result.Items = append(result.Items, &WorkspaceFullDocumentDiagnosticReportValue{
+				FullDocumentDiagnosticReportValue: *full,
+				URI:                               uri,
+				Version:                           version,
+			})
+		}
+		return flush(false)
+	}
+
+	seen := map[lsp.DocumentURI]bool{}
+	for _, uri := range s.workspaceFiles() {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		key := docuri.Normalize(uri)
+		seen[key] = true
+		snap, open := s.documents.Get(uri)
+		if open && snap.OutOfSync {
+			continue
+		}
+		var version *int
+		if open {
+			v := snap.Version
+			version = &v
+		}
+		if id, ok := previous[key]; ok && changed != nil && !changed[key] {
+			same := &UnchangedDocumentDiagnosticReportValue{Kind: reportUnchanged, ResultID: id}
+			if err := add(uri, version, nil, same); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+
+		var full *FullDocumentDiagnosticReportValue
+		var same *UnchangedDocumentDiagnosticReportValue
+		if open {
+			full, same = s.diagnosticReport(snap, previous[key])
+		} else {
+			file, err := s.files.ReadFile(uri)
+			if err != nil {
+				if cause := errors.Cause(err); cause != overlay.ErrBinary && cause != overlay.ErrTooLarge {
+					log.Printf("pulling diagnostics of %s: %v", uri, err)
+				}
+				continue
+			}
+			full, same = s.fileReport(file, previous[key])
+		}
+		if err := add(uri, version, full, same); err != nil {
+			return nil, false, err
+		}
+	}
+
+	none := resultID([]DiagnosticValue{})
+	for _, id := range params.PreviousResultIDs {
+		key := docuri.Normalize(id.URI)
+		if seen[key] || id.Value == none || (changed != nil && !changed[key]) {
+			continue
+		}
+		seen[key] = true
+		full := &FullDocumentDiagnosticReportValue{Kind: reportFull, ResultID: none, Items: []DiagnosticValue{}}
+		if err := add(id.URI, nil, full, nil); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if unchanged {
+		return nil, false, nil
+	}
+	if err := flush(true); err != nil {
+		return nil, false, err
+	}
+	return result, true, nil
+}
+
+// workspaceFiles returns the files of every workspace folder, along with
+// the open documents in them that are not indexed yet, such as new files
+// not saved.
+func (s *Session) workspaceFiles() []lsp.DocumentURI {
+	var uris []lsp.DocumentURI
+	seen := map[lsp.DocumentURI]bool{}
+	for _, f := range s.folders.All() {
+		for _, uri := range f.Files() {
+			if !seen[uri] {
+				seen[uri] = true
+				uris = append(uris, uri)
+			}
+		}
+	}
+	for _, snap := range s.documents.All() {
+		if _, ok := s.folders.For(snap.URI); ok && !seen[snap.URI] {
+			seen[snap.URI] = true
+			uris = append(uris, snap.URI)
+		}
+	}
+	return uris
+}
+
+// diagnosticReport runs every check on snap. It returns an unchanged report
+// instead when the diagnostics are the ones previousResultID stands for.
+func (s *Session) diagnosticReport(snap *document.Snapshot, previousResultID string) (*FullDocumentDiagnosticReportValue, *UnchangedDocumentDiagnosticReportValue) {
+	items := append(s.checkFormat(snap), s.checkLint(snap)...)
+	items = append(items, s.checkSpelling(snap)...)
+	items = append(items, s.checkSecrets(snap)...)
+	if items == nil {
+		items = []DiagnosticValue{}
+	}
+	id := resultID(items)
+	if id == previousResultID {
+		return nil, &UnchangedDocumentDiagnosticReportValue{Kind: reportUnchanged, ResultID: id}
+	}
+	return &FullDocumentDiagnosticReportValue{Kind: reportFull, ResultID: id, Items: items}, nil
+}
+
+// keptReport is a full report on a file that is not open, kept while the
+// file's text, by its hash, stays the same.
+type keptReport struct {
+	hash   string
+	report *FullDocumentDiagnosticReportValue
+}
+
+// fileReport is diagnosticReport for a file that is not open. Files whose
+// text is the one last checked are not checked again, until something
+// every file depends on changes.
+func (s *Session) fileReport(file *overlay.File, previousResultID string) (*FullDocumentDiagnosticReportValue, *UnchangedDocumentDiagnosticReportValue) {
+	snap := fileSnapshot(file)
+	key := docuri.Normalize(file.URI)
+	s.diagnosticsMu.Lock()
+	// reports made with what was dropped meanwhile go with it
+	reports := s.fileReports
+	cached, ok := reports[key]
+	s.diagnosticsMu.Unlock()
+
+	if !ok || cached.hash != snap.Hash() {
+		full, _ := s.diagnosticReport(snap, "")
+		cached = keptReport{hash: snap.Hash(), report: full}
+		s.diagnosticsMu.Lock()
+		reports[key] = cached
+		s.diagnosticsMu.Unlock()
+	}
+	if cached.report.ResultID == previousResultID {
+		return nil, &UnchangedDocumentDiagnosticReportValue{Kind: reportUnchanged, ResultID: previousResultID}
+	}
+	return cached.report, nil
+}
+
+// dropFileReports forgets the reports fileReport keeps, after something
+// other than their text changed.
+func (s *Session) dropFileReports() {
+	s.diagnosticsMu.Lock()
+	s.fileReports = map[lsp.DocumentURI]keptReport{}
+	s.diagnosticsMu.Unlock()
+}
+
+// resultID identifies a set of diagnostics by their content.
+func resultID(items []DiagnosticValue) string {
+	data, err := json.Marshal(items)
+	if err != nil {
+		// diagnostics always marshal
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// fileSnapshot makes a file that is not open in the editor checkable like
+// a document that is.
+func fileSnapshot(file *overlay.File) *document.Snapshot {
+	return document.NewSnapshot(file.URI, languageOf(file.URI), file.Version, file.Text)
+}
+
+// languageOf guesses the language ID of a file that is not open, which the
+// client would otherwise have told us, from its extension.
+func languageOf(uri lsp.DocumentURI) string {
+	switch strings.ToLower(path.Ext(string(uri))) {
+	case ".md", ".markdown":
+		return "markdown"
+	case ".yaml", ".yml":
+		return "yaml"
+	default:
+		return "plaintext"
+	}
+}
@@ -0,0 +1,214 @@
+package tcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lsp/server/document"
+	"lsp/server/docuri"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnosticReport(t *testing.T) {
+	ts := newTestSession(t)
+	snap := document.NewSnapshot("file:///tmp/a.txt", "plaintext", 1, "foo\n")
+
+	full, unchanged := ts.diagnosticReport(snap, "")
+	require.Nil(t, unchanged)
+	require.Equal(t, reportFull, full.Kind)
+	require.NotEmpty(t, full.Items)
+	require.Equal(t, resultID(full.Items), full.ResultID)
+
+	// the same diagnostics, even of a new version, are unchanged
+	snap = document.NewSnapshot("file:///tmp/a.txt", "plaintext", 2, "foo\n")
+	again, unchanged := ts.diagnosticReport(snap, full.ResultID)
+	require.Nil(t, again)
+	require.Equal(t, &UnchangedDocumentDiagnosticReportValue{Kind: reportUnchanged, ResultID: full.ResultID}, unchanged)
+
+	snap = document.NewSnapshot("file:///tmp/a.txt", "plaintext", 3, "bar foo\n")
+	changed, unchanged := ts.diagnosticReport(snap, full.ResultID)
+	require.Nil(t, unchanged)
+	require.NotEqual(t, full.ResultID, changed.ResultID)
+
+	clean, _ := ts.diagnosticReport(document.NewSnapshot("file:///tmp/b.txt", "plaintext", 1, ""), "")
+	require.Equal(t, []DiagnosticValue{}, clean.Items)
+	require.Equal(t, resultID([]DiagnosticValue{}), clean.ResultID)
+}
+
+// workspaceDiagnostic calls WorkspaceDiagnostic in the background, as the
+// read loop does.
+func (ts *testSession) workspaceDiagnostic(id int, params WorkspaceDiagnosticParamsValue) <-chan workspaceDiagnosticResult {
+	body := ts.body("workspace/diagnostic", params)
+	body.Id = id
+	done := make(chan workspaceDiagnosticResult, 1)
+	go func() {
+		report, err := ts.WorkspaceDiagnostic(body)
+		done <- workspaceDiagnosticResult{report, err}
+	}()
+	return done
+}
+
+type workspaceDiagnosticResult struct {
+	report *WorkspaceDiagnosticReportValue
+	err    error
+}
+
+// partialResults returns the number of reports in each batch streamed for
+// token so far.
+func (ts *testSession) partialResults(token string) []int {
+	var batches []int
+	for _, m := range ts.messages() {
+		if m.Method != progress {
+			continue
+		}
+		var params struct {
+			Token string
+			Value struct{ Items []json.RawMessage }
+		}
+		require.NoError(ts.t, json.Unmarshal(m.Params, &params))
+		if params.Token == token {
+			batches = append(batches, len(params.Value.Items))
+		}
+	}
+	return batches
+}
+
+func TestWorkspaceDiagnosticBatches(t *testing.T) {
+	ts := newTestSession(t)
+	files := map[string]string{}
+	for i := 0; i < 2*workspaceDiagnosticBatch+20; i++ {
+		files[fmt.Sprintf("%03d.txt", i)] = "foo\n"
+	}
+	ts.addFolderWithFiles(files)
+
+	res := <-ts.workspaceDiagnostic(1, WorkspaceDiagnosticParamsValue{PartialResultToken: "partial"})
+	require.NoError(t, res.err)
+	require.Empty(t, res.report.Items, "everything was streamed")
+	require.Equal(t, []int{workspaceDiagnosticBatch, workspaceDiagnosticBatch, 20}, ts.partialResults("partial"))
+}
+
+func TestWorkspaceDiagnosticHeldUntilChange(t *testing.T) {
+	ts := newTestSession(t)
+	f := ts.addFolderWithFiles(map[string]string{"a.txt": "foo\n", "b.txt": "bar\n"})
+	uri := docuri.FromPath(filepath.Join(f.Path, "a.txt"))
+	ts.open(uri, "foo\n")
+
+	res := <-ts.workspaceDiagnostic(1, WorkspaceDiagnosticParamsValue{})
+	require.NoError(t, res.err)
+	var previous []PreviousResultIDValue
+	for _, item := range res.report.Items {
+		full := item.(*WorkspaceFullDocumentDiagnosticReportValue)
+		previous = append(previous, PreviousResultIDValue{URI: full.URI, Value: full.ResultID})
+	}
+	require.Len(t, previous, 2)
+
+	// nothing changed, so nothing is sent
+	held := ts.workspaceDiagnostic(2, WorkspaceDiagnosticParamsValue{PreviousResultIDs: previous, PartialResultToken: "partial"})
+	select {
+	case res := <-held:
+		t.Fatalf("answered with nothing changed: %+v", res)
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.Empty(t, ts.partialResults("partial"))
+
+	ts.change(uri, 2, "foo foo\n")
+	select {
+	case res = <-held:
+	case <-time.After(5 * time.Second):
+		t.Fatal("still held after a change")
+	}
+	require.NoError(t, res.err)
+	require.Equal(t, []int{2}, ts.partialResults("partial"))
+
+	// a file the client has diagnostics for that is gone gets none
+	gone := PreviousResultIDValue{URI: docuri.FromPath(filepath.Join(f.Path, "gone.txt")), Value: previous[0].Value}
+	res = <-ts.workspaceDiagnostic(3, WorkspaceDiagnosticParamsValue{PreviousResultIDs: append(previous, gone)})
+	require.NoError(t, res.err)
+	last := res.report.Items[len(res.report.Items)-1].(*WorkspaceFullDocumentDiagnosticReportValue)
+	require.Equal(t, gone.URI, last.URI)
+	require.Empty(t, last.Items)
+}
+
+func TestWorkspaceDiagnosticRechecksChanged(t *testing.T) {
+	ts := newTestSession(t)
+	f := ts.addFolderWithFiles(map[string]string{"a.txt": "foo\n", "b.txt": "bar\n"})
+	a := docuri.FromPath(filepath.Join(f.Path, "a.txt"))
+	b := docuri.FromPath(filepath.Join(f.Path, "b.txt"))
+	ts.open(a, "foo\n")
+
+	res := <-ts.workspaceDiagnostic(1, WorkspaceDiagnosticParamsValue{})
+	require.NoError(t, res.err)
+	var previous []PreviousResultIDValue
+	for _, item := range res.report.Items {
+		full := item.(*WorkspaceFullDocumentDiagnosticReportValue)
+		previous = append(previous, PreviousResultIDValue{URI: full.URI, Value: full.ResultID})
+	}
+	held := ts.workspaceDiagnostic(2, WorkspaceDiagnosticParamsValue{PreviousResultIDs: previous})
+	require.Eventually(t, func() bool {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		return len(ts.watches) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// b changes without the server being told, so only a change to a
+	// shows what is checked again
+	require.NoError(t, os.WriteFile(filepath.Join(f.Path, "b.txt"), []byte("foo\n"), 0644))
+	ts.Files().Invalidate(b)
+	ts.change(a, 2, "foo foo\n")
+	ts.change(a, 3, "bar\n")
+	select {
+	case res = <-held:
+	case <-time.After(5 * time.Second):
+		t.Fatal("still held after a change")
+	}
+	require.NoError(t, res.err)
+	kinds := map[lsp.DocumentURI]string{}
+	for _, item := range res.report.Items {
+		switch item := item.(type) {
+		case *WorkspaceFullDocumentDiagnosticReportValue:
+			kinds[item.URI] = item.Kind
+			require.Equal(t, 3, *item.Version, "the last of the edits")
+		case *WorkspaceUnchangedDocumentDiagnosticReportValue:
+			kinds[item.URI] = item.Kind
+		}
+	}
+	require.Equal(t, map[lsp.DocumentURI]string{a: reportFull, b: reportUnchanged}, kinds)
+}
+
+func TestWorkspaceDiagnosticCancel(t *testing.T) {
+	ts := newTestSession(t)
+	f := ts.addFolderWithFiles(map[string]string{"a.txt": "foo\n"})
+	uri := docuri.FromPath(filepath.Join(f.Path, "a.txt"))
+
+	res := <-ts.workspaceDiagnostic(1, WorkspaceDiagnosticParamsValue{})
+	require.NoError(t, res.err)
+	full := res.report.Items[0].(*WorkspaceFullDocumentDiagnosticReportValue)
+	previous := []PreviousResultIDValue{{URI: uri, Value: full.ResultID}}
+
+	held := ts.workspaceDiagnostic(2, WorkspaceDiagnosticParamsValue{PreviousResultIDs: previous})
+	// cancelling another request leaves it be
+	require.NoError(t, ts.CancelRequest(ts.body("$/cancelRequest", CancelParamsValue{ID: 3})))
+	require.Eventually(t, func() bool {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		return ts.requests[2] != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, ts.CancelRequest(ts.body("$/cancelRequest", CancelParamsValue{ID: 2})))
+	select {
+	case res = <-held:
+	case <-time.After(5 * time.Second):
+		t.Fatal("still held after being cancelled")
+	}
+	require.Equal(t, context.Canceled, res.err)
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	require.Empty(t, ts.requests)
+}
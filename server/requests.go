@@ -0,0 +1,113 @@
+package tcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"lsp/server/docuri"
+	"lsp/server/parse"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+type CancelParamsValue struct {
+	ID int `json:"id"`
+}
+
+// startRequest returns the context of the request with the given id, done
+// once $/cancelRequest names it or the session is closed, and the function
+// to call when the request is answered.
+func (s *Session) startRequest(id int) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.requests[id] = cancel
+	s.mu.Unlock()
+	return ctx, func() {
+		s.mu.Lock()
+		delete(s.requests, id)
+		s.mu.Unlock()
+		cancel()
+	}
+}
+
+// CancelRequest handles $/cancelRequest. Requests that are answered
+// already, or that cannot be cancelled, are left alone.
+func (s *Session) CancelRequest(body *parse.LspBody) error {
+	params := CancelParamsValue{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return errors.Wrap(err, "decoding cancelRequest params")
+	}
+	s.mu.Lock()
+	cancel, ok := s.requests[params.ID]
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return nil
+}
+
+// diagnosticsWatch collects what may have changed the diagnostics a
+// request waits on: the files, by normalized URI, or every file.
+type diagnosticsWatch struct {
+	// wake has a value while there are changes to take.
+	wake chan struct{}
+
+	mu   sync.Mutex
+	uris map[lsp.DocumentURI]bool
+	all  bool
+}
+
+func (w *diagnosticsWatch) add(uris []lsp.DocumentURI) {
+	w.mu.Lock()
+	if len(uris) == 0 {
+		w.all = true
+	}
+	for _, uri := range uris {
+		w.uris[docuri.Normalize(uri)] = true
+	}
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the files changed since it was last called, or true if
+// every file may have.
+func (w *diagnosticsWatch) take() (map[lsp.DocumentURI]bool, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	uris, all := w.uris, w.all
+	w.uris, w.all = map[lsp.DocumentURI]bool{}, false
+	return uris, all
+}
+
+// watchDiagnostics starts collecting changes to diagnostics, until the
+// function it returns is called.
+func (s *Session) watchDiagnostics() (*diagnosticsWatch, func()) {
+	w := &diagnosticsWatch{wake: make(chan struct{}, 1), uris: map[lsp.DocumentURI]bool{}}
+	s.mu.Lock()
+	s.watches[w] = true
+	s.mu.Unlock()
+	return w, func() {
+		s.mu.Lock()
+		delete(s.watches, w)
+		s.mu.Unlock()
+	}
+}
+
+// diagnosticsMayChange tells whatever waits for diagnostics that those of
+// the files at uris may have changed, or those of every file if none are
+// given: something they all depend on did.
+func (s *Session) diagnosticsMayChange(uris ...lsp.DocumentURI) {
+	if len(uris) == 0 {
+		s.dropFileReports()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for w := range s.watches {
+		w.add(uris)
+	}
+}
@@ -0,0 +1,127 @@
+package tcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"lsp/server/document"
+	"lsp/server/onsave"
+	"lsp/server/parse"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// defaultSaveBudget bounds how long willSaveWaitUntil may hold up a save.
+// VS Code gives up on participants after about 1.5s.
+const defaultSaveBudget = 500 * time.Millisecond
+
+// WillSaveParamsValue is the params of textDocument/willSave and
+// textDocument/willSaveWaitUntil.
+type WillSaveParamsValue struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+	Reason       int                        `json:"reason"`
+}
+
+// saveSettings is the part of a folder's settings about what is done to
+// documents before they are saved. Each hook runs only if it is turned on
+// by name:
+//
+//	{"plaintext": {"onSave": {"trimTrailingWhitespace": true, "insertFinalNewline": true}}}
+type saveSettings struct {
+	OnSave map[string]bool `json:"onSave"`
+}
+
+// RegisterSaveHook adds a hook whose edits are offered before a save, in
+// the folders whose settings turn it on.
+func (s *Session) RegisterSaveHook(hook onsave.Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveHooks = append(s.saveHooks, hook)
+}
+
+// OnDidSave registers fn to be called with the saved document after every
+// textDocument/didSave.
+func (s *Session) OnDidSave(fn func(snap *document.Snapshot)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveListeners = append(s.saveListeners, fn)
+}
+
+func (s *Session) WillSave(body *parse.LspBody) error {
+	params := WillSaveParamsValue{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return errors.Wrap(err, "decoding willSave params")
+	}
+	if _, ok := s.documents.Get(params.TextDocument.URI); !ok {
+		return errors.Wrapf(document.ErrNotOpen, "will save %s", params.TextDocument.URI)
+	}
+	return nil
+}
+
+// WillSaveWaitUntil returns the edits the save hooks turned on for the
+// document's folder want made before it is written, within the save
+// budget. Documents outside any folder are saved as they are.
+func (s *Session) WillSaveWaitUntil(body *parse.LspBody) ([]lsp.TextEdit, error) {
+	params := WillSaveParamsValue{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return nil, errors.Wrap(err, "decoding willSaveWaitUntil params")
+	}
+	snap, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Wrapf(document.ErrNotOpen, "will save %s", params.TextDocument.URI)
+	}
+
+	var settings saveSettings
+	if f, ok := s.folders.For(snap.URI); ok {
+		if err := f.DecodeSettings(&settings); err != nil {
+			log.Printf("saving %s: %v", snap.URI, err)
+		}
+	}
+	s.mu.Lock()
+	var hooks []onsave.Hook
+	for _, hook := range s.saveHooks {
+		if settings.OnSave[hook.Name] {
+			hooks = append(hooks, hook)
+		}
+	}
+	budget := s.saveBudget
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), budget)
+	defer cancel()
+
+	enc := s.Encoding()
+	textEdits := []lsp.TextEdit{}
+	for _, edit := range onsave.Run(ctx, snap.Text(), hooks) {
+		rng, err := snap.RangeOf(edit.Start, edit.End, enc)
+		if err != nil {
+			return nil, errors.Wrap(err, "converting save edit")
+		}
+		textEdits = append(textEdits, lsp.TextEdit{Range: rng, NewText: edit.NewText})
+	}
+	return textEdits, nil
+}
+
+func (s *Session) DidSave(body *parse.LspBody) error {
+	params := lsp.DidSaveTextDocumentParams{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return errors.Wrap(err, "decoding didSave params")
+	}
+	snap, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return errors.Wrapf(document.ErrNotOpen, "saving %s", params.TextDocument.URI)
+	}
+
+	s.mu.Lock()
+	listeners := make([]func(*document.Snapshot), len(s.saveListeners))
+	copy(listeners, s.saveListeners)
+	s.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(snap)
+	}
+	return nil
+}
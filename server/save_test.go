@@ -0,0 +1,50 @@
+package tcpserver
+
+import (
+	"path/filepath"
+	"testing"
+
+	"lsp/server/docuri"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWillSaveWaitUntilHooks(t *testing.T) {
+	ts := newTestSession(t)
+	on := ts.addFolder(`{"onSave": {"trimTrailingWhitespace": true, "normalizeQuotes": false}}`)
+	off := ts.addFolder("")
+
+	tests := []struct {
+		name string
+		uri  lsp.DocumentURI
+		want int
+	}{
+		{name: "only the hooks turned on run", uri: docuri.FromPath(filepath.Join(on.Path, "a.txt")), want: 1},
+		{name: "no hook runs unless turned on", uri: docuri.FromPath(filepath.Join(off.Path, "a.txt"))},
+		{name: "outside any folder", uri: "untitled:Untitled-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.open(tt.uri, "“quoted”  \nno final newline")
+			edits, err := ts.WillSaveWaitUntil(ts.body("textDocument/willSaveWaitUntil", WillSaveParamsValue{
+				TextDocument: lsp.TextDocumentIdentifier{URI: tt.uri},
+				Reason:       1,
+			}))
+			require.NoError(t, err)
+			require.Len(t, edits, tt.want)
+		})
+	}
+}
+
+func TestDidSaveChecks(t *testing.T) {
+	ts := newTestSession(t)
+	uri := docuri.FromPath(filepath.Join(ts.addFolder("").Path, "a.txt"))
+	ts.open(uri, "text\n")
+	before := len(ts.published(uri))
+
+	require.NoError(t, ts.DidSave(ts.body("textDocument/didSave", lsp.DidSaveTextDocumentParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+	})))
+	require.Greater(t, len(ts.published(uri)), before)
+}
@@ -0,0 +1,52 @@
+package secret
+
+import "strings"
+
+// BaselineFile is the name of the file at the root of a workspace folder
+// listing the secrets found in it that are known not to be secret, such as
+// the examples of a document about keys.
+const BaselineFile = ".plaintextsecrets.txt"
+
+// Baseline is a list of known secrets: one fingerprint a line, which may be
+// followed by anything, such as the kind of secret and the file it is in,
+// with blank lines and lines starting with # ignored. The secrets
+// themselves are not written down.
+type Baseline struct {
+	fingerprints map[string]bool
+}
+
+// ParseBaseline reads a baseline.
+func ParseBaseline(text string) *Baseline {
+	b := &Baseline{fingerprints: map[string]bool{}}
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		b.fingerprints[fields[0]] = true
+	}
+	return b
+}
+
+// Has reports whether f is a known secret. A nil baseline knows none.
+func (b *Baseline) Has(f Finding) bool {
+	return b != nil && b.fingerprints[f.Fingerprint()]
+}
+
+// Len returns how many secrets the baseline knows.
+func (b *Baseline) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.fingerprints)
+}
+
+// AppendEntry returns text, the contents of a baseline, with the secret
+// whose fingerprint is given added on a line of its own at the end. The
+// line notes its code and where it was found, for whoever reads the file.
+func AppendEntry(text, fingerprint, code, where, eol string) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += eol
+	}
+	return text + strings.TrimSpace(strings.Join([]string{fingerprint, code, where}, " ")) + eol
+}
@@ -0,0 +1,26 @@
+package secret
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseline(t *testing.T) {
+	known := Scan("AKIA" + "IOSFODNN7EXAMPLE")[0]
+	other := Scan("AKIA" + "IOSFODNN8EXAMPLE")[0]
+
+	text := AppendEntry("# examples in the docs", known.Fingerprint(), known.Detector.Code, "docs/keys.md", "\r\n")
+	require.Equal(t, "# examples in the docs\r\n"+known.Fingerprint()+" aws-access-key docs/keys.md\r\n", text)
+
+	b := ParseBaseline(text)
+	require.Equal(t, 1, b.Len())
+	require.True(t, b.Has(known))
+	require.False(t, b.Has(other))
+
+	require.Equal(t, other.Fingerprint()+"\n", AppendEntry("", other.Fingerprint(), "", "", "\n"))
+
+	var none *Baseline
+	require.False(t, none.Has(known))
+	require.Zero(t, none.Len())
+}
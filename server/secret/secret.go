@@ -0,0 +1,282 @@
+// Package secret finds credentials pasted into text: keys and tokens of
+// well-known formats, private key blocks, JSON web tokens, and values that
+// look random next to words such as password or token.
+package secret
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Redacted is what a secret is replaced with when it is redacted.
+const Redacted = "[REDACTED]"
+
+// Codes of the kinds of secret.
+const (
+	CodePrivateKey    = "private-key"
+	CodeAWSAccessKey  = "aws-access-key"
+	CodeGoogleAPIKey  = "google-api-key"
+	CodeAzureKey      = "azure-storage-key"
+	CodeGitHubToken   = "github-token"
+	CodeSlackToken    = "slack-token"
+	CodeStripeKey     = "stripe-key"
+	CodeJWT           = "jwt"
+	CodeGenericSecret = "generic-secret"
+)
+
+// minEntropy is how many bits of entropy a character a value next to a
+// word like password must have to be taken for a secret, and minLength
+// how long it must be. Words and sentences stay below.
+const (
+	minEntropy = 3.5
+	minLength  = 16
+)
+
+// Detector finds one kind of secret.
+type Detector struct {
+	Code string
+	// Description names the kind of secret, as in "AWS access key ID".
+	Description string
+
+	pattern *regexp.Regexp
+	// valid, if set, rejects matches that only look like the secret.
+	valid func(match string) bool
+}
+
+// Finding is a secret in a text, at byte offsets [Start, End).
+type Finding struct {
+	Start    int
+	End      int
+	Text     string
+	Detector *Detector
+}
+
+var (
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)
+	privateKeyEnd   = regexp.MustCompile(`-----END (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----$`)
+	base64Chars     = regexp.MustCompile(`[A-Za-z0-9+/]`)
+)
+
+// detectors are tried in order; a match overlapping one already found is
+// dropped, so the formats that are sure come before the guesses.
+var detectors = []*Detector{
+	{
+		Code:        CodePrivateKey,
+		Description: "private key",
+		// to the end marker, or over the lines of key of a block that has
+		// none
+		pattern: regexp.MustCompile(`(?s)-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----` +
+			`(?:.*?-----END (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----|[A-Za-z0-9+/=\r\n\\]*)`),
+		valid: func(match string) bool {
+			body := privateKeyBegin.ReplaceAllString(privateKeyEnd.ReplaceAllString(match, ""), "")
+			// placeholders such as "..." are not keys
+			return len(base64Chars.FindAllStringIndex(body, -1)) >= 64
+		},
+	},
+	{
+		Code:        CodeAWSAccessKey,
+		Description: "AWS access key ID",
+		pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[A-Z0-9]{16}\b`),
+	},
+	{
+		Code:        CodeGoogleAPIKey,
+		Description: "Google API key",
+		pattern:     regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`),
+	},
+	{
+		Code:        CodeAzureKey,
+		Description: "Azure storage account key",
+		pattern:     regexp.MustCompile(`(?i)\bAccountKey=([A-Za-z0-9+/]{86}==)`),
+	},
+	{
+		Code:        CodeGitHubToken,
+		Description: "GitHub token",
+		pattern:     regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{82})\b`),
+	},
+	{
+		Code:        CodeSlackToken,
+		Description: "Slack token",
+		pattern:     regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`),
+	},
+	{
+		Code:        CodeStripeKey,
+		Description: "Stripe secret key",
+		pattern:     regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{24,}\b`),
+	},
+	{
+		Code:        CodeJWT,
+		Description: "JSON web token",
+		pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		valid:       validJWT,
+	},
+	{
+		Code:        CodeGenericSecret,
+		Description: "password or token",
+		// a word naming a secret, perhaps part of a longer identifier,
+		// then a separator and the value. The separator is required, so
+		// the rest of an identifier like passwordResetTokenExpiry is not
+		// taken for a value, and a value does not start with a slash, so
+		// neither is the rest of a path like /token/name.
+		pattern: regexp.MustCompile(`(?i)(?:password|passwd|passphrase|pwd|secret|token|api[_-]?key|access[_-]?key|auth[_-]?key|credentials?)` +
+			`\w*["']?(?:[ \t]*(?::=|=>|[:=])[ \t]*|[ \t]+is[ \t]+)["'` + "`" + `]?` +
+			`([A-Za-z0-9+_\-.~!@#%^&*][A-Za-z0-9+/=_\-.~!@#%^&*]{15,})`),
+		valid: random,
+	},
+}
+
+// Detectors returns what Scan looks for, in the order it does.
+func Detectors() []*Detector {
+	return append([]*Detector(nil), detectors...)
+}
+
+// Scan returns the secrets in text, in order. A detector whose pattern has
+// a group reports the group, so that only the value of "token: value" is
+// flagged.
+func Scan(text string) []Finding {
+	var findings []Finding
+	for _, d := range detectors {
+		for _, m := range d.pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if len(m) > 2 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			// a block without an end marker stops at its last line of key
+			end = start + len(strings.TrimRight(text[start:end], "\r\n\\"))
+			match := text[start:end]
+			if d.valid != nil && !d.valid(match) {
+				continue
+			}
+			if overlapsAny(findings, start, end) {
+				continue
+			}
+			findings = append(findings, Finding{Start: start, End: end, Text: match, Detector: d})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Start < findings[j].Start })
+	return findings
+}
+
+func overlapsAny(findings []Finding, start, end int) bool {
+	for _, f := range findings {
+		if start < f.End && f.Start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// Fingerprint identifies the secret without giving it away, so that it can
+// be written down as known.
+func (f Finding) Fingerprint() string {
+	sum := sha256.Sum256([]byte(f.Text))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Redacted returns the text to replace the secret with. A private key keeps
+// its markers, so that it is still clear what was there.
+func (f Finding) Redacted() string {
+	if f.Detector.Code != CodePrivateKey {
+		return Redacted
+	}
+	begin := privateKeyBegin.FindString(f.Text)
+	end := privateKeyEnd.FindString(f.Text)
+	body := f.Text[len(begin) : len(f.Text)-len(end)]
+	// the line breaks around the key stay, escaped or not
+	lead := 0
+	for n := breakLen(body, lead, true); n > 0; n = breakLen(body, lead, true) {
+		lead += n
+	}
+	trail := len(body)
+	for n := breakLen(body[lead:], trail-lead, false); n > 0; n = breakLen(body[lead:], trail-lead, false) {
+		trail -= n
+	}
+	return begin + body[:lead] + Redacted + body[trail:] + end
+}
+
+// breakLen returns the length of the white space or escaped line break
+// starting at i in s, or ending there if after is false, and 0 if there is
+// none.
+func breakLen(s string, i int, after bool) int {
+	if after {
+		s = s[i:]
+	} else {
+		s = s[:i]
+	}
+	switch {
+	case after && strings.HasPrefix(s, `\n`), !after && strings.HasSuffix(s, `\n`):
+		return 2
+	case s == "":
+		return 0
+	case after && strings.IndexByte(" \t\r\n", s[0]) >= 0, !after && strings.IndexByte(" \t\r\n", s[len(s)-1]) >= 0:
+		return 1
+	}
+	return 0
+}
+
+// validJWT reports whether token has a header that decodes to one naming
+// its algorithm.
+func validJWT(token string) bool {
+	header := token[:strings.IndexByte(token, '.')]
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(header, "="))
+	if err != nil {
+		return false
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	_, ok := fields["alg"]
+	return ok
+}
+
+// random reports whether value looks generated rather than written: long,
+// varied and mixing digits with letters or three kinds of character, so
+// that identifiers and placeholders such as YOUR_API_KEY are left alone.
+func random(value string) bool {
+	if len(value) < minLength || entropy(value) < minEntropy {
+		return false
+	}
+	var lower, upper, digit, other bool
+	for _, r := range value {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	kinds := 0
+	for _, b := range []bool{lower, upper, digit, other} {
+		if b {
+			kinds++
+		}
+	}
+	return kinds >= 3 || (digit && (lower || upper))
+}
+
+// entropy returns the Shannon entropy of s in bits a character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
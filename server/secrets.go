@@ -0,0 +1,198 @@
+package tcpserver
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"lsp/server/document"
+	"lsp/server/docuri"
+	"lsp/server/secret"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// commandAcknowledgeSecret adds a secret to the baseline of the workspace
+// folder holding a document, so that it is no longer reported. It takes
+// the document URI, the fingerprint of the secret and its code.
+const commandAcknowledgeSecret = "plaintext.acknowledgeSecret"
+
+// secretHit is a secret along with the diagnostic reported for it.
+type secretHit struct {
+	finding    secret.Finding
+	diagnostic DiagnosticValue
+}
+
+// checkSecrets reports every secret in snap.
+func (s *Session) checkSecrets(snap *document.Snapshot) []DiagnosticValue {
+	var diagnostics []DiagnosticValue
+	for _, hit := range s.secretHits(snap) {
+		diagnostics = append(diagnostics, hit.diagnostic)
+	}
+	return diagnostics
+}
+
+// secretHits scans snap for secrets, leaving out those in the baseline of
+// its folder. The baseline itself holds only fingerprints and is not
+// scanned.
+func (s *Session) secretHits(snap *document.Snapshot) []secretHit {
+	if s.isSecretBaseline(snap.URI) {
+		return nil
+	}
+	baseline := s.secretBaseline(snap.URI)
+	enc := s.Encoding()
+	var hits []secretHit
+	for _, f := range secret.Scan(snap.Text()) {
+		if baseline.Has(f) {
+			continue
+		}
+		rng, err := snap.RangeOf(f.Start, f.End, enc)
+		if err != nil {
+			log.Printf("scanning %s for secrets: %v", snap.URI, err)
+			break
+		}
+		hits = append(hits, secretHit{
+			finding: f,
+			diagnostic: DiagnosticValue{
+				Range:    rng,
+				Severity: lsp.Error,
+				Code:     f.Detector.Code,
+				Source:   diagnosticSource,
+				Message:  fmt.Sprintf("possible %s in plain text; if it is real, revoke it as well as removing it", f.Detector.Description),
+			},
+		})
+	}
+	return hits
+}
+
+// secretBaseline returns the baseline of the folder holding the document at
+// uri, read from the editor if it is open there and from disk otherwise,
+// or nil outside any folder. Baselines are kept until they change.
+func (s *Session) secretBaseline(uri lsp.DocumentURI) *secret.Baseline {
+	f, ok := s.folders.For(uri)
+	if !ok {
+		return nil
+	}
+	path := filepath.Join(f.Path, secret.BaselineFile)
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+	if b, ok := s.baselines[path]; ok {
+		return b
+	}
+	var text string
+	if snap, open := s.documents.Get(docuri.FromPath(path)); open {
+		text = snap.Text()
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("reading secrets baseline: %v", err)
+		}
+		text = string(data)
+	}
+	b := secret.ParseBaseline(text)
+	s.baselines[path] = b
+	return b
+}
+
+// isSecretBaseline reports whether uri is the baseline of a workspace
+// folder.
+func (s *Session) isSecretBaseline(uri lsp.DocumentURI) bool {
+	path, err := docuri.Filename(uri)
+	if err != nil {
+		return false
+	}
+	f, ok := s.folders.For(uri)
+	return ok && path == filepath.Join(f.Path, secret.BaselineFile)
+}
+
+// secretBaselineChanged forgets the baseline at uri, if it is one, so that
+// it is read again, and scans the open documents of its folder again.
+func (s *Session) secretBaselineChanged(uri lsp.DocumentURI) {
+	if !s.isSecretBaseline(uri) {
+		return
+	}
+	path, _ := docuri.Filename(uri)
+	s.secretsMu.Lock()
+	delete(s.baselines, path)
+	s.secretsMu.Unlock()
+
+	f, _ := s.folders.For(uri)
+	for _, snap := range s.documents.All() {
+		if f.Contains(snap.URI) && snap.URI != uri {
+			s.documentChanged(snap)
+		}
+	}
+	// files that are not open are affected too
+	s.refreshDiagnostics()
+}
+
+// acknowledgeSecret adds the secret with the given fingerprint, found in
+// the document at uri, to the baseline of its folder. An open baseline is
+// edited through the client; otherwise the file is written, created if
+// need be, and read again.
+func (s *Session) acknowledgeSecret(uri lsp.DocumentURI, fingerprint, code string) error {
+	f, ok := s.folders.For(uri)
+	if !ok {
+		return errors.Errorf("%s is not in a workspace folder", uri)
+	}
+	path := filepath.Join(f.Path, secret.BaselineFile)
+	// where the secret was found, for whoever reads the file
+	var where string
+	if name, err := docuri.Filename(uri); err == nil {
+		if rel, err := filepath.Rel(f.Path, name); err == nil {
+			where = filepath.ToSlash(rel)
+		}
+	}
+
+	baseline := docuri.FromPath(path)
+	if snap, open := s.documents.Get(baseline); open {
+		text := snap.Text()
+		eol := string(snap.LineEndings().Dominant())
+		rng, err := snap.RangeOf(len(text), len(text), s.Encoding())
+		if err != nil {
+			return err
+		}
+		entry := secret.AppendEntry(text, fingerprint, code, where, eol)[len(text):]
+		return s.applyEdit("Add secret to the baseline", *textEdit(snap.URI, rng, entry))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "reading secrets baseline")
+	}
+	text := secret.AppendEntry(string(data), fingerprint, code, where, "\n")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		return errors.Wrap(err, "writing secrets baseline")
+	}
+	s.files.Invalidate(baseline)
+	s.secretBaselineChanged(baseline)
+	return nil
+}
+
+// secretFixes returns the fixes for one secret: redacting it and, in a
+// workspace folder, adding it to the baseline.
+func (s *Session) secretFixes(snap *document.Snapshot, hit secretHit) []CodeActionValue {
+	diagnostics := []DiagnosticValue{hit.diagnostic}
+	actions := []CodeActionValue{{
+		Title:       fmt.Sprintf("Redact %s", hit.finding.Detector.Description),
+		Kind:        codeActionQuickFix,
+		Diagnostics: diagnostics,
+		IsPreferred: true,
+		Edit:        textEdit(snap.URI, hit.diagnostic.Range, hit.finding.Redacted()),
+	}}
+	if _, ok := s.folders.For(snap.URI); ok {
+		actions = append(actions, CodeActionValue{
+			Title:       "Add to the secrets baseline as not secret",
+			Kind:        codeActionQuickFix,
+			Diagnostics: diagnostics,
+			Command: &lsp.Command{
+				Title:     "Acknowledge secret",
+				Command:   commandAcknowledgeSecret,
+				Arguments: []interface{}{snap.URI, hit.finding.Fingerprint(), hit.finding.Detector.Code},
+			},
+		})
+	}
+	return actions
+}
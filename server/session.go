@@ -0,0 +1,161 @@
+package tcpserver
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"lsp/server/document"
+	"lsp/server/lint"
+	"lsp/server/onsave"
+	"lsp/server/overlay"
+	"lsp/server/position"
+	"lsp/server/secret"
+	"lsp/server/spell"
+	"lsp/server/watch"
+	"lsp/server/workspace"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// Session holds the state negotiated with a single client connection.
+type Session struct {
+	mu                 sync.Mutex
+	conn               *Conn
+	encoding           position.Encoding
+	clientCapabilities ClientCapabilitiesValue
+	documents          *document.Store
+	files              *overlay.FS
+	folders            *workspace.Set
+
+	// linter checks documents outside any folder with a lint
+	// configuration file; linters holds those of the folders with one, by
+	// path.
+	linter  *lint.Engine
+	linters map[string]*folderLinter
+
+	// dictionaries holds the spelling dictionaries loaded so far, by the
+	// path of their affix file, and nil for those that failed to load;
+	// missingDictionaries the languages found in none of the paths.
+	// wordLists holds the word lists read so far, by path, and addedWords
+	// the words added to each that it did not have when last read;
+	// userWords is the path of the user's own.
+	spellMu             sync.Mutex
+	dictionaries        map[string]*spell.Dictionary
+	missingDictionaries map[string]bool
+	wordLists           map[string]*spell.WordList
+	addedWords          map[string][]string
+	userWords           string
+
+	// baselines holds the secrets baselines read so far, by path.
+	secretsMu sync.Mutex
+	baselines map[string]*secret.Baseline
+
+	saveHooks     []onsave.Hook
+	saveListeners []func(*document.Snapshot)
+	saveBudget    time.Duration
+
+	// fileReports holds the diagnostic reports of files that are not
+	// open, by normalized URI, for as long as nothing but their text can
+	// change them.
+	diagnosticsMu sync.Mutex
+	diagnostics   map[lsp.DocumentURI]*diagnosticSet // by normalized URI
+	fileReports   map[lsp.DocumentURI]keptReport
+
+	fileListeners []func(lsp.DocumentURI, lsp.FileChangeType)
+	watcher       *watch.Watcher
+
+	// workDoneTokens counts the progress tokens made so far, to keep them
+	// apart.
+	workDoneTokens int
+
+	// requests holds the cancellation of the requests being answered in
+	// the background, by ID; watches those waiting for diagnostics to
+	// change.
+	requests map[int]context.CancelFunc
+	watches  map[*diagnosticsWatch]bool
+}
+
+func NewSession(out io.Writer) *Session {
+	documents := document.NewStore()
+	linter, err := lint.New(lint.DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+	s := &Session{
+		conn:       NewConn(out),
+		encoding:   position.UTF16,
+		documents:  documents,
+		files:      overlay.New(documents, overlay.Options{}),
+		folders:    workspace.NewSet(),
+		linter:     linter,
+		saveHooks:  onsave.Builtin(),
+		saveBudget: defaultSaveBudget,
+
+		diagnostics: map[lsp.DocumentURI]*diagnosticSet{},
+		fileReports: map[lsp.DocumentURI]keptReport{},
+		linters:     map[string]*folderLinter{},
+
+		dictionaries:        map[string]*spell.Dictionary{},
+		missingDictionaries: map[string]bool{},
+		wordLists:           map[string]*spell.WordList{},
+		addedWords:          map[string][]string{},
+		userWords:           userWordList(),
+
+		baselines: map[string]*secret.Baseline{},
+
+		requests: map[int]context.CancelFunc{},
+		watches:  map[*diagnosticsWatch]bool{},
+	}
+	// what is on disk may matter, as for word lists and configuration
+	// files, so a save checks the document again
+	s.OnDidSave(s.documentChanged)
+	s.OnFileChange(s.lintConfigChanged)
+	s.OnFileChange(func(uri lsp.DocumentURI, _ lsp.FileChangeType) {
+		// while the list or baseline is open, the editor's copy is the one that applies
+		if _, open := s.documents.Get(uri); !open {
+			s.wordListChanged(uri)
+			s.secretBaselineChanged(uri)
+		}
+	})
+	return s
+}
+
+// Conn returns the connection messages to the client are written to.
+func (s *Session) Conn() *Conn {
+	return s.conn
+}
+
+// Documents returns the store of documents the client has open.
+func (s *Session) Documents() *document.Store {
+	return s.documents
+}
+
+// Files returns the workspace files, with open documents taking priority
+// over what is on disk.
+func (s *Session) Files() *overlay.FS {
+	return s.files
+}
+
+// Close releases what the session holds once the client has gone.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	w := s.watcher
+	s.watcher = nil
+	for _, cancel := range s.requests {
+		cancel()
+	}
+	s.mu.Unlock()
+	if w != nil {
+		return w.Close()
+	}
+	return nil
+}
+
+// Encoding returns the position encoding negotiated during initialize.
+func (s *Session) Encoding() position.Encoding {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoding
+}
@@ -0,0 +1,155 @@
+package tcpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lsp/server/docuri"
+	"lsp/server/parse"
+	"lsp/server/workspace"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+// testSession is a session whose messages to the client are kept, to be
+// looked at by tests.
+type testSession struct {
+	*Session
+	t   *testing.T
+	out *syncBuffer
+}
+
+// syncBuffer is a buffer that background work may write to as well.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// testMessage is a message the server sent: a notification, a request or
+// a response.
+type testMessage struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+}
+
+func newTestSession(t *testing.T) *testSession {
+	out := &syncBuffer{}
+	s := NewSession(out)
+	// tests must not see the user's own words
+	s.userWords = ""
+	t.Cleanup(func() { s.Close() })
+	return &testSession{Session: s, t: t, out: out}
+}
+
+// addFolder adds a workspace folder at a new directory with the given
+// settings, as the client would send them for the plaintext section.
+func (ts *testSession) addFolder(settings string) *workspace.Folder {
+	f, err := ts.Session.addFolder(docuri.FromPath(ts.t.TempDir()), "ws")
+	require.NoError(ts.t, err)
+	if settings != "" {
+		f.SetSettings(json.RawMessage(settings))
+	}
+	return f
+}
+
+// addFolderWithFiles adds a workspace folder holding files, by path
+// relative to it, and waits for them to be indexed.
+func (ts *testSession) addFolderWithFiles(files map[string]string) *workspace.Folder {
+	dir := ts.t.TempDir()
+	for name, text := range files {
+		require.NoError(ts.t, os.WriteFile(filepath.Join(dir, name), []byte(text), 0644))
+	}
+	f, err := ts.Session.addFolder(docuri.FromPath(dir), "ws")
+	require.NoError(ts.t, err)
+	require.Eventually(ts.t, func() bool { return len(f.Files()) == len(files) }, 5*time.Second, 10*time.Millisecond)
+	return f
+}
+
+// body makes the body of a message with the given params.
+func (ts *testSession) body(method string, params interface{}) *parse.LspBody {
+	data, err := json.Marshal(params)
+	require.NoError(ts.t, err)
+	return &parse.LspBody{Jsonrpc: "2.0", Method: method, Params: data}
+}
+
+func (ts *testSession) open(uri lsp.DocumentURI, text string) {
+	require.NoError(ts.t, ts.DidOpen(ts.body("textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, LanguageID: "plaintext", Version: 1, Text: text},
+	})))
+}
+
+// change replaces the whole text of the document at uri.
+func (ts *testSession) change(uri lsp.DocumentURI, version int, text string) {
+	require.NoError(ts.t, ts.DidChange(ts.body("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+		"contentChanges": []map[string]interface{}{{"text": text}},
+	})))
+}
+
+// messages returns what the server has sent so far.
+func (ts *testSession) messages() []testMessage {
+	var messages []testMessage
+	rest := ts.out.String()
+	for rest != "" {
+		header := strings.Index(rest, "\r\n\r\n")
+		require.True(ts.t, header > 0, "message header in %q", rest)
+		n, err := strconv.Atoi(strings.TrimPrefix(rest[:header], "Content-Length: "))
+		require.NoError(ts.t, err)
+		body := rest[header+4 : header+4+n]
+		rest = rest[header+4+n:]
+		var m testMessage
+		require.NoError(ts.t, json.Unmarshal([]byte(body), &m))
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+// published returns every set of diagnostics published for uri, oldest
+// first.
+func (ts *testSession) published(uri lsp.DocumentURI) [][]DiagnosticValue {
+	var sets [][]DiagnosticValue
+	for _, m := range ts.messages() {
+		if m.Method != publishDiagnostics {
+			continue
+		}
+		var params PublishDiagnosticsParamsValue
+		require.NoError(ts.t, json.Unmarshal(m.Params, &params))
+		if docuri.Normalize(params.URI) == docuri.Normalize(uri) {
+			sets = append(sets, params.Diagnostics)
+		}
+	}
+	return sets
+}
+
+// codes returns the codes of the diagnostics last published for uri.
+func (ts *testSession) codes(uri lsp.DocumentURI) []string {
+	sets := ts.published(uri)
+	require.NotEmpty(ts.t, sets, "diagnostics of %s", uri)
+	var codes []string
+	for _, d := range sets[len(sets)-1] {
+		codes = append(codes, d.Code)
+	}
+	return codes
+}
@@ -0,0 +1,204 @@
+package tcpserver
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"lsp/server/document"
+	"lsp/server/spell"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// codeSpelling is the code of misspelled words.
+const codeSpelling = "spelling"
+
+// maxSpellingDiagnostics bounds how many misspellings of a document are
+// reported, so a document in another language than the dictionary's is
+// not buried in them.
+const maxSpellingDiagnostics = 500
+
+// maxSpellingSuggestions is how many replacements are offered for a
+// misspelled word.
+const maxSpellingSuggestions = 5
+
+// defaultSpellLanguage is the dictionary documents are checked with unless
+// the settings name another.
+const defaultSpellLanguage = "en_US"
+
+// defaultDictionaryPaths are where dictionaries are looked for after the
+// paths the settings list, which is where distributions install them.
+var defaultDictionaryPaths = []string{
+	"/usr/share/hunspell",
+	"/usr/share/myspell",
+	"/usr/share/myspell/dicts",
+}
+
+// spellSettings is the part of a folder's settings about spell checking:
+//
+//	{"plaintext": {"spell": {
+//		"language": "en_GB",
+//		"languages": {"markdown": "de_DE", "yaml": ""},
+//		"dictionaryPaths": ["dictionaries"]
+//	}}}
+type spellSettings struct {
+	Spell struct {
+		// Language names the dictionary, as in en_GB.aff and en_GB.dic.
+		// It is "en_US" when not set, and empty to check no spelling.
+		Language *string `json:"language"`
+		// Languages sets the language by language ID instead, with the
+		// same meaning.
+		Languages map[string]string `json:"languages"`
+		// DictionaryPaths are directories to look for dictionaries in
+		// before those of the system, relative to the folder or absolute.
+		DictionaryPaths []string `json:"dictionaryPaths"`
+	} `json:"spell"`
+}
+
+// spellHit is a misspelled word along with the diagnostic reported for it.
+type spellHit struct {
+	word       spell.Word
+	diagnostic DiagnosticValue
+}
+
+// checkSpelling reports every misspelled word of snap.
+func (s *Session) checkSpelling(snap *document.Snapshot) []DiagnosticValue {
+	_, hits := s.spellHits(snap)
+	var diagnostics []DiagnosticValue
+	for _, hit := range hits {
+		diagnostics = append(diagnostics, hit.diagnostic)
+	}
+	return diagnostics
+}
+
+// spellHits checks the words of snap against the dictionary for it,
+// returning the dictionary and the words neither it nor a word list knows.
+// Lint configuration files, whose terms are mostly there to be flagged,
+// and secrets baselines, which are written by the server, are not checked.
+func (s *Session) spellHits(snap *document.Snapshot) (*spell.Dictionary, []spellHit) {
+	if _, ok := s.lintConfigFolder(snap.URI); ok || s.isSecretBaseline(snap.URI) {
+		return nil, nil
+	}
+	dict, language := s.dictionaryFor(snap)
+	if dict == nil {
+		return nil, nil
+	}
+	enc := s.Encoding()
+	text := snap.Text()
+	var hits []spellHit
+	for _, w := range spell.Words(text) {
+		if dict.Check(w.Text) || s.acceptedWord(snap.URI, w.Text) {
+			continue
+		}
+		rng, err := snap.RangeOf(w.Start, w.End, enc)
+		if err != nil {
+			log.Printf("checking spelling of %s: %v", snap.URI, err)
+			break
+		}
+		hits = append(hits, spellHit{
+			word: w,
+			diagnostic: DiagnosticValue{
+				Range:    rng,
+				Severity: lsp.Information,
+				Code:     codeSpelling,
+				Source:   diagnosticSource,
+				Message:  fmt.Sprintf("%q is not in the %s dictionary", w.Text, language),
+			},
+		})
+		if len(hits) == maxSpellingDiagnostics {
+			break
+		}
+	}
+	return dict, hits
+}
+
+// dictionaryFor returns the dictionary snap is checked with, and its
+// language, or nil if its spelling is not checked or there is no
+// dictionary for the language.
+func (s *Session) dictionaryFor(snap *document.Snapshot) (*spell.Dictionary, string) {
+	var settings spellSettings
+	var dirs []string
+	if f, ok := s.folders.For(snap.URI); ok {
+		if err := f.DecodeSettings(&settings); err != nil {
+			log.Printf("checking spelling of %s: %v", snap.URI, err)
+		}
+		for _, dir := range settings.Spell.DictionaryPaths {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(f.Path, dir)
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+	dirs = append(dirs, defaultDictionaryPaths...)
+
+	language := defaultSpellLanguage
+	if settings.Spell.Language != nil {
+		language = *settings.Spell.Language
+	}
+	if l, ok := settings.Spell.Languages[snap.LanguageID]; ok {
+		language = l
+	}
+	if language == "" {
+		return nil, ""
+	}
+	return s.loadDictionary(language, dirs), language
+}
+
+// loadDictionary returns the dictionary for language from the first of
+// dirs that has it. Dictionaries are loaded once and kept; one that is not
+// found is looked for again next time, as it may have been installed
+// since, but is only logged about once.
+func (s *Session) loadDictionary(language string, dirs []string) *spell.Dictionary {
+	var aff, dic string
+	for _, dir := range dirs {
+		a, d := filepath.Join(dir, language+".aff"), filepath.Join(dir, language+".dic")
+		if _, err := os.Stat(a); err != nil {
+			continue
+		}
+		if _, err := os.Stat(d); err != nil {
+			continue
+		}
+		aff, dic = a, d
+		break
+	}
+
+	s.spellMu.Lock()
+	defer s.spellMu.Unlock()
+	if aff == "" {
+		if !s.missingDictionaries[language] {
+			s.missingDictionaries[language] = true
+			log.Printf("no %s dictionary in %v; not checking spelling", language, dirs)
+		}
+		return nil
+	}
+	dict, ok := s.dictionaries[aff]
+	if !ok {
+		var err error
+		if dict, err = spell.Load(aff, dic); err != nil {
+			log.Printf("loading %s dictionary: %v", language, err)
+		} else {
+			log.Printf("loaded %s dictionary from %s", language, filepath.Dir(aff))
+		}
+		// one that fails to load is not tried again
+		s.dictionaries[aff] = dict
+	}
+	return dict
+}
+
+// spellingFixes returns the fixes for one misspelled word: its most likely
+// corrections, best first.
+func spellingFixes(snap *document.Snapshot, dict *spell.Dictionary, hit spellHit) []CodeActionValue {
+	var actions []CodeActionValue
+	for i, suggestion := range dict.Suggest(hit.word.Text, maxSpellingSuggestions) {
+		actions = append(actions, CodeActionValue{
+			Title:       fmt.Sprintf("Replace with %q", suggestion),
+			Kind:        codeActionQuickFix,
+			Diagnostics: []DiagnosticValue{hit.diagnostic},
+			IsPreferred: i == 0,
+			Edit:        textEdit(snap.URI, hit.diagnostic.Range, suggestion),
+		})
+	}
+	return actions
+}
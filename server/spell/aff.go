@@ -0,0 +1,345 @@
+package spell
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// flagMode is how an .aff file writes flags, as its FLAG line says.
+type flagMode int
+
+const (
+	// flagChar flags are one character each, the default.
+	flagChar flagMode = iota
+	// flagLong flags are two characters each.
+	flagLong
+	// flagNum flags are decimal numbers separated by commas.
+	flagNum
+)
+
+// affParser reads an .aff file, and then the .dic file the same way.
+type affParser struct {
+	latin1  bool
+	mode    flagMode
+	aliases [][]flag
+	cross   [2]map[flag]bool
+}
+
+// condition is what a stem must start or end with for an affix to apply.
+type condition []condElem
+
+// condElem is one character of a condition: any character, one of a set,
+// or any but those of a set.
+type condElem struct {
+	any    bool
+	negate bool
+	chars  string
+}
+
+func parseAff(d *Dictionary, r io.Reader) (*affParser, error) {
+	p := &affParser{cross: [2]map[flag]bool{{}, {}}}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for sc.Scan() {
+		n++
+		line, err := p.decode(sc.Bytes())
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if err := p.directive(d, fields); err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+	}
+	return p, errors.Wrap(sc.Err(), "reading")
+}
+
+// directive applies one line of an .aff file. Directives this package has
+// no use for are skipped.
+func (p *affParser) directive(d *Dictionary, fields []string) error {
+	arg := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	var err error
+	switch fields[0] {
+	case "SET":
+		switch strings.ToUpper(arg(1)) {
+		case "UTF-8":
+		case "ISO8859-1", "ISO-8859-1", "ISO8859-15", "ISO-8859-15":
+			// close enough: the 8859-15 letters outside Latin-1 are rare in
+			// word lists
+			p.latin1 = true
+		default:
+			return errors.Errorf("unsupported encoding %s; convert the dictionary to UTF-8", arg(1))
+		}
+	case "FLAG":
+		switch arg(1) {
+		case "long":
+			p.mode = flagLong
+		case "num":
+			p.mode = flagNum
+		case "UTF-8":
+			p.mode = flagChar
+		default:
+			return errors.Errorf("unknown flag type %q", arg(1))
+		}
+	case "AF":
+		if _, err := strconv.Atoi(arg(1)); err == nil && len(p.aliases) == 0 && len(fields) == 2 {
+			// the count line
+			return nil
+		}
+		flags, err := p.flags(arg(1))
+		if err != nil {
+			return err
+		}
+		p.aliases = append(p.aliases, flags)
+	case "TRY":
+		d.try = arg(1)
+	case "KEY":
+		d.keys = strings.Split(arg(1), "|")
+	case "REP", "ICONV":
+		if len(fields) < 3 {
+			// the count line
+			return nil
+		}
+		rep := replacement{from: arg(1), to: strings.ReplaceAll(arg(2), "_", " ")}
+		if fields[0] == "ICONV" {
+			d.iconv = append(d.iconv, rep)
+			return nil
+		}
+		if strings.HasPrefix(rep.from, "^") {
+			rep.start, rep.from = true, rep.from[1:]
+		}
+		if strings.HasSuffix(rep.from, "$") {
+			rep.end, rep.from = true, rep.from[:len(rep.from)-1]
+		}
+		rep.from = strings.ReplaceAll(rep.from, "_", " ")
+		if rep.from != "" {
+			d.reps = append(d.reps, rep)
+		}
+	case "FORBIDDENWORD":
+		d.forbidden, err = p.flag(arg(1))
+	case "NOSUGGEST":
+		d.noSuggest, err = p.flag(arg(1))
+	case "NEEDAFFIX", "PSEUDOROOT":
+		d.needAffix, err = p.flag(arg(1))
+	case "KEEPCASE":
+		d.keepCase, err = p.flag(arg(1))
+	case "ONLYINCOMPOUND":
+		d.onlyInCompound, err = p.flag(arg(1))
+	case "PFX", "SFX":
+		return p.affix(d, fields)
+	}
+	return err
+}
+
+// affix reads a line of a PFX or SFX class. The header line, with Y or N
+// for whether the class combines with the other kind, comes first.
+func (p *affParser) affix(d *Dictionary, fields []string) error {
+	if len(fields) < 4 {
+		return errors.Errorf("short %s line", fields[0])
+	}
+	f, err := p.flag(fields[1])
+	if err != nil {
+		return err
+	}
+	if len(fields) == 4 && (fields[2] == "Y" || fields[2] == "N") {
+		if _, err := strconv.Atoi(fields[3]); err == nil {
+			p.crossOf(fields[0] == "PFX")[f] = fields[2] == "Y"
+			return nil
+		}
+	}
+	if len(fields) < 5 {
+		return errors.Errorf("short %s line", fields[0])
+	}
+
+	a := &affix{flag: f, prefix: fields[0] == "PFX", strip: fields[2]}
+	a.cross = p.crossOf(a.prefix)[f]
+	if a.strip == "0" {
+		a.strip = ""
+	}
+	add, cont := splitFlags(fields[3])
+	if cont != "" {
+		if a.cont, err = p.flags(cont); err != nil {
+			return err
+		}
+	}
+	if add == "0" {
+		add = ""
+	}
+	a.add = add
+	if a.cond, err = parseCondition(fields[4]); err != nil {
+		return err
+	}
+	// a condition is on the stem as found in the dictionary, which still
+	// has what the affix strips
+	if a.prefix {
+		d.prefixes[add] = append(d.prefixes[add], a)
+		if len(add) > d.maxPrefix {
+			d.maxPrefix = len(add)
+		}
+	} else {
+		d.suffixes[add] = append(d.suffixes[add], a)
+		if len(add) > d.maxSuffix {
+			d.maxSuffix = len(add)
+		}
+	}
+	return nil
+}
+
+// crossOf returns whether each affix class of the kind combines with the
+// other kind, by flag, as its header line said.
+func (p *affParser) crossOf(prefix bool) map[flag]bool {
+	if prefix {
+		return p.cross[0]
+	}
+	return p.cross[1]
+}
+
+// decode turns a line of the file into UTF-8.
+func (p *affParser) decode(line []byte) (string, error) {
+	if p.latin1 {
+		runes := make([]rune, len(line))
+		for i, b := range line {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	}
+	if !utf8.Valid(line) {
+		return "", errors.New("invalid UTF-8; is a SET line missing?")
+	}
+	return strings.TrimPrefix(string(line), "\ufeff"), nil
+}
+
+// flag parses a single flag.
+func (p *affParser) flag(s string) (flag, error) {
+	flags, err := p.parseFlags(s)
+	if err != nil {
+		return 0, err
+	}
+	if len(flags) != 1 {
+		return 0, errors.Errorf("expected one flag, got %q", s)
+	}
+	return flags[0], nil
+}
+
+// flags parses the flags of a stem or an affix, which are the number of a
+// flag alias when the file has AF lines.
+func (p *affParser) flags(s string) ([]flag, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if len(p.aliases) > 0 {
+		if n, err := strconv.Atoi(s); err == nil {
+			if n < 1 || n > len(p.aliases) {
+				return nil, errors.Errorf("no flag alias %d", n)
+			}
+			return p.aliases[n-1], nil
+		}
+	}
+	return p.parseFlags(s)
+}
+
+func (p *affParser) parseFlags(s string) ([]flag, error) {
+	var flags []flag
+	switch p.mode {
+	case flagLong:
+		runes := []rune(s)
+		if len(runes)%2 != 0 {
+			return nil, errors.Errorf("odd number of characters in long flags %q", s)
+		}
+		for i := 0; i < len(runes); i += 2 {
+			flags = append(flags, flag(runes[i])<<16|flag(runes[i+1]))
+		}
+	case flagNum:
+		for _, part := range strings.Split(s, ",") {
+			n, err := strconv.ParseUint(part, 10, 16)
+			if err != nil {
+				return nil, errors.Errorf("invalid numeric flag %q", part)
+			}
+			flags = append(flags, flag(n))
+		}
+	default:
+		for _, r := range s {
+			flags = append(flags, flag(r))
+		}
+	}
+	return flags, nil
+}
+
+// parseCondition reads a condition such as "[^aeiou]y" or ".".
+func parseCondition(s string) (condition, error) {
+	if s == "." {
+		return nil, nil
+	}
+	var cond condition
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '.':
+			cond = append(cond, condElem{any: true})
+		case '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, errors.Errorf("unclosed [ in condition %q", s)
+			}
+			set := runes[i+1 : end]
+			elem := condElem{}
+			if len(set) > 0 && set[0] == '^' {
+				elem.negate, set = true, set[1:]
+			}
+			elem.chars = string(set)
+			cond = append(cond, elem)
+			i = end
+		default:
+			cond = append(cond, condElem{chars: string(runes[i])})
+		}
+	}
+	return cond, nil
+}
+
+func (e condElem) match(r rune) bool {
+	if e.any {
+		return true
+	}
+	return strings.ContainsRune(e.chars, r) != e.negate
+}
+
+// matchStart reports whether stem starts with what c describes.
+func (c condition) matchStart(stem string) bool {
+	for _, e := range c {
+		r, size := utf8.DecodeRuneInString(stem)
+		if size == 0 || !e.match(r) {
+			return false
+		}
+		stem = stem[size:]
+	}
+	return true
+}
+
+// matchEnd reports whether stem ends with what c describes.
+func (c condition) matchEnd(stem string) bool {
+	for i := len(c) - 1; i >= 0; i-- {
+		r, size := utf8.DecodeLastRuneInString(stem)
+		if size == 0 || !c[i].match(r) {
+			return false
+		}
+		stem = stem[:len(stem)-size]
+	}
+	return true
+}
@@ -0,0 +1,342 @@
+// Package spell checks words against Hunspell dictionaries: an .aff file of
+// affix rules and a .dic file of the stems they apply to. It reads the
+// parts of the format that word lists for most languages use — prefixes
+// and suffixes, including a second suffix on the first, flag aliases,
+// forbidden words and the tables that guide suggestions — but not
+// compounding, so a dictionary that builds words from parts accepts only
+// the parts.
+package spell
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// flag names an affix rule or a property of a stem.
+type flag uint32
+
+// affix is one rule of a PFX or SFX class: strip is removed from the stem
+// and add put in its place, if the stem meets cond.
+type affix struct {
+	flag   flag
+	cross  bool
+	strip  string
+	add    string
+	cond   condition
+	cont   []flag
+	prefix bool
+}
+
+// replacement is a REP or ICONV entry. Anchored entries only apply at the
+// start or end of a word.
+type replacement struct {
+	from, to   string
+	start, end bool
+}
+
+// Dictionary is a loaded Hunspell dictionary. It is safe for concurrent
+// use.
+type Dictionary struct {
+	words    map[string][][]flag
+	prefixes map[string][]*affix
+	suffixes map[string][]*affix
+	// maxPrefix and maxSuffix are the longest affixes, in bytes.
+	maxPrefix int
+	maxSuffix int
+
+	try   string
+	keys  []string
+	reps  []replacement
+	iconv []replacement
+
+	forbidden      flag
+	noSuggest      flag
+	needAffix      flag
+	keepCase       flag
+	onlyInCompound flag
+}
+
+// Load reads a dictionary from its .aff and .dic files.
+func Load(affPath, dicPath string) (*Dictionary, error) {
+	aff, err := os.Open(affPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening affix file")
+	}
+	defer aff.Close()
+	dic, err := os.Open(dicPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening dictionary file")
+	}
+	defer dic.Close()
+	return Parse(aff, dic)
+}
+
+// Parse reads a dictionary from the contents of its .aff and .dic files.
+func Parse(aff, dic io.Reader) (*Dictionary, error) {
+	d := &Dictionary{
+		words:    map[string][][]flag{},
+		prefixes: map[string][]*affix{},
+		suffixes: map[string][]*affix{},
+	}
+	p, err := parseAff(d, aff)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading affix file")
+	}
+	if err := p.parseDic(d, dic); err != nil {
+		return nil, errors.Wrap(err, "reading dictionary file")
+	}
+	if d.try == "" {
+		d.try = commonLetters(d.words)
+	}
+	if len(d.keys) == 0 {
+		d.keys = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm"}
+	}
+	return d, nil
+}
+
+// parseDic reads the stems of a .dic file: a count on the first line, then
+// a stem a line, its flags after an unescaped slash and any morphological
+// fields after a tab.
+func (p *affParser) parseDic(d *Dictionary, r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	first := true
+	for sc.Scan() {
+		line, err := p.decode(sc.Bytes())
+		if err != nil {
+			return err
+		}
+		if first {
+			first = false
+			// the count is only a hint for allocation
+			continue
+		}
+		if i := strings.IndexByte(line, '\t'); i >= 0 {
+			line = line[:i]
+		}
+		if i := morphStart(line); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		word, flags := splitFlags(line)
+		parsed, err := p.flags(flags)
+		if err != nil {
+			return errors.Wrapf(err, "word %q", word)
+		}
+		d.words[word] = append(d.words[word], parsed)
+	}
+	return errors.Wrap(sc.Err(), "reading")
+}
+
+// morphStart finds the morphological fields that some dictionaries put
+// after a space rather than a tab, such as " po:noun".
+func morphStart(line string) int {
+	for i := 0; i+4 <= len(line); i++ {
+		if line[i] == ' ' && isLower(line[i+1]) && isLower(line[i+2]) && line[i+3] == ':' {
+			return i
+		}
+	}
+	return -1
+}
+
+func isLower(b byte) bool {
+	return 'a' <= b && b <= 'z'
+}
+
+// splitFlags splits a stem from its flags at the first slash that is not
+// escaped.
+func splitFlags(entry string) (word, flags string) {
+	for i := 0; i < len(entry); i++ {
+		switch entry[i] {
+		case '\\':
+			i++
+		case '/':
+			return unescape(entry[:i]), entry[i+1:]
+		}
+	}
+	return unescape(entry), ""
+}
+
+func unescape(word string) string {
+	return strings.ReplaceAll(word, `\/`, "/")
+}
+
+// commonLetters returns the letters of words, most frequent first, for
+// dictionaries without a TRY line.
+func commonLetters(words map[string][][]flag) string {
+	counts := map[rune]int{}
+	for word := range words {
+		for _, r := range word {
+			if unicode.IsLetter(r) {
+				counts[unicode.ToLower(r)]++
+			}
+		}
+	}
+	letters := make([]rune, 0, len(counts))
+	for r := range counts {
+		letters = append(letters, r)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if counts[letters[i]] != counts[letters[j]] {
+			return counts[letters[i]] > counts[letters[j]]
+		}
+		return letters[i] < letters[j]
+	})
+	return string(letters)
+}
+
+// Check reports whether word is spelled correctly. A capitalized word is
+// also accepted if its lower case form is, unless the dictionary says the
+// word keeps its case.
+func (d *Dictionary) Check(word string) bool {
+	word = d.convert(word)
+	if word == "" {
+		return true
+	}
+	if d.check(word, false) {
+		return true
+	}
+	if lower, ok := uncapitalize(word); ok {
+		return d.check(lower, true)
+	}
+	return false
+}
+
+// check looks word up as a stem and as every way the affix rules could
+// have made it. lowered is set when word is a lower cased form of what was
+// written, which words that keep their case do not accept.
+func (d *Dictionary) check(word string, lowered bool) bool {
+	for _, flags := range d.words[word] {
+		if d.forbidden != 0 && has(flags, d.forbidden) {
+			return false
+		}
+	}
+	root := func(stem string, need ...flag) bool {
+		for _, flags := range d.words[stem] {
+			if d.forbidden != 0 && has(flags, d.forbidden) {
+				return false
+			}
+			if lowered && d.keepCase != 0 && has(flags, d.keepCase) {
+				continue
+			}
+			if d.onlyInCompound != 0 && has(flags, d.onlyInCompound) {
+				continue
+			}
+			if len(need) == 0 && d.needAffix != 0 && has(flags, d.needAffix) {
+				continue
+			}
+			ok := true
+			for _, f := range need {
+				ok = ok && has(flags, f)
+			}
+			if ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if root(word) {
+		return true
+	}
+	if d.checkSuffixes(word, root, 0) {
+		return true
+	}
+	for k := 0; k <= d.maxPrefix && k <= len(word); k++ {
+		for _, pfx := range d.prefixes[word[:k]] {
+			stem := pfx.strip + word[k:]
+			if stem == "" || !pfx.cond.matchStart(stem) {
+				continue
+			}
+			if root(stem, pfx.flag) {
+				return true
+			}
+			if pfx.cross && d.checkSuffixes(stem, root, pfx.flag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkSuffixes reports whether word is a stem with a suffix, or with a
+// suffix on a suffix. With a prefix flag, only suffixes that combine with
+// prefixes count, and the stem must take the prefix too.
+func (d *Dictionary) checkSuffixes(word string, root func(string, ...flag) bool, prefix flag) bool {
+	need := func(f flag) []flag {
+		if prefix != 0 {
+			return []flag{f, prefix}
+		}
+		return []flag{f}
+	}
+	for k := 0; k <= d.maxSuffix && k <= len(word); k++ {
+		for _, sfx := range d.suffixes[word[len(word)-k:]] {
+			if prefix != 0 && !sfx.cross {
+				continue
+			}
+			stem := word[:len(word)-k] + sfx.strip
+			if stem == "" || !sfx.cond.matchEnd(stem) {
+				continue
+			}
+			if root(stem, need(sfx.flag)...) {
+				return true
+			}
+			// the suffix may have been added to another one
+			for k2 := 0; k2 <= d.maxSuffix && k2 <= len(stem); k2++ {
+				for _, inner := range d.suffixes[stem[len(stem)-k2:]] {
+					if !has(inner.cont, sfx.flag) {
+						continue
+					}
+					base := stem[:len(stem)-k2] + inner.strip
+					if base != "" && inner.cond.matchEnd(base) && root(base, need(inner.flag)...) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// convert applies the dictionary's input conversions, such as typographic
+// apostrophes to plain ones.
+func (d *Dictionary) convert(word string) string {
+	for _, rep := range d.iconv {
+		word = strings.ReplaceAll(word, rep.from, rep.to)
+	}
+	return word
+}
+
+func has(flags []flag, f flag) bool {
+	for _, g := range flags {
+		if g == f {
+			return true
+		}
+	}
+	return false
+}
+
+// uncapitalize returns a capitalized word in lower case.
+func uncapitalize(word string) (string, bool) {
+	r, size := utf8.DecodeRuneInString(word)
+	if !unicode.IsUpper(r) || strings.ToLower(word[size:]) != word[size:] {
+		return "", false
+	}
+	return string(unicode.ToLower(r)) + word[size:], true
+}
+
+// capitalize upper cases the first letter of word.
+func capitalize(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
@@ -0,0 +1,166 @@
+package spell
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testAff = `SET UTF-8
+TRY esianrtolcdugmphbyfvkwzx
+ICONV 1
+ICONV ’ '
+REP 2
+REP f ph
+REP ^alot$ a_lot
+FORBIDDENWORD !
+NOSUGGEST %
+KEEPCASE K
+NEEDAFFIX _
+
+PFX U Y 1
+PFX U 0 un .
+
+SFX S Y 3
+SFX S 0 s [^sxy]
+SFX S y ies [^aeiou]y
+SFX S 0 es [sx]
+
+SFX D N 3
+SFX D 0 ed [^ey]
+SFX D y ied [^aeiou]y
+SFX D 0 d e
+
+SFX N Y 1
+SFX N 0 ness/S .
+`
+
+const testDic = `12
+hello/S
+kind/UN
+happy
+try/SD
+bake/D
+box/S
+phone/S
+a
+lot
+irregardless/!
+damn/%
+iPhone/K
+`
+
+func testDictionary(t *testing.T) *Dictionary {
+	d, err := Parse(strings.NewReader(testAff), strings.NewReader(testDic))
+	require.NoError(t, err)
+	return d
+}
+
+func TestCheck(t *testing.T) {
+	d := testDictionary(t)
+	for _, tc := range []struct {
+		word string
+		ok   bool
+	}{
+		{"hello", true},
+		{"hellos", true},
+		{"Hello", true},
+		{"HELLO", false},
+		{"helo", false},
+		{"tries", true},
+		{"tried", true},
+		{"tryed", false},
+		{"trys", false},
+		{"baked", true},
+		{"bakeed", false},
+		{"boxes", true},
+		{"boxs", false},
+		{"kind", true},
+		{"unkind", true},
+		{"kindness", true},
+		{"kindnesses", true},
+		{"unkindness", true},
+		{"unhello", false},
+		{"irregardless", false},
+		{"damn", true},
+		{"iPhone", true},
+		{"iphone", false},
+		{"don’t", false},
+	} {
+		require.Equal(t, tc.ok, d.Check(tc.word), tc.word)
+	}
+}
+
+func TestCheckNeedAffix(t *testing.T) {
+	d, err := Parse(strings.NewReader("NEEDAFFIX _\nSFX S Y 1\nSFX S 0 s .\n"), strings.NewReader("1\nfoo/_S\n"))
+	require.NoError(t, err)
+	require.False(t, d.Check("foo"))
+	require.True(t, d.Check("foos"))
+}
+
+func TestParseFlagModes(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		aff  string
+		dic  string
+	}{
+		{"long", "FLAG long\nSFX Aa Y 1\nSFX Aa 0 s .\n", "1\ncat/AaBb\n"},
+		{"num", "FLAG num\nSFX 101 Y 1\nSFX 101 0 s .\n", "1\ncat/7,101\n"},
+		{"alias", "AF 2\nAF AB\nAF S\nSFX S Y 1\nSFX S 0 s .\n", "1\ncat/2\n"},
+		{"latin1", "SET ISO8859-1\nSFX S Y 1\nSFX S 0 s .\n", "1\ncat/S\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := Parse(strings.NewReader(tc.aff), strings.NewReader(tc.dic))
+			require.NoError(t, err)
+			require.True(t, d.Check("cat"))
+			require.True(t, d.Check("cats"))
+			require.False(t, d.Check("catss"))
+		})
+	}
+}
+
+func TestParseLatin1(t *testing.T) {
+	d, err := Parse(strings.NewReader("SET ISO8859-1\n"), strings.NewReader("1\ncaf\xe9\n"))
+	require.NoError(t, err)
+	require.True(t, d.Check("café"))
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		aff  string
+		dic  string
+		err  string
+	}{
+		{"encoding", "SET KOI8-R\n", "0\n", "unsupported encoding KOI8-R"},
+		{"flag type", "FLAG wide\n", "0\n", `unknown flag type "wide"`},
+		{"odd long flag", "FLAG long\n", "1\ncat/A\n", `word "cat": odd number of characters`},
+		{"alias", "AF 1\nAF A\n", "1\ncat/3\n", `word "cat": no flag alias 3`},
+		{"condition", "SFX S Y 1\nSFX S 0 s [ab\n", "0\n", "unclosed [ in condition"},
+		{"invalid utf-8", "TRY \xe9\n", "0\n", "line 1: invalid UTF-8"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tc.aff), strings.NewReader(tc.dic))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	aff, dic := filepath.Join(dir, "en.aff"), filepath.Join(dir, "en.dic")
+	require.NoError(t, os.WriteFile(aff, []byte(testAff), 0o644))
+	require.NoError(t, os.WriteFile(dic, []byte(testDic), 0o644))
+
+	d, err := Load(aff, dic)
+	require.NoError(t, err)
+	require.True(t, d.Check("hellos"))
+
+	_, err = Load(aff, filepath.Join(dir, "missing.dic"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "opening dictionary file")
+}
@@ -0,0 +1,230 @@
+package spell
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxEdit2 bounds how many words two edits away Suggest considers, since
+// there are a great many of them for a long word.
+const maxEdit2 = 20000
+
+// Suggest returns up to n correctly spelled words close to word, best
+// first. Words reached by the dictionary's REP table come first, then
+// slips of the finger — a neighbouring key, swapped or doubled letters —
+// then any other single change, then splitting the word in two, and
+// last two changes. Words in each group are ranked by how alike they
+// look.
+func (d *Dictionary) Suggest(word string, n int) []string {
+	if n <= 0 || word == "" {
+		return nil
+	}
+	word = d.convert(word)
+	lower, capitalized := uncapitalize(word)
+	if !capitalized {
+		lower = word
+	}
+
+	var out []string
+	seen := map[string]bool{word: true, lower: true}
+	add := func(tier []string) {
+		var found []string
+		for _, c := range tier {
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+			if d.suggestable(c) {
+				found = append(found, c)
+			}
+		}
+		rank(lower, found)
+		for _, c := range found {
+			if len(out) == n {
+				return
+			}
+			if capitalized {
+				c = capitalize(c)
+			}
+			out = append(out, c)
+		}
+	}
+
+	add(d.replacements(lower))
+	add(d.slips(lower))
+	edits := d.edits(lower)
+	add(edits)
+	add(d.splits(lower))
+	if len(out) < n {
+		var twice []string
+		for _, e := range edits {
+			if len(twice) >= maxEdit2 {
+				break
+			}
+			twice = append(twice, d.edits(e)...)
+		}
+		add(twice)
+	}
+	return out
+}
+
+// suggestable reports whether a candidate is a word that may be suggested:
+// one the dictionary accepts, with none of its forms marked NOSUGGEST. A
+// split candidate has each of its two words checked.
+func (d *Dictionary) suggestable(c string) bool {
+	for _, part := range strings.Split(c, " ") {
+		if part == "" || !d.check(part, false) {
+			return false
+		}
+		if d.noSuggest != 0 {
+			for _, flags := range d.words[part] {
+				if has(flags, d.noSuggest) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// replacements applies each REP entry at every place it matches.
+func (d *Dictionary) replacements(word string) []string {
+	var out []string
+	for _, rep := range d.reps {
+		for i := 0; i+len(rep.from) <= len(word); i++ {
+			if !strings.HasPrefix(word[i:], rep.from) {
+				continue
+			}
+			if rep.start && i != 0 || rep.end && i+len(rep.from) != len(word) {
+				continue
+			}
+			out = append(out, word[:i]+rep.to+word[i+len(rep.from):])
+		}
+	}
+	return out
+}
+
+// slips returns word with one letter swapped for a neighbouring key, two
+// adjacent letters swapped, a letter doubled or a doubled letter undone.
+func (d *Dictionary) slips(word string) []string {
+	runes := []rune(word)
+	var out []string
+	for i, r := range runes {
+		for _, row := range d.keys {
+			keys := []rune(row)
+			for j, k := range keys {
+				if k != r {
+					continue
+				}
+				if j > 0 {
+					out = append(out, replaceAt(runes, i, keys[j-1]))
+				}
+				if j+1 < len(keys) {
+					out = append(out, replaceAt(runes, i, keys[j+1]))
+				}
+			}
+		}
+		if i+1 < len(runes) {
+			swapped := append([]rune(nil), runes...)
+			swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+			out = append(out, string(swapped))
+			if runes[i] == runes[i+1] {
+				out = append(out, string(runes[:i])+string(runes[i+1:]))
+			}
+		}
+		out = append(out, string(runes[:i+1])+string(runes[i:]))
+	}
+	return out
+}
+
+// edits returns word with one letter deleted, inserted or replaced, using
+// the letters of the TRY line.
+func (d *Dictionary) edits(word string) []string {
+	runes := []rune(word)
+	try := []rune(d.try)
+	var out []string
+	for i := range runes {
+		out = append(out, string(runes[:i])+string(runes[i+1:]))
+		for _, t := range try {
+			if t != runes[i] {
+				out = append(out, replaceAt(runes, i, t))
+			}
+		}
+	}
+	for i := 0; i <= len(runes); i++ {
+		for _, t := range try {
+			out = append(out, string(runes[:i])+string(t)+string(runes[i:]))
+		}
+	}
+	return out
+}
+
+// splits returns word with a space put between each pair of letters, for
+// words run together.
+func (d *Dictionary) splits(word string) []string {
+	var out []string
+	for i := range word {
+		if i > 0 {
+			out = append(out, word[:i]+" "+word[i:])
+		}
+	}
+	return out
+}
+
+func replaceAt(runes []rune, i int, r rune) string {
+	changed := append([]rune(nil), runes...)
+	changed[i] = r
+	return string(changed)
+}
+
+// rank sorts candidates by how alike they are to word, most alike first.
+func rank(word string, candidates []string) {
+	scores := make(map[string]int, len(candidates))
+	for _, c := range candidates {
+		scores[c] = similarity(word, c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		return a < b
+	})
+}
+
+// similarity scores two words by the letters they start with in common,
+// the pairs of adjacent letters they share and how close their lengths are.
+func similarity(a, b string) int {
+	ar, br := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	score := 0
+	for i := 0; i < len(ar) && i < len(br) && ar[i] == br[i]; i++ {
+		score += 2
+	}
+	pairs := map[[2]rune]int{}
+	for i := 0; i+1 < len(ar); i++ {
+		pairs[[2]rune{ar[i], ar[i+1]}]++
+	}
+	for i := 0; i+1 < len(br); i++ {
+		p := [2]rune{br[i], br[i+1]}
+		if pairs[p] > 0 {
+			pairs[p]--
+			score++
+		}
+	}
+	diff := len(ar) - len(br)
+	if diff < 0 {
+		diff = -diff
+	}
+	score -= diff
+	if unicode.IsUpper(firstRune(a)) == unicode.IsUpper(firstRune(b)) {
+		score++
+	}
+	return score
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
@@ -0,0 +1,41 @@
+package spell
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggest(t *testing.T) {
+	d := testDictionary(t)
+	for _, tc := range []struct {
+		word string
+		n    int
+		want []string
+	}{
+		// REP comes first
+		{"fone", 1, []string{"phone"}},
+		{"alot", 1, []string{"a lot"}},
+		// a neighbouring key
+		{"hrllo", 1, []string{"hello"}},
+		// swapped letters
+		{"hlelo", 1, []string{"hello"}},
+		{"helllo", 1, []string{"hello"}},
+		{"Helo", 1, []string{"Hello"}},
+		{"kindnes", 1, []string{"kindness"}},
+		// two changes
+		{"hepplo", 1, []string{"hello"}},
+		{"bakd", 3, []string{"bake", "baked"}},
+		// never a forbidden or NOSUGGEST word
+		{"irregardles", 5, nil},
+		{"dawn", 5, nil},
+		{"xyzzyq", 5, nil},
+	} {
+		require.Equal(t, tc.want, d.Suggest(tc.word, tc.n), tc.word)
+	}
+	require.Nil(t, d.Suggest("helo", 0))
+}
+
+func TestSimilarity(t *testing.T) {
+	require.Greater(t, similarity("helo", "hello"), similarity("helo", "halo"))
+}
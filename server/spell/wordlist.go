@@ -0,0 +1,86 @@
+package spell
+
+import (
+	"strings"
+	"unicode"
+)
+
+// WordListFile is the name of the file at the root of a workspace folder
+// listing words to accept in it, on top of those of the dictionary.
+const WordListFile = ".plaintextwords.txt"
+
+// WordList is a list of words to accept: one a line, with blank lines and
+// lines starting with # ignored. A word in lower case is accepted
+// capitalized and in capitals too; one with capitals only as it is
+// written. A line may also hold a phrase, for lint rules that match more
+// than one word.
+type WordList struct {
+	words map[string]bool
+}
+
+// ParseWordList reads a word list.
+func ParseWordList(text string) *WordList {
+	l := &WordList{words: map[string]bool{}}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l.words[line] = true
+	}
+	return l
+}
+
+// Has reports whether word is on the list. A nil list has no words.
+func (l *WordList) Has(word string) bool {
+	if l == nil {
+		return false
+	}
+	if l.words[word] {
+		return true
+	}
+	if lower, ok := uncapitalize(word); ok && l.words[lower] {
+		return true
+	}
+	return isUpper(word) && l.words[strings.ToLower(word)]
+}
+
+// With returns a copy of the list with word added. Lists are not changed
+// once read, so they can be shared.
+func (l *WordList) With(word string) *WordList {
+	next := &WordList{words: map[string]bool{word: true}}
+	if l != nil {
+		for w := range l.words {
+			next.words[w] = true
+		}
+	}
+	return next
+}
+
+// Len returns how many words are on the list.
+func (l *WordList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.words)
+}
+
+func isUpper(word string) bool {
+	letters := false
+	for _, r := range word {
+		if unicode.IsLower(r) {
+			return false
+		}
+		letters = letters || unicode.IsUpper(r)
+	}
+	return letters
+}
+
+// AppendWord returns text, the contents of a word list, with word added on
+// a line of its own at the end.
+func AppendWord(text, word, eol string) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += eol
+	}
+	return text + word + eol
+}
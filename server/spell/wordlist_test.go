@@ -0,0 +1,55 @@
+package spell
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWordList(t *testing.T) {
+	l := ParseWordList("# project words\nkubectl\r\n\n  GitHub  \nwell known\n")
+	require.Equal(t, 3, l.Len())
+	for _, tc := range []struct {
+		word string
+		ok   bool
+	}{
+		{"kubectl", true},
+		{"Kubectl", true},
+		{"KUBECTL", true},
+		{"kubeCTL", false},
+		{"GitHub", true},
+		{"github", false},
+		{"Github", false},
+		{"well known", true},
+		{"# project words", false},
+		{"", false},
+	} {
+		require.Equal(t, tc.ok, l.Has(tc.word), tc.word)
+	}
+
+	more := l.With("Zed")
+	require.True(t, more.Has("Zed"))
+	require.False(t, more.Has("zed"))
+	require.True(t, more.Has("kubectl"))
+	require.False(t, l.Has("Zed"))
+
+	var none *WordList
+	require.False(t, none.Has("kubectl"))
+	require.Zero(t, none.Len())
+	require.True(t, none.With("kubectl").Has("kubectl"))
+}
+
+func TestAppendWord(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		eol  string
+		want string
+	}{
+		{"", "\n", "kubectl\n"},
+		{"a\n", "\n", "a\nkubectl\n"},
+		{"a", "\n", "a\nkubectl\n"},
+		{"a\r\n", "\r\n", "a\r\nkubectl\r\n"},
+	} {
+		require.Equal(t, tc.want, AppendWord(tc.text, "kubectl", tc.eol), tc.text)
+	}
+}
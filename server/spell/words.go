@@ -0,0 +1,97 @@
+package spell
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Word is a word of a text to check, at byte offsets [Start, End).
+type Word struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// skipped matches the spans of a text that are not prose: fenced code
+// blocks, closed or running to the end of the text, inline code, URLs and
+// email addresses.
+var skipped = regexp.MustCompile("(?ms)^[ \t]*(```|~~~).*?(^[ \t]*(```|~~~)[ \t]*$|\\z)" +
+	"|`+[^`\n]+?`+" +
+	`|\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s<>"'\x60)\]]+` +
+	`|\bwww\.[^\s<>"'\x60)\]]+` +
+	`|[a-zA-Z0-9._%+-]+@[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)+`)
+
+// Words returns the words of text worth checking. Code, URLs and email
+// addresses are skipped, and so are words that are probably not meant to be
+// in a dictionary: acronyms in capitals, identifiers in camel case, words
+// with digits in them and single letters. Hyphenated words are checked a
+// part at a time; apostrophes inside a word are part of it.
+func Words(text string) []Word {
+	var words []Word
+	last := 0
+	for _, span := range skipped.FindAllStringIndex(text, -1) {
+		words = appendWords(words, text, last, span[0])
+		last = span[1]
+	}
+	return appendWords(words, text, last, len(text))
+}
+
+// appendWords appends the words of text[start:end] to words.
+func appendWords(words []Word, text string, start, end int) []Word {
+	i := start
+	for i < end {
+		r, size := utf8.DecodeRuneInString(text[i:end])
+		if !isWordRune(r) {
+			i += size
+			continue
+		}
+		j := i
+		for j < end {
+			r, size := utf8.DecodeRuneInString(text[j:end])
+			if isWordRune(r) {
+				j += size
+				continue
+			}
+			// an apostrophe between letters is part of the word
+			if isApostrophe(r) && j+size < end {
+				next, _ := utf8.DecodeRuneInString(text[j+size : end])
+				if unicode.IsLetter(next) {
+					j += size
+					continue
+				}
+			}
+			break
+		}
+		if w := text[i:j]; worthChecking(w) {
+			words = append(words, Word{Start: i, End: j, Text: w})
+		}
+		i = j
+	}
+	return words
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+func isApostrophe(r rune) bool {
+	return r == '\'' || r == '’'
+}
+
+// worthChecking reports whether w looks like a word of prose.
+func worthChecking(w string) bool {
+	if utf8.RuneCountInString(w) < 2 {
+		return false
+	}
+	for i, r := range w {
+		if unicode.IsDigit(r) {
+			return false
+		}
+		// a capital after the first letter is camelCase or ALLCAPS
+		if i > 0 && unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
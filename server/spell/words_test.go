@@ -0,0 +1,37 @@
+package spell
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWords(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"plain", "Hello, wrold!", []string{"Hello", "wrold"}},
+		{"apostrophes", "don't 'quoted' it’s", []string{"don't", "quoted", "it’s"}},
+		{"hyphens", "well-known", []string{"well", "known"}},
+		{"acronyms", "NASA and HTTP go", []string{"and", "go"}},
+		{"camel case", "call fooBar now", []string{"call", "now"}},
+		{"digits and letters", "x 3rd abc2 ok", []string{"ok"}},
+		{"urls", "see https://exmaple.com/pth?q=1 and www.exmaple.org now", []string{"see", "and", "now"}},
+		{"emails", "mail jdoe@exmaple.com now", []string{"mail", "now"}},
+		{"inline code", "run `fmt.Prnitln` now", []string{"run", "now"}},
+		{"fenced code", "before\n```go\nfunc mian() {}\n```\nafter", []string{"before", "after"}},
+		{"unclosed fence", "before\n~~~\nfunc mian() {}\n", []string{"before"}},
+		{"accents", "café naïve", []string{"café", "naïve"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, w := range Words(tc.text) {
+				require.Equal(t, w.Text, tc.text[w.Start:w.End])
+				got = append(got, w.Text)
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"log"
+
+	"lsp/server/document"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// clientDocumentText asks the client for its full copy of a document. It is
+// an extension, sent only to clients that announce
+// experimental.plaintextDocumentText.
+const clientDocumentText = "$/plaintext/documentText"
+
+// DidChangeParamsValue is lsp.DidChangeTextDocumentParams plus an optional
+// hash clients can send to have drift detected.
+type DidChangeParamsValue struct {
+	lsp.DidChangeTextDocumentParams
+	// ContentHash is the hex encoded SHA-256 of the full text after the
+	// changes are applied.
+	ContentHash string `json:"contentHash,omitempty"`
+}
+
+type DocumentTextParamsValue struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentTextResultValue struct {
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+// checkSync looks for signs that snap no longer matches the client's copy
+// and, if it finds any, starts a full-text resync. It reports whether the
+// document is now out of sync.
+func (s *Session) checkSync(snap *document.Snapshot, contentHash string) bool {
+	switch {
+	case contentHash != "" && contentHash != snap.Hash():
+		log.Printf("content hash mismatch on %s at version %d", snap.URI, snap.Version)
+		// the text is known to be wrong, whether or not we can fix it
+		s.documents.MarkOutOfSync(snap.URI, snap.Version)
+		s.requestResync(snap.URI)
+		return true
+	case snap.Gap:
+		log.Printf("version gap on %s before version %d", snap.URI, snap.Version)
+		if s.canResync() {
+			s.documents.MarkOutOfSync(snap.URI, snap.Version)
+			s.requestResync(snap.URI)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Session) canResync() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clientCapabilities.Experimental.DocumentText
+}
+
+func (s *Session) requestResync(uri lsp.DocumentURI) {
+	if !s.canResync() {
+		log.Printf("client cannot resend %s; waiting for a full-text change", uri)
+		return
+	}
+	params := DocumentTextParamsValue{TextDocument: lsp.TextDocumentIdentifier{URI: uri}}
+	err := s.conn.Call(clientDocumentText, params, func(raw json.RawMessage, err error) {
+		if err != nil {
+			log.Printf("resyncing %s: %v", uri, err)
+			return
+		}
+		if err := s.resync(uri, raw); err != nil {
+			log.Printf("resyncing %s: %v", uri, err)
+		}
+	})
+	if err != nil {
+		log.Printf("resyncing %s: %v", uri, err)
+	}
+}
+
+func (s *Session) resync(uri lsp.DocumentURI, raw json.RawMessage) error {
+	result := DocumentTextResultValue{}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return errors.Wrap(err, "decoding document text")
+	}
+	snap, err := s.documents.Resync(uri, result.Version, result.Text)
+	if err != nil {
+		return errors.Wrap(err, "replacing document text")
+	}
+	log.Printf("resynced %s at version %d", uri, snap.Version)
+	s.documentChanged(snap)
+	return nil
+}
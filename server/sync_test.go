@@ -0,0 +1,40 @@
+package tcpserver
+
+import (
+	"path/filepath"
+	"testing"
+
+	"lsp/server/docuri"
+	"lsp/server/lint"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentHashMismatch(t *testing.T) {
+	ts := newTestSession(t)
+	ts.clientCapabilities.Experimental.DocumentText = true
+	f := ts.addFolder("")
+	config := docuri.FromPath(filepath.Join(f.Path, lint.ConfigFile))
+	uri := docuri.FromPath(filepath.Join(f.Path, "a.txt"))
+	text := "foo qux\n"
+	ts.open(uri, text)
+	ts.open(config, "rules:\n  - term: foo\n")
+	require.Equal(t, []string{"foo"}, ts.flagged(uri, text))
+
+	// a configuration that does not match the hash is not applied, and the
+	// client is asked for its copy
+	require.NoError(t, ts.DidChange(ts.body("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": config, "version": 2},
+		"contentChanges": []map[string]interface{}{{"text": "rules:\n  - term: qux\n"}},
+		"contentHash":    "0000",
+	})))
+	require.Equal(t, []string{"foo"}, ts.flagged(uri, text))
+	snap, ok := ts.documents.Get(config)
+	require.True(t, ok)
+	require.True(t, snap.OutOfSync)
+	var asked bool
+	for _, m := range ts.messages() {
+		asked = asked || m.Method == clientDocumentText
+	}
+	require.True(t, asked)
+}
@@ -4,12 +4,13 @@ import (
 	"log"
 	"lsp/server/parse"
 	"encoding/json"
+	"lsp/server/position"
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/go-langserver/pkg/lsp"
 	"kythe.io/kythe/go/languageserver"
 )
 
-func Initialize(body *parse.LspBody, server languageserver.Server) (*ResultValue, error) {
+func (s *Session) Initialize(body *parse.LspBody, server languageserver.Server) (*ResultValue, error) {
 	params := body.Params 
 	initializeParamStruct := lsp.InitializeParams{}
 	err := json.Unmarshal(params, &initializeParamStruct)
@@ -18,6 +19,24 @@ func Initialize(body *parse.LspBody, server languageserver.Server) (*ResultValue
 		return nil, errors.New("decoding lsp body params")
 	}
 
+	clientParams := InitializeParamsValue{}
+	if err := json.Unmarshal(params, &clientParams); err != nil {
+		log.Println("decoding client capabilities")
+		return nil, errors.New("decoding client capabilities")
+	}
+
+	encoding := position.Negotiate(clientParams.Capabilities.General.PositionEncodings)
+	s.mu.Lock()
+	s.encoding = encoding
+	s.clientCapabilities = clientParams.Capabilities
+	s.mu.Unlock()
+
+	for _, folder := range initialFolders(clientParams, initializeParamStruct.Root()) {
+		if _, err := s.addFolder(folder.URI, folder.Name); err != nil {
+			log.Printf("ignoring workspace folder: %v", err)
+		}
+	}
+
 	// initializeResult, err := server.Initialize(initializeParamStruct)
 	if err != nil {
 		log.Println("decoding initialized params")
@@ -25,14 +44,33 @@ func Initialize(body *parse.LspBody, server languageserver.Server) (*ResultValue
 	}
 
 	result := ResultValue {
+		ServerInfo: ServerInfoValue{
+			Name:    ServerName,
+			Version: BuildInfo().Version,
+		},
 		Capabilities: CapabilitiesValue {
-			TextDocumentSync: 2,
+			PositionEncoding: string(encoding),
+			TextDocumentSync: TextDocumentSyncValue{
+				OpenClose:         true,
+				Change:            2,
+				WillSave:          true,
+				WillSaveWaitUntil: true,
+				Save: SaveOptionsValue{
+					IncludeText: false,
+				},
+			},
 			CompletionProvider: ResolveProviderValue{
 				ResolveProvider: true,
 			},
+			CodeActionProvider: s.codeActionProvider(),
+			DiagnosticProvider: s.diagnosticProvider(),
+			ExecuteCommandProvider: ExecuteCommandOptionsValue{
+				Commands: commands,
+			},
 			Workspace: WorkspaceValue{
 				WorkspaceFolders: WorkspaceFoldersValue{
-					Supported: true,
+					Supported:           true,
+					ChangeNotifications: true,
 				},
 			},
 		},
@@ -43,12 +81,29 @@ func Initialize(body *parse.LspBody, server languageserver.Server) (*ResultValue
 
 type ResultValue struct {
 	Capabilities CapabilitiesValue `json:"capabilities"`
+	ServerInfo   ServerInfoValue   `json:"serverInfo"`
 }
 
 type CapabilitiesValue struct {
-	TextDocumentSync   int                  `json:"textDocumentSync"`
-	CompletionProvider ResolveProviderValue `json:"completionProvider"`
-	Workspace          WorkspaceValue       `json:"workspace"`
+	PositionEncoding       string                     `json:"positionEncoding,omitempty"`
+	TextDocumentSync       TextDocumentSyncValue      `json:"textDocumentSync"`
+	CompletionProvider     ResolveProviderValue       `json:"completionProvider"`
+	CodeActionProvider     interface{}                `json:"codeActionProvider,omitempty"`
+	DiagnosticProvider     *DiagnosticOptionsValue    `json:"diagnosticProvider,omitempty"`
+	ExecuteCommandProvider ExecuteCommandOptionsValue `json:"executeCommandProvider"`
+	Workspace              WorkspaceValue             `json:"workspace"`
+}
+
+type TextDocumentSyncValue struct {
+	OpenClose         bool             `json:"openClose"`
+	Change            int              `json:"change"`
+	WillSave          bool             `json:"willSave"`
+	WillSaveWaitUntil bool             `json:"willSaveWaitUntil"`
+	Save              SaveOptionsValue `json:"save"`
+}
+
+type SaveOptionsValue struct {
+	IncludeText bool `json:"includeText"`
 }
 
 type ResolveProviderValue struct {
@@ -60,7 +115,86 @@ type WorkspaceValue struct {
 }
 
 type WorkspaceFoldersValue struct {
-	Supported bool `json:"supported"`
+	Supported           bool `json:"supported"`
+	ChangeNotifications bool `json:"changeNotifications"`
+}
+
+// InitializeParamsValue holds the parts of the initialize params that
+// lsp.InitializeParams predates.
+type InitializeParamsValue struct {
+	Capabilities     ClientCapabilitiesValue `json:"capabilities"`
+	WorkspaceFolders []WorkspaceFolderValue  `json:"workspaceFolders"`
+}
+
+type ClientCapabilitiesValue struct {
+	Workspace    WorkspaceClientCapabilitiesValue    `json:"workspace"`
+	TextDocument TextDocumentClientCapabilitiesValue `json:"textDocument"`
+	General      GeneralClientCapabilitiesValue      `json:"general"`
+	Window       WindowClientCapabilitiesValue       `json:"window"`
+	Experimental ExperimentalClientCapabilitiesValue `json:"experimental"`
+}
+
+type WorkspaceClientCapabilitiesValue struct {
+	ApplyEdit             bool                                 `json:"applyEdit"`
+	Configuration         bool                                 `json:"configuration"`
+	DidChangeWatchedFiles DynamicRegistrationValue             `json:"didChangeWatchedFiles"`
+	Diagnostics           RefreshSupportValue                  `json:"diagnostics"`
+	WorkspaceEdit         WorkspaceEditClientCapabilitiesValue `json:"workspaceEdit"`
+}
+
+type WorkspaceEditClientCapabilitiesValue struct {
+	DocumentChanges    bool     `json:"documentChanges"`
+	ResourceOperations []string `json:"resourceOperations"`
+}
+
+type TextDocumentClientCapabilitiesValue struct {
+	CodeAction CodeActionClientCapabilitiesValue `json:"codeAction"`
+	// Diagnostic is nil for clients that do not pull diagnostics.
+	Diagnostic *DynamicRegistrationValue `json:"diagnostic"`
+}
+
+type CodeActionClientCapabilitiesValue struct {
+	// CodeActionLiteralSupport is nil for clients that only take commands.
+	CodeActionLiteralSupport *CodeActionLiteralSupportValue `json:"codeActionLiteralSupport"`
+	IsPreferredSupport       bool                           `json:"isPreferredSupport"`
+}
+
+type CodeActionLiteralSupportValue struct {
+	CodeActionKind CodeActionKindValue `json:"codeActionKind"`
+}
+
+type CodeActionKindValue struct {
+	ValueSet []string `json:"valueSet"`
+}
+
+type DynamicRegistrationValue struct {
+	DynamicRegistration bool `json:"dynamicRegistration"`
+}
+
+type RefreshSupportValue struct {
+	RefreshSupport bool `json:"refreshSupport"`
+}
+
+type GeneralClientCapabilitiesValue struct {
+	PositionEncodings []string `json:"positionEncodings"`
+}
+
+type WindowClientCapabilitiesValue struct {
+	WorkDoneProgress bool `json:"workDoneProgress"`
+}
+
+// ExperimentalClientCapabilitiesValue lists the extensions to the protocol
+// a client can opt into.
+type ExperimentalClientCapabilitiesValue struct {
+	// DocumentText means the client answers $/plaintext/documentText, a
+	// request from the server with params {"textDocument": {"uri"}} whose
+	// result is {"version", "text"}: the client's full copy of the document.
+	// The server sends it when it finds its copy has drifted, either at a
+	// gap in versions or when a didChange carries a contentHash, the hex
+	// encoded SHA-256 of the full text after the changes, that does not
+	// match. contentHash is optional and may be sent without this
+	// capability; a mismatch then waits for a full-text change instead.
+	DocumentText bool `json:"plaintextDocumentText"`
 }
 
 
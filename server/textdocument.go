@@ -0,0 +1,95 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"log"
+
+	"lsp/server/document"
+	"lsp/server/parse"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+func (s *Session) DidOpen(body *parse.LspBody) error {
+	params := lsp.DidOpenTextDocumentParams{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return errors.Wrap(err, "decoding didOpen params")
+	}
+	snap, err := s.documents.Open(params.TextDocument)
+	if err != nil {
+		return errors.Wrap(err, "opening document")
+	}
+	s.documentChanged(snap)
+	return nil
+}
+
+func (s *Session) DidChange(body *parse.LspBody) error {
+	params := DidChangeParamsValue{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return errors.Wrap(err, "decoding didChange params")
+	}
+	snap, err := s.documents.Change(params.TextDocument, params.ContentChanges, s.Encoding())
+	if err != nil {
+		return errors.Wrap(err, "changing document")
+	}
+	if s.checkSync(snap, params.ContentHash) {
+		// snap was taken before it was marked; nothing is checked until
+		// the resync brings the text back
+		return nil
+	}
+	s.documentChanged(snap)
+	return nil
+}
+
+func (s *Session) DidClose(body *parse.LspBody) error {
+	params := lsp.DidCloseTextDocumentParams{}
+	if err := json.Unmarshal(body.Params, &params); err != nil {
+		return errors.Wrap(err, "decoding didClose params")
+	}
+	if err := s.documents.Close(params.TextDocument.URI); err != nil {
+		return errors.Wrap(err, "closing document")
+	}
+	if err := s.ClearDiagnostics(params.TextDocument.URI); err != nil {
+		return errors.Wrap(err, "closing document")
+	}
+	if f, ok := s.lintConfigFolder(params.TextDocument.URI); ok {
+		// what is on disk applies again
+		s.loadLintConfig(f)
+	}
+	s.wordListChanged(params.TextDocument.URI)
+	s.secretBaselineChanged(params.TextDocument.URI)
+	// the file is checked as it is on disk again
+	s.diagnosticsMayChange(params.TextDocument.URI)
+	return nil
+}
+
+// documentChanged checks a new version of a document and reports what it
+// finds. A document known to be out of sync is left alone until it is
+// back in sync, as anything found in it would point at the wrong text.
+func (s *Session) documentChanged(snap *document.Snapshot) {
+	s.diagnosticsMayChange(snap.URI)
+	if snap.OutOfSync {
+		return
+	}
+	if f, ok := s.lintConfigFolder(snap.URI); ok {
+		// an open configuration file applies as it is typed
+		s.applyLintConfig(f, snap.Text(), true)
+	}
+	// as does an open word list or secrets baseline
+	s.wordListChanged(snap.URI)
+	s.secretBaselineChanged(snap.URI)
+	if err := s.ReportDiagnostics(snap, "format", s.checkFormat(snap)); err != nil {
+		log.Printf("checking %s: %v", snap.URI, err)
+	}
+	if err := s.ReportDiagnostics(snap, "lint", s.checkLint(snap)); err != nil {
+		log.Printf("linting %s: %v", snap.URI, err)
+	}
+	if err := s.ReportDiagnostics(snap, "spell", s.checkSpelling(snap)); err != nil {
+		log.Printf("checking spelling of %s: %v", snap.URI, err)
+	}
+	if err := s.ReportDiagnostics(snap, "secret", s.checkSecrets(snap)); err != nil {
+		log.Printf("scanning %s for secrets: %v", snap.URI, err)
+	}
+	s.runLintPlugins(snap)
+}
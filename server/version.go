@@ -0,0 +1,115 @@
+package tcpserver
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+const ServerName = "plaintext-lsp"
+
+// Version is stamped at link time:
+//
+//	go build -ldflags "-X lsp/server.Version=v0.3.0" ./cmd/serve
+//
+// When it is empty the module version from the build info is used instead.
+var Version = ""
+
+// compiledFeatures lists what this build was compiled with, reported by
+// $/plaintext/buildInfo. It says nothing of what a session has turned on:
+// lint plugins, for one, may be off in its settings.
+var compiledFeatures = []string{
+	"positionEncoding",
+	"incrementalSync",
+	"saveHooks",
+	"resync",
+	"overlay",
+	"fileWatching",
+	"workspaceFolders",
+	"lineEndings",
+	"virtualDocuments",
+	"lint",
+	"lintConfig",
+	"codeActions",
+	"suppressions",
+	"unicodeMatching",
+	"lintPlugins",
+	"rulePacks",
+	"lintReload",
+	"pullDiagnostics",
+	"spellCheck",
+	"wordLists",
+	"proseChecks",
+	"secretDetection",
+}
+
+type ServerInfoValue struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type BuildInfoValue struct {
+	Name             string   `json:"name"`
+	Version          string   `json:"version"`
+	Module           string   `json:"module,omitempty"`
+	GoVersion        string   `json:"goVersion,omitempty"`
+	VCS              string   `json:"vcs,omitempty"`
+	VCSRevision      string   `json:"vcsRevision,omitempty"`
+	VCSTime          string   `json:"vcsTime,omitempty"`
+	VCSModified      bool     `json:"vcsModified,omitempty"`
+	CompiledFeatures []string `json:"compiledFeatures"`
+}
+
+// BuildInfo collects the version and VCS metadata embedded in the binary.
+func BuildInfo() *BuildInfoValue {
+	info := &BuildInfoValue{
+		Name:             ServerName,
+		Version:          Version,
+		CompiledFeatures: append([]string(nil), compiledFeatures...),
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		if info.Version == "" {
+			info.Version = "unknown"
+		}
+		return info
+	}
+
+	info.Module = bi.Main.Path
+	info.GoVersion = bi.GoVersion
+	if info.Version == "" {
+		info.Version = bi.Main.Version
+	}
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs":
+			info.VCS = setting.Value
+		case "vcs.revision":
+			info.VCSRevision = setting.Value
+		case "vcs.time":
+			info.VCSTime = setting.Value
+		case "vcs.modified":
+			info.VCSModified = setting.Value == "true"
+		}
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	return info
+}
+
+// VersionString is the one line printed by -version.
+func VersionString() string {
+	info := BuildInfo()
+	s := fmt.Sprintf("%s %s", info.Name, info.Version)
+	if info.VCSRevision != "" {
+		s += " " + info.VCSRevision
+		if info.VCSModified {
+			s += "+dirty"
+		}
+	}
+	if info.GoVersion != "" {
+		s += " " + info.GoVersion
+	}
+	return s
+}
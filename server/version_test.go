@@ -0,0 +1,34 @@
+package tcpserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildInfo(t *testing.T) {
+	info := BuildInfo()
+	require.Equal(t, ServerName, info.Name)
+	require.NotEmpty(t, info.Version)
+	require.Equal(t, compiledFeatures, info.CompiledFeatures)
+
+	// callers get a copy of the list
+	info.CompiledFeatures[0] = "changed"
+	require.NotEqual(t, "changed", compiledFeatures[0])
+
+	defer func(v string) { Version = v }(Version)
+	Version = "v1.2.3"
+	require.Equal(t, "v1.2.3", BuildInfo().Version)
+}
+
+func TestVersionString(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	Version = "v1.2.3"
+	s := VersionString()
+	require.True(t, strings.HasPrefix(s, ServerName+" v1.2.3"), s)
+	if info := BuildInfo(); info.GoVersion != "" {
+		require.True(t, strings.HasSuffix(s, " "+info.GoVersion), s)
+	}
+	require.NotContains(t, s, "\n")
+}
@@ -0,0 +1,37 @@
+// Package watch reports changes to files under a set of directories. It is
+// the fallback for clients that cannot send workspace/didChangeWatchedFiles
+// and is only implemented on Linux, on top of inotify.
+package watch
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Op is what happened to a file. The values match the LSP FileChangeType.
+type Op int
+
+const (
+	Created Op = 1
+	Changed Op = 2
+	Deleted Op = 3
+)
+
+func (op Op) String() string {
+	switch op {
+	case Created:
+		return "created"
+	case Changed:
+		return "changed"
+	case Deleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// Event is a change to the file or directory at Path.
+type Event struct {
+	Path string
+	Op   Op
+}
+
+var ErrUnsupported = errors.New("file watching not supported on this platform")
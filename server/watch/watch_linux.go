@@ -0,0 +1,198 @@
+//go:build linux
+// +build linux
+
+package watch
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// mask picks the inotify events worth reporting. IN_CLOSE_WRITE rather
+// than IN_MODIFY reports a write once it is finished instead of once per
+// chunk.
+const mask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+// Watcher watches directory trees with inotify. inotify is not recursive,
+// so every directory gets its own watch, and new directories are watched
+// as they appear.
+type Watcher struct {
+	fd     int
+	file   *os.File
+	handle func(Event)
+	skip   func(path string, isDir bool) bool
+
+	mu    sync.Mutex
+	dirs  map[int]string
+	watch map[string]int
+	done  chan struct{}
+}
+
+// New starts a watcher that calls handle for every change, from its own
+// goroutine. Paths for which skip returns true are not reported, and
+// skipped directories are not watched at all.
+func New(handle func(Event), skip func(path string, isDir bool) bool) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing inotify")
+	}
+	w := &Watcher{
+		fd: fd,
+		// a non-blocking descriptor goes through the runtime poller, so
+		// Close can interrupt a pending Read
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		handle: handle,
+		skip:   skip,
+		dirs:   map[int]string{},
+		watch:  map[string]int{},
+		done:   make(chan struct{}),
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+// Add watches root and every directory below it that is not skipped.
+func (w *Watcher) Add(root string) error {
+	return w.addTree(filepath.Clean(root), nil)
+}
+
+// addTree watches dir and the directories below it. When found is not nil
+// it is called for every file and directory already below dir, which covers
+// those created in a new directory before its watch was in place.
+func (w *Watcher) addTree(dir string, found func(path string)) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return errors.Wrapf(err, "watching %s", dir)
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			if found != nil && !w.skip(path, false) {
+				found(path)
+			}
+			return nil
+		}
+		if path != dir {
+			if w.skip(path, true) {
+				return filepath.SkipDir
+			}
+			if found != nil {
+				found(path)
+			}
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, mask)
+		if err != nil {
+			if path == dir {
+				return errors.Wrapf(err, "watching %s", path)
+			}
+			log.Printf("watching %s: %v", path, err)
+			return filepath.SkipDir
+		}
+		w.mu.Lock()
+		w.dirs[wd] = path
+		w.watch[path] = wd
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+// Remove stops watching root and the directories below it.
+func (w *Watcher) Remove(root string) {
+	root = filepath.Clean(root)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for path, wd := range w.watch {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			// the kernel answers with IN_IGNORED, which finds nothing left
+			// to forget
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.watch, path)
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+// Close stops the watcher. No events are delivered once it returns.
+func (w *Watcher) Close() error {
+	err := w.file.Close()
+	<-w.done
+	return errors.Wrap(err, "closing inotify")
+}
+
+func (w *Watcher) readEvents() {
+	defer close(w.done)
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Printf("reading inotify events: %v", err)
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[nameStart:nameStart+int(raw.Len)], "\x00"))
+			offset = nameStart + int(raw.Len)
+			w.event(int(raw.Wd), raw.Mask, name)
+		}
+	}
+}
+
+func (w *Watcher) event(wd int, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		log.Printf("inotify queue overflowed, some file changes were missed")
+		return
+	}
+
+	w.mu.Lock()
+	dir, ok := w.dirs[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		// the directory is gone or was removed from the watch
+		delete(w.dirs, wd)
+		if w.watch[dir] == wd {
+			delete(w.watch, dir)
+		}
+	}
+	w.mu.Unlock()
+	if !ok || name == "" {
+		return
+	}
+
+	path := filepath.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0
+	if w.skip(path, isDir) {
+		return
+	}
+
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		w.handle(Event{Path: path, Op: Created})
+		if isDir {
+			err := w.addTree(path, func(file string) {
+				w.handle(Event{Path: file, Op: Created})
+			})
+			if err != nil {
+				log.Printf("watching new directory: %v", err)
+			}
+		}
+	case mask&syscall.IN_CLOSE_WRITE != 0:
+		w.handle(Event{Path: path, Op: Changed})
+	case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		if isDir {
+			w.Remove(path)
+		}
+		w.handle(Event{Path: path, Op: Deleted})
+	}
+}
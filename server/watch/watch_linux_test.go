@@ -0,0 +1,79 @@
+//go:build linux
+// +build linux
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "skipped"), 0755))
+
+	events := make(chan Event, 100)
+	w, err := New(func(e Event) {
+		events <- e
+	}, func(path string, isDir bool) bool {
+		return filepath.Base(path) == "skipped" || filepath.Ext(path) == ".tmp"
+	})
+	require.NoError(t, err)
+	defer w.Close()
+	require.NoError(t, w.Add(root))
+
+	next := func() Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+		}
+		return Event{}
+	}
+	rel := func(e Event) Event {
+		path, err := filepath.Rel(root, e.Path)
+		require.NoError(t, err)
+		return Event{Path: filepath.ToSlash(path), Op: e.Op}
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "scratch.tmp"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "skipped", "a.txt"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "notes.txt"), []byte("x"), 0644))
+	require.Equal(t, Event{Path: "notes.txt", Op: Created}, rel(next()))
+	require.Equal(t, Event{Path: "notes.txt", Op: Changed}, rel(next()))
+
+	require.NoError(t, os.Remove(filepath.Join(root, "notes.txt")))
+	require.Equal(t, Event{Path: "notes.txt", Op: Deleted}, rel(next()))
+
+	// a directory created together with its contents
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "docs", "deep"), 0755))
+	require.Equal(t, Event{Path: "docs", Op: Created}, rel(next()))
+	for {
+		e := rel(next())
+		if e.Path == "docs/deep" {
+			require.Equal(t, Created, e.Op)
+			break
+		}
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(root, "docs", "deep", "guide.txt"), []byte("x"), 0644))
+	for {
+		e := rel(next())
+		if e.Op == Changed {
+			require.Equal(t, Event{Path: "docs/deep/guide.txt", Op: Changed}, e)
+			break
+		}
+	}
+
+	require.NoError(t, w.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(root, "late.txt"), []byte("x"), 0644))
+	select {
+	case e := <-events:
+		t.Fatalf("event after close: %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
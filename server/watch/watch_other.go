@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+// Watcher is not available on this platform; New always fails.
+type Watcher struct{}
+
+func New(handle func(Event), skip func(path string, isDir bool) bool) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+func (w *Watcher) Add(root string) error {
+	return ErrUnsupported
+}
+
+func (w *Watcher) Remove(root string) {}
+
+func (w *Watcher) Close() error {
+	return nil
+}
@@ -0,0 +1,235 @@
+package tcpserver
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"lsp/server/document"
+	"lsp/server/docuri"
+	"lsp/server/spell"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// commandAddToDictionary adds a word to a word list. It takes the URI of
+// the document the word is in, the word and which list: dictionaryWorkspace
+// for that of the document's workspace folder, or dictionaryUser for the
+// user's own.
+const commandAddToDictionary = "plaintext.addToDictionary"
+
+const (
+	dictionaryWorkspace = "workspace"
+	dictionaryUser      = "user"
+)
+
+// userWordList returns where the user's own word list is kept, which
+// applies in every workspace: words.txt in the server's directory of the
+// user configuration directory, such as ~/.config/plaintext-lsp on Linux.
+func userWordList() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		log.Printf("no user word list: %v", err)
+		return ""
+	}
+	return filepath.Join(dir, ServerName, "words.txt")
+}
+
+// acceptedWord reports whether text, a word or a phrase found in the
+// document at uri, is on the word list of its workspace folder or on the
+// user's. Such words are neither misspelled nor lint findings.
+func (s *Session) acceptedWord(uri lsp.DocumentURI, text string) bool {
+	if f, ok := s.folders.For(uri); ok && s.wordList(filepath.Join(f.Path, spell.WordListFile)).Has(text) {
+		return true
+	}
+	return s.userWords != "" && s.wordList(s.userWords).Has(text)
+}
+
+// wordList returns the word list at path, read from the editor if it is
+// open there and from disk otherwise. Lists are kept until they change.
+func (s *Session) wordList(path string) *spell.WordList {
+	s.spellMu.Lock()
+	defer s.spellMu.Unlock()
+	if l, ok := s.wordLists[path]; ok {
+		return l
+	}
+	var text string
+	if snap, open := s.documents.Get(docuri.FromPath(path)); open {
+		text = snap.Text()
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("reading word list: %v", err)
+		}
+		text = string(data)
+	}
+	l := spell.ParseWordList(text)
+	// words just added may not have reached the file or the editor's copy
+	// yet
+	var pending []string
+	for _, word := range s.addedWords[path] {
+		if !l.Has(word) {
+			l = l.With(word)
+			pending = append(pending, word)
+		}
+	}
+	s.addedWords[path] = pending
+	s.wordLists[path] = l
+	return l
+}
+
+// isWordList reports whether uri is a word list: that of a workspace
+// folder or the user's.
+func (s *Session) isWordList(uri lsp.DocumentURI) bool {
+	path, err := docuri.Filename(uri)
+	if err != nil {
+		return false
+	}
+	if path == s.userWords && path != "" {
+		return true
+	}
+	f, ok := s.folders.For(uri)
+	return ok && path == filepath.Join(f.Path, spell.WordListFile)
+}
+
+// wordListChanged forgets the word list at uri, if it is one, so that it
+// is read again, and checks the documents it applies to again.
+func (s *Session) wordListChanged(uri lsp.DocumentURI) {
+	if !s.isWordList(uri) {
+		return
+	}
+	path, _ := docuri.Filename(uri)
+	s.spellMu.Lock()
+	delete(s.wordLists, path)
+	s.spellMu.Unlock()
+	s.recheckWords(path)
+}
+
+// recheckWords checks the open documents the word list at path applies to
+// again: those of its folder, or every one for the user's list. Word lists
+// themselves are left alone, as they change nothing about each other.
+func (s *Session) recheckWords(path string) {
+	for _, snap := range s.documents.All() {
+		if s.isWordList(snap.URI) {
+			continue
+		}
+		if path != s.userWords {
+			if f, ok := s.folders.For(snap.URI); !ok || filepath.Join(f.Path, spell.WordListFile) != path {
+				continue
+			}
+		}
+		s.documentChanged(snap)
+	}
+	// files that are not open are affected too
+	s.refreshDiagnostics()
+}
+
+// wordListPath returns the path of the word list of the given kind for the
+// document at uri.
+func (s *Session) wordListPath(uri lsp.DocumentURI, list string) (string, error) {
+	switch list {
+	case dictionaryWorkspace:
+		f, ok := s.folders.For(uri)
+		if !ok {
+			return "", errors.Errorf("%s is not in a workspace folder", uri)
+		}
+		return filepath.Join(f.Path, spell.WordListFile), nil
+	case dictionaryUser:
+		if s.userWords == "" {
+			return "", errors.New("there is no user word list")
+		}
+		return s.userWords, nil
+	}
+	return "", errors.Errorf("unknown word list %q", list)
+}
+
+// addToDictionary adds word to a word list. The client makes the edit,
+// creating the list if it does not exist yet, and documents are checked
+// again as soon as it has. A list that is not open is written instead
+// when the client cannot make the edit.
+func (s *Session) addToDictionary(uri lsp.DocumentURI, word, list string) error {
+	path, err := s.wordListPath(uri, list)
+	if err != nil {
+		return err
+	}
+	listURI := docuri.FromPath(path)
+	snap, exists := s.documents.Get(listURI)
+	open := exists
+	if !open {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			exists = true
+		case !os.IsNotExist(err):
+			return errors.Wrap(err, "reading word list")
+		}
+		snap = document.NewSnapshot(listURI, "plaintext", 0, string(data))
+	}
+	text := snap.Text()
+	added := spell.AppendWord(text, word, string(snap.LineEndings().Dominant()))
+
+	if !open && (!s.canApplyEdit() || (!exists && !s.canCreateFiles())) {
+		if err := writeWordList(path, added); err != nil {
+			return err
+		}
+		s.files.Invalidate(listURI)
+		s.wordListChanged(listURI)
+		return nil
+	}
+
+	rng, err := snap.RangeOf(len(text), len(text), s.Encoding())
+	if err != nil {
+		return err
+	}
+	edit := WorkspaceEditValue{Changes: textEdit(listURI, rng, added[len(text):]).Changes}
+	if !exists {
+		edit = WorkspaceEditValue{DocumentChanges: []interface{}{
+			CreateFileValue{Kind: "create", URI: listURI, Options: &CreateFileOptionsValue{IgnoreIfExists: true}},
+			TextDocumentEditValue{
+				TextDocument: OptionalVersionedTextDocumentIdentifierValue{URI: listURI},
+				Edits:        []lsp.TextEdit{{Range: rng, NewText: added}},
+			},
+		}}
+	}
+	label := fmt.Sprintf("Add %q to the %s dictionary", word, list)
+	return s.applyWorkspaceEditThen(label, edit, func() {
+		// the list will be read again once the client sends or saves the
+		// edited text; until then, take the word as added
+		s.spellMu.Lock()
+		s.addedWords[path] = append(s.addedWords[path], word)
+		delete(s.wordLists, path)
+		s.spellMu.Unlock()
+		s.recheckWords(path)
+	})
+}
+
+func writeWordList(path, text string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "creating word list")
+	}
+	return errors.Wrap(os.WriteFile(path, []byte(text), 0644), "writing word list")
+}
+
+// dictionaryActions returns the actions adding text, found at diagnostic
+// in the document at uri, to the word lists it may go in.
+func (s *Session) dictionaryActions(uri lsp.DocumentURI, text string, diagnostic DiagnosticValue) []CodeActionValue {
+	var actions []CodeActionValue
+	for _, list := range []string{dictionaryWorkspace, dictionaryUser} {
+		if _, err := s.wordListPath(uri, list); err != nil {
+			continue
+		}
+		actions = append(actions, CodeActionValue{
+			Title:       fmt.Sprintf("Add %q to the %s dictionary", text, list),
+			Kind:        codeActionQuickFix,
+			Diagnostics: []DiagnosticValue{diagnostic},
+			Command: &lsp.Command{
+				Title:     fmt.Sprintf("Add %q to dictionary", text),
+				Command:   commandAddToDictionary,
+				Arguments: []interface{}{uri, text, list},
+			},
+		})
+	}
+	return actions
+}
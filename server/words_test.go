@@ -0,0 +1,110 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lsp/server/docuri"
+	"lsp/server/spell"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+// appliedEdits returns the edits the server asked the client to make, as
+// sent.
+func (ts *testSession) appliedEdits() []json.RawMessage {
+	var edits []json.RawMessage
+	for _, m := range ts.messages() {
+		if m.Method == clientApplyEdit {
+			var params struct{ Edit json.RawMessage }
+			require.NoError(ts.t, json.Unmarshal(m.Params, &params))
+			edits = append(edits, params.Edit)
+		}
+	}
+	return edits
+}
+
+func TestAddToDictionaryWritten(t *testing.T) {
+	ts := newTestSession(t)
+	f := ts.addFolder("")
+	path := filepath.Join(f.Path, spell.WordListFile)
+	uri := docuri.FromPath(filepath.Join(f.Path, "a.txt"))
+
+	// a client that cannot edit has the list written for it
+	require.NoError(t, ts.addToDictionary(uri, "foo", dictionaryWorkspace))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "foo\n", string(data))
+	require.NoError(t, os.WriteFile(path, []byte("# words\r\nbar\r\n"), 0644))
+	require.NoError(t, ts.addToDictionary(uri, "foo", dictionaryWorkspace))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "# words\r\nbar\r\nfoo\r\n", string(data))
+
+	// as does one that edits but cannot create a list that is missing
+	ts.clientCapabilities.Workspace.ApplyEdit = true
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, ts.addToDictionary(uri, "foo", dictionaryWorkspace))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "foo\n", string(data))
+	require.Empty(t, ts.appliedEdits())
+}
+
+func TestAddToDictionaryEdited(t *testing.T) {
+	ts := newTestSession(t)
+	ts.clientCapabilities.Workspace.ApplyEdit = true
+	ts.clientCapabilities.Workspace.WorkspaceEdit = WorkspaceEditClientCapabilitiesValue{
+		DocumentChanges:    true,
+		ResourceOperations: []string{"create", "rename"},
+	}
+	f := ts.addFolder("")
+	path := filepath.Join(f.Path, spell.WordListFile)
+	list := docuri.FromPath(path)
+	uri := docuri.FromPath(filepath.Join(f.Path, "a.txt"))
+
+	// a missing list is created by the client
+	require.NoError(t, ts.addToDictionary(uri, "foo", dictionaryWorkspace))
+	_, err := os.Stat(path)
+	require.True(t, os.IsNotExist(err), "written: %v", err)
+	edits := ts.appliedEdits()
+	require.Len(t, edits, 1)
+	require.JSONEq(t, `{"documentChanges": [
+		{"kind": "create", "uri": "`+string(list)+`", "options": {"ignoreIfExists": true}},
+		{"textDocument": {"uri": "`+string(list)+`", "version": null}, "edits": [
+			{"range": {"start": {"line": 0, "character": 0}, "end": {"line": 0, "character": 0}}, "newText": "foo\n"}
+		]}
+	]}`, string(edits[0]))
+
+	// one that is not open is edited through the client too, leaving the
+	// file alone
+	require.NoError(t, os.WriteFile(path, []byte("# words\r\nbar\r\n"), 0644))
+	require.NoError(t, ts.addToDictionary(uri, "foo", dictionaryWorkspace))
+	edits = ts.appliedEdits()
+	require.Len(t, edits, 2)
+	var edit WorkspaceEditValue
+	require.NoError(t, json.Unmarshal(edits[1], &edit))
+	require.Equal(t, []lsp.TextEdit{{
+		Range:   lsp.Range{Start: lsp.Position{Line: 2}, End: lsp.Position{Line: 2}},
+		NewText: "foo\r\n",
+	}}, edit.Changes[string(list)])
+	require.Empty(t, edit.DocumentChanges)
+
+	// as is an open one, as the editor has it
+	ts.open(list, "bar\n")
+	require.NoError(t, ts.addToDictionary(uri, "foo", dictionaryWorkspace))
+	edits = ts.appliedEdits()
+	require.Len(t, edits, 3)
+	edit = WorkspaceEditValue{}
+	require.NoError(t, json.Unmarshal(edits[2], &edit))
+	require.Equal(t, []lsp.TextEdit{{
+		Range:   lsp.Range{Start: lsp.Position{Line: 1}, End: lsp.Position{Line: 1}},
+		NewText: "foo\n",
+	}}, edit.Changes[string(list)])
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "# words\r\nbar\r\n", string(data))
+}
@@ -0,0 +1,202 @@
+// Package workspace tracks the folders the client has open. Each folder is
+// handled on its own: it has its own settings and its own index of the
+// files in it, and it can be added or removed while the server runs.
+package workspace
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"lsp/server/docuri"
+	"lsp/server/overlay"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// Folder is one root folder of the workspace.
+type Folder struct {
+	URI  lsp.DocumentURI
+	Name string
+	Path string
+
+	mu       sync.RWMutex
+	settings json.RawMessage
+	files    map[lsp.DocumentURI]struct{}
+}
+
+// NewFolder returns the folder at uri. Only file URIs can be folders, since
+// their files are read from disk.
+func NewFolder(uri lsp.DocumentURI, name string) (*Folder, error) {
+	path, err := docuri.Filename(uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving workspace folder")
+	}
+	path = filepath.Clean(path)
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	return &Folder{
+		URI:   uri,
+		Name:  name,
+		Path:  path,
+		files: map[lsp.DocumentURI]struct{}{},
+	}, nil
+}
+
+// Contains reports whether the file at uri is inside the folder.
+func (f *Folder) Contains(uri lsp.DocumentURI) bool {
+	path, err := docuri.Filename(uri)
+	if err != nil {
+		return false
+	}
+	return path == f.Path || strings.HasPrefix(path, f.Path+string(filepath.Separator))
+}
+
+// Settings returns the folder's settings as the client last sent them, or
+// nil if it never has.
+func (f *Folder) Settings() json.RawMessage {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.settings
+}
+
+func (f *Folder) SetSettings(settings json.RawMessage) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.settings = settings
+}
+
+// DecodeSettings unmarshals the folder's settings into v, leaving v as it
+// is when there are none.
+func (f *Folder) DecodeSettings(v interface{}) error {
+	settings := f.Settings()
+	if len(settings) == 0 || string(settings) == "null" {
+		return nil
+	}
+	return errors.Wrapf(json.Unmarshal(settings, v), "decoding settings of %s", f.Name)
+}
+
+// Index walks the folder and records every file in it that fs does not
+// exclude. Files for which skip returns true, such as those belonging to a
+// nested folder, are left out.
+func (f *Folder) Index(fs *overlay.FS, skip func(uri lsp.DocumentURI) bool) error {
+	files := map[lsp.DocumentURI]struct{}{}
+	err := fs.WalkRoot(f.Path, func(uri lsp.DocumentURI) error {
+		if !skip(uri) {
+			files[uri] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "indexing %s", f.Name)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files = files
+	return nil
+}
+
+// Files returns the indexed files of the folder in sorted order.
+func (f *Folder) Files() []lsp.DocumentURI {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	files := make([]lsp.DocumentURI, 0, len(f.files))
+	for uri := range f.files {
+		files = append(files, uri)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i] < files[j]
+	})
+	return files
+}
+
+// FileChanged keeps the index up to date with a file created or deleted in
+// the folder.
+func (f *Folder) FileChanged(uri lsp.DocumentURI, change lsp.FileChangeType) {
+	// the index holds canonical URIs, which the client's may not be
+	uri = docuri.Normalize(uri)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch change {
+	case lsp.Created:
+		f.files[uri] = struct{}{}
+	case lsp.Deleted:
+		delete(f.files, uri)
+		// a deleted directory takes its files with it
+		prefix := strings.TrimSuffix(string(uri), "/") + "/"
+		for file := range f.files {
+			if strings.HasPrefix(string(file), prefix) {
+				delete(f.files, file)
+			}
+		}
+	}
+}
+
+// Set is the folders of a workspace. It is safe for concurrent use.
+type Set struct {
+	mu      sync.RWMutex
+	folders []*Folder
+}
+
+func NewSet() *Set {
+	return &Set{}
+}
+
+// Add adds f unless a folder at the same path is already there.
+func (s *Set) Add(f *Folder) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range s.folders {
+		if g.Path == f.Path {
+			return false
+		}
+	}
+	s.folders = append(s.folders, f)
+	sort.Slice(s.folders, func(i, j int) bool {
+		return s.folders[i].Path < s.folders[j].Path
+	})
+	return true
+}
+
+// Remove removes and returns the folder at uri.
+func (s *Set) Remove(uri lsp.DocumentURI) (*Folder, bool) {
+	path, err := docuri.Filename(uri)
+	if err != nil {
+		return nil, false
+	}
+	path = filepath.Clean(path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.folders {
+		if f.Path == path {
+			s.folders = append(s.folders[:i], s.folders[i+1:]...)
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// All returns every folder, ordered by path.
+func (s *Set) All() []*Folder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Folder(nil), s.folders...)
+}
+
+// For returns the folder a document belongs to. With nested folders that
+// is the innermost one.
+func (s *Set) For(uri lsp.DocumentURI) (*Folder, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var best *Folder
+	for _, f := range s.folders {
+		if f.Contains(uri) && (best == nil || len(f.Path) > len(best.Path)) {
+			best = f
+		}
+	}
+	return best, best != nil
+}
@@ -0,0 +1,107 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lsp/server/document"
+	"lsp/server/docuri"
+	"lsp/server/overlay"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetFor(t *testing.T) {
+	set := NewSet()
+	for _, uri := range []lsp.DocumentURI{"file:///repo", "file:///repo/docs", "file:///other"} {
+		f, err := NewFolder(uri, "")
+		require.NoError(t, err)
+		require.True(t, set.Add(f))
+	}
+	dup, err := NewFolder("file:///repo/", "again")
+	require.NoError(t, err)
+	require.False(t, set.Add(dup))
+
+	tests := []struct {
+		uri  lsp.DocumentURI
+		want string
+	}{
+		{uri: "file:///repo/README.md", want: "repo"},
+		{uri: "file:///repo/docs/guide.txt", want: "docs"},
+		{uri: "file:///repo/docsextra/a.txt", want: "repo"},
+		{uri: "file:///other/a.txt", want: "other"},
+		{uri: "file:///elsewhere/a.txt", want: ""},
+		{uri: "untitled:Untitled-1", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.uri), func(t *testing.T) {
+			f, ok := set.For(tt.uri)
+			if tt.want == "" {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.Equal(t, tt.want, f.Name)
+		})
+	}
+
+	_, ok := set.Remove("file:///repo/docs")
+	require.True(t, ok)
+	f, ok := set.For("file:///repo/docs/guide.txt")
+	require.True(t, ok)
+	require.Equal(t, "repo", f.Name)
+	require.Len(t, set.All(), 2)
+}
+
+func TestFolderIndex(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		".gitignore":   "*.log\n",
+		"a.txt":        "a",
+		"debug.log":    "ignored",
+		"nested/b.txt": "b",
+		"docs/c.txt":   "c",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	fs := overlay.New(document.NewStore(), overlay.Options{})
+	fs.AddRoot(root)
+
+	f, err := NewFolder(docuri.FromPath(root), "root")
+	require.NoError(t, err)
+	nested := docuri.FromPath(filepath.Join(root, "nested"))
+	require.NoError(t, f.Index(fs, func(uri lsp.DocumentURI) bool {
+		return len(uri) > len(nested) && uri[:len(nested)+1] == nested+"/"
+	}))
+
+	uri := func(name string) lsp.DocumentURI {
+		return docuri.FromPath(filepath.Join(root, filepath.FromSlash(name)))
+	}
+	require.Equal(t, []lsp.DocumentURI{uri(".gitignore"), uri("a.txt"), uri("docs/c.txt")}, f.Files())
+
+	f.FileChanged(uri("new.txt"), lsp.Created)
+	f.FileChanged(uri("docs"), lsp.Deleted)
+	require.Equal(t, []lsp.DocumentURI{uri(".gitignore"), uri("a.txt"), uri("new.txt")}, f.Files())
+}
+
+func TestDecodeSettings(t *testing.T) {
+	f, err := NewFolder("file:///repo", "")
+	require.NoError(t, err)
+
+	settings := struct {
+		MaxProblems int `json:"maxProblems"`
+	}{MaxProblems: 100}
+	require.NoError(t, f.DecodeSettings(&settings))
+	require.Equal(t, 100, settings.MaxProblems)
+
+	f.SetSettings([]byte(`{"maxProblems": 5}`))
+	require.NoError(t, f.DecodeSettings(&settings))
+	require.Equal(t, 5, settings.MaxProblems)
+
+	f.SetSettings([]byte(`{"maxProblems": "many"}`))
+	require.Error(t, f.DecodeSettings(&settings))
+}